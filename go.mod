@@ -8,4 +8,11 @@ require golang.org/x/crypto v0.48.0
 
 require github.com/joho/godotenv v1.5.1
 
-require filippo.io/edwards25519 v1.2.0 // indirect
+require github.com/mattn/go-sqlite3 v1.14.33
+
+require github.com/lib/pq v1.12.3
+
+require (
+	filippo.io/edwards25519 v1.2.0 // indirect
+	golang.org/x/sys v0.41.0 // indirect
+)
@@ -2,65 +2,70 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
-	"math/rand"
+	"log"
 	"net/http"
+	"time"
+	"web-app/internal/captcha"
 	"web-app/internal/database"
 	"web-app/internal/utils"
 )
 
-type MathCaptcha struct {
-	ID       string `json:"captcha_id"`
-	Question string `json:"question"`
-	Num1     int    `json:"num1"`
-	Num2     int    `json:"num2"`
-	Operator string `json:"operator"`
+// captchaTTL is how long a client has to solve a captcha.
+const captchaTTL = 5 * time.Minute
+
+// Challenge is the response of GET /captcha: the captcha ID to send back
+// with the answer and what to show the user.
+type Challenge struct {
+	ID string `json:"captcha_id"`
+	captcha.Challenge
+}
+
+// MathCaptcha is the former name of Challenge.
+type MathCaptcha = Challenge
+
+// HandleCaptcha serves math challenges.
+func HandleCaptcha(store database.CaptchaStore) http.HandlerFunc {
+	return HandleCaptchaWith(store, captcha.Math{})
+}
+
+// HandleCaptchaWith serves challenges from provider and stores their answers
+// for the handler that checks them, which must use the same provider.
+func HandleCaptchaWith(store database.CaptchaStore, provider captcha.Provider) http.HandlerFunc {
+	return HandleCaptchaFrom(captcha.Stored{Store: store}, provider)
 }
 
-func HandleCaptcha(db *database.DB) http.HandlerFunc {
+// HandleCaptchaFrom serves challenges from provider under IDs from issuer.
+// The handler that checks them must redeem them with the same issuer and
+// provider.
+func HandleCaptchaFrom(issuer captcha.Issuer, provider captcha.Provider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		num1 := rand.Intn(20) + 1
-		num2 := rand.Intn(20) + 1
-		operators := []string{"+", "-", "*"}
-		op := operators[rand.Intn(len(operators))]
-
-		var result int
-		switch op {
-		case "+":
-			result = num1 + num2
-		case "-":
-			result = num1 - num2
-		case "*":
-			result = num1 * num2
+		nonce, err := utils.GenerateSecureToken(16)
+		if err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
 		}
 
-		captchaID, err := utils.GenerateSecureToken(16)
+		challenge, answer, err := provider.Generate(nonce)
 		if err != nil {
+			log.Printf("DEBUG: Captcha Generate Error: %v", err)
 			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		}
 
-		_, err = db.Exec("INSERT INTO captchas (id, answer) VALUES (?, ?)",
-			captchaID, fmt.Sprintf("%d", result))
+		captchaID, err := issuer.Issue(nonce, answer, time.Now().Add(captchaTTL))
 		if err != nil {
+			log.Printf("DEBUG: Captcha Issue Error: %v", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
 
-		resp := MathCaptcha{
-			ID:       captchaID,
-			Question: "What is the answer to this equation?",
-			Num1:     num1,
-			Num2:     num2,
-			Operator: op,
-		}
-
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(Challenge{ID: captchaID, Challenge: *challenge})
 	}
 }
@@ -0,0 +1,92 @@
+// Package captcha generates the challenges that keep bots away from the
+// registration form and checks the answers to them.
+//
+// A Provider makes a challenge for a captcha ID and an answer that the
+// server keeps; the client only ever sees the Challenge.
+package captcha
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+// Challenge is what the client renders. Which fields are set depends on
+// Type.
+type Challenge struct {
+	// Type is "math", "image", "audio", "pow", or the third-party widget
+	// "turnstile", "hcaptcha" or "recaptcha".
+	Type     string `json:"type"`
+	Question string `json:"question"`
+	// Image is a data: URL of a PNG.
+	Image string `json:"image,omitempty"`
+	// Audio is a data: URL of a WAV file.
+	Audio string `json:"audio,omitempty"`
+	// Nonce and Difficulty describe a proof of work: find a counter such
+	// that SHA-256(Nonce + ":" + counter) starts with Difficulty zero bits.
+	Nonce      string `json:"nonce,omitempty"`
+	Difficulty int    `json:"difficulty,omitempty"`
+	// SiteKey identifies this site to a third-party widget.
+	SiteKey string `json:"site_key,omitempty"`
+}
+
+// Provider makes and checks one kind of challenge.
+type Provider interface {
+	// Generate makes the challenge for captcha id and returns it with the
+	// answer to store on the server.
+	Generate(id string) (*Challenge, string, error)
+	// Check reports whether response solves captcha id, whose stored answer
+	// is answer.
+	Check(id, answer, response string) bool
+}
+
+// checkText compares a typed answer with the stored one, ignoring
+// surrounding spaces.
+func checkText(answer, response string) bool {
+	return answer != "" && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(response)), []byte(answer)) == 1
+}
+
+// randomDigits returns n random decimal digits, without zero when noZero is
+// set.
+func randomDigits(n int, noZero bool) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		if noZero {
+			b.WriteByte(byte('1' + rand.IntN(9)))
+		} else {
+			b.WriteByte(byte('0' + rand.IntN(10)))
+		}
+	}
+	return b.String()
+}
+
+// Math asks for the result of a small sum, difference or product. It is
+// the easiest challenge for people and bots alike.
+type Math struct{}
+
+func (Math) Generate(id string) (*Challenge, string, error) {
+	num1 := rand.IntN(20) + 1
+	num2 := rand.IntN(20) + 1
+	operators := []string{"+", "-", "*"}
+	op := operators[rand.IntN(len(operators))]
+
+	var result int
+	switch op {
+	case "+":
+		result = num1 + num2
+	case "-":
+		result = num1 - num2
+	case "*":
+		result = num1 * num2
+	}
+
+	return &Challenge{
+		Type:     "math",
+		Question: fmt.Sprintf("What is %d %s %d?", num1, op, num2),
+	}, fmt.Sprintf("%d", result), nil
+}
+
+func (Math) Check(id, answer, response string) bool {
+	return checkText(answer, response)
+}
@@ -0,0 +1,161 @@
+package captcha
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand/v2"
+)
+
+// digitFont is a 5x7 bitmap font for the digits 0-9, one row per string.
+var digitFont = [10][7]string{
+	{".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	{"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	{".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	{"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	{"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	{"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	{"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	{"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	{".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	{".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+}
+
+const (
+	imageCellSize   = 5  // pixels per font dot
+	imageGlyphWidth = 36 // horizontal space per digit
+	imageHeight     = 64
+	imageMargin     = 12
+)
+
+// Image shows a few digits in a PNG, each shifted, slanted and coloured on
+// its own, with the whole picture warped and covered in lines and dots so
+// that plain OCR fails.
+type Image struct {
+	// Length is the number of digits; zero means 6.
+	Length int
+}
+
+func (i Image) length() int {
+	if i.Length <= 0 {
+		return 6
+	}
+	return i.Length
+}
+
+func (i Image) Generate(id string) (*Challenge, string, error) {
+	code := randomDigits(i.length(), false)
+	img := renderDigits(code)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	return &Challenge{
+		Type:     "image",
+		Question: "Type the digits shown in the picture",
+		Image:    "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, code, nil
+}
+
+func (Image) Check(id, answer, response string) bool {
+	return checkText(answer, response)
+}
+
+func randomColor(lo, hi int) color.RGBA {
+	c := func() uint8 { return uint8(lo + rand.IntN(hi-lo)) }
+	return color.RGBA{c(), c(), c(), 255}
+}
+
+// renderDigits draws code and distorts it.
+func renderDigits(code string) *image.RGBA {
+	width := 2*imageMargin + len(code)*imageGlyphWidth
+	bounds := image.Rect(0, 0, width, imageHeight)
+
+	text := image.NewRGBA(bounds)
+	for n, digit := range code {
+		glyph := digitFont[digit-'0']
+		ink := randomColor(20, 140)
+		x0 := imageMargin + n*imageGlyphWidth + rand.IntN(8)
+		y0 := (imageHeight-7*imageCellSize)/2 + rand.IntN(13) - 6
+		slant := rand.Float64()*0.6 - 0.3
+		for row, line := range glyph {
+			for col, dot := range line {
+				if dot != '#' {
+					continue
+				}
+				x := x0 + col*imageCellSize + int(slant*float64((3-row)*imageCellSize))
+				y := y0 + row*imageCellSize
+				size := imageCellSize + rand.IntN(2)
+				for dy := 0; dy < size; dy++ {
+					for dx := 0; dx < size; dx++ {
+						text.SetRGBA(x+dx, y+dy, ink)
+					}
+				}
+			}
+		}
+	}
+
+	// Warp the text with two sine waves over a noisy background.
+	img := image.NewRGBA(bounds)
+	ampX, periodX := 2+rand.Float64()*3, 8+rand.Float64()*8
+	ampY, periodY := 2+rand.Float64()*4, 20+rand.Float64()*20
+	phase := rand.Float64() * 2 * math.Pi
+	for y := 0; y < imageHeight; y++ {
+		for x := 0; x < width; x++ {
+			sx := x + int(ampX*math.Sin(float64(y)/periodX+phase))
+			sy := y + int(ampY*math.Sin(float64(x)/periodY+phase))
+			if c := text.RGBAAt(sx, sy); c.A != 0 {
+				img.SetRGBA(x, y, c)
+			} else {
+				img.SetRGBA(x, y, randomColor(200, 256))
+			}
+		}
+	}
+
+	for n := 0; n < 5+rand.IntN(4); n++ {
+		drawLine(img, rand.IntN(width), rand.IntN(imageHeight), rand.IntN(width), rand.IntN(imageHeight), randomColor(40, 180))
+	}
+	for n := 0; n < width*imageHeight/25; n++ {
+		img.SetRGBA(rand.IntN(width), rand.IntN(imageHeight), randomColor(0, 256))
+	}
+	return img
+}
+
+// drawLine draws a two-pixel-thick line with Bresenham's algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	for e := dx + dy; ; {
+		img.SetRGBA(x0, y0, c)
+		img.SetRGBA(x0, y0+1, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,70 @@
+package captcha
+
+import (
+	"crypto/sha256"
+	"math/bits"
+	"strconv"
+)
+
+// maxCounterLength bounds the counter a client may send for a proof of
+// work, so checking one stays a single short hash.
+const maxCounterLength = 20
+
+// ProofOfWork is a hashcash-style challenge solved by the browser without
+// the user's help: it has to find a counter such that
+// SHA-256(id + ":" + counter) starts with Difficulty zero bits. That takes
+// about 2^Difficulty hashes to find and one to check, which makes
+// registering in bulk expensive without asking people anything.
+type ProofOfWork struct {
+	// Difficulty is the number of leading zero bits; zero means 18.
+	Difficulty int
+}
+
+func (p ProofOfWork) difficulty() int {
+	if p.Difficulty <= 0 {
+		return 18
+	}
+	return p.Difficulty
+}
+
+// The nonce is the captcha ID itself, so a solution cannot be reused for
+// another captcha; the stored answer is the difficulty asked for.
+func (p ProofOfWork) Generate(id string) (*Challenge, string, error) {
+	return &Challenge{
+		Type:       "pow",
+		Question:   "Checking that you are not a robot",
+		Nonce:      id,
+		Difficulty: p.difficulty(),
+	}, strconv.Itoa(p.difficulty()), nil
+}
+
+func (ProofOfWork) Check(id, answer, response string) bool {
+	difficulty, err := strconv.Atoi(answer)
+	if err != nil || difficulty <= 0 || response == "" || len(response) > maxCounterLength {
+		return false
+	}
+	for _, c := range response {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return leadingZeroBits(sha256.Sum256([]byte(id+":"+response))) >= difficulty
+}
+
+// ClaimedAnswer is the difficulty asked for, which a Signed captcha keeps
+// only as a hash.
+func (p ProofOfWork) ClaimedAnswer(response string) string {
+	return strconv.Itoa(p.difficulty())
+}
+
+// leadingZeroBits counts the zero bits at the start of a hash.
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,149 @@
+package captcha
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxTokenLength bounds the captcha IDs Signed will parse.
+	maxTokenLength = 256
+	// answerHashSize is how many bytes of the answer HMAC a token carries.
+	answerHashSize = 16
+	// replaySweepInterval is how often MemoryReplay forgets expired nonces.
+	replaySweepInterval = time.Minute
+)
+
+// Signed is an Issuer that keeps nothing per issued captcha. The captcha ID
+// is a token "nonce.expiry.answer-hash.signature": the answer only as an
+// HMAC under Key, so the client cannot read it, and the whole token signed
+// with Key, so it cannot be altered. Only captchas that are answered are
+// written down, in Replay, to keep each token single-use.
+type Signed struct {
+	// Key must be secret and the same for every instance that checks the
+	// tokens.
+	Key    []byte
+	Replay ReplaySet
+}
+
+// ReplaySet remembers the nonces of answered captchas until they expire.
+// UseCaptchaNonce records nonce and reports false if it was already there.
+// database.Store implements it.
+type ReplaySet interface {
+	UseCaptchaNonce(nonce string, expiresAt time.Time) (bool, error)
+}
+
+// AnswerClaimer is implemented by providers whose stored answer is not
+// what the client sends back. Signed keeps only a hash of the answer, so it
+// asks ClaimedAnswer which answer a response is meant to solve; for other
+// providers that is the response itself, trimmed.
+type AnswerClaimer interface {
+	ClaimedAnswer(response string) string
+}
+
+func (s Signed) Issue(nonce, answer string, expiresAt time.Time) (string, error) {
+	payload := nonce + "." + strconv.FormatInt(expiresAt.Unix(), 10) + "." + encode(s.answerHash(nonce, answer))
+	return payload + "." + encode(s.mac("token", payload)), nil
+}
+
+func (s Signed) Redeem(p Provider, id, response string) error {
+	nonce, expiresAt, answerHash, ok := s.parse(id)
+	if !ok || !expiresAt.After(time.Now()) {
+		return ErrInvalid
+	}
+	fresh, err := s.Replay.UseCaptchaNonce(nonce, expiresAt)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalid
+	}
+
+	answer := strings.TrimSpace(response)
+	if c, ok := p.(AnswerClaimer); ok {
+		answer = c.ClaimedAnswer(response)
+	}
+	if !hmac.Equal(s.answerHash(nonce, answer), answerHash) || !p.Check(nonce, answer, response) {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// parse checks the signature of token and returns its parts.
+func (s Signed) parse(token string) (nonce string, expiresAt time.Time, answerHash []byte, ok bool) {
+	if len(token) > maxTokenLength {
+		return "", time.Time{}, nil, false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 || parts[0] == "" {
+		return "", time.Time{}, nil, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil || !hmac.Equal(signature, s.mac("token", strings.Join(parts[:3], "."))) {
+		return "", time.Time{}, nil, false
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, nil, false
+	}
+	answerHash, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", time.Time{}, nil, false
+	}
+	return parts[0], time.Unix(expiry, 0), answerHash, true
+}
+
+func (s Signed) answerHash(nonce, answer string) []byte {
+	return s.mac("answer", nonce+"\x00"+answer)[:answerHashSize]
+}
+
+// mac is the HMAC-SHA256 of data under Key, separated by purpose so an
+// answer hash can never pass for a signature.
+func (s Signed) mac(purpose, data string) []byte {
+	h := hmac.New(sha256.New, s.Key)
+	h.Write([]byte("captcha-" + purpose + "\x00" + data))
+	return h.Sum(nil)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// MemoryReplay keeps the replay set in this process. Instances behind a
+// load balancer must share one in the database instead, or a token could
+// be answered once at each of them.
+type MemoryReplay struct {
+	mu        sync.Mutex
+	used      map[string]time.Time // expiry by nonce
+	lastSweep time.Time
+}
+
+func NewMemoryReplay() *MemoryReplay {
+	return &MemoryReplay{used: make(map[string]time.Time)}
+}
+
+func (m *MemoryReplay) UseCaptchaNonce(nonce string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= replaySweepInterval {
+		for n, expiry := range m.used {
+			if !expiry.After(now) {
+				delete(m.used, n)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	if _, used := m.used[nonce]; used {
+		return false, nil
+	}
+	m.used[nonce] = expiresAt
+	return true, nil
+}
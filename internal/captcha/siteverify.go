@@ -0,0 +1,137 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxSiteverifyResponse bounds the siteverify answer read into memory.
+const maxSiteverifyResponse = 64 << 10
+
+// Siteverify endpoints of the supported widgets, by Type.
+var siteverifyURLs = map[string]string{
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+}
+
+// Siteverify relies on a third-party widget: Cloudflare Turnstile, hCaptcha
+// or Google reCAPTCHA v2. The browser solves the vendor's challenge and
+// sends back the token the widget gave it, which is checked against the
+// vendor's siteverify endpoint. Since the vendor keeps the challenge and its
+// answer, Siteverify is also its own Issuer and stores nothing.
+type Siteverify struct {
+	// Type is "turnstile", "hcaptcha" or "recaptcha". It tells the client
+	// which widget to load and picks the default URL.
+	Type    string
+	SiteKey string
+	Secret  string
+	// URL is the siteverify endpoint; empty means the vendor's.
+	URL string
+	// Hostnames, if set, are the only sites whose widget tokens are
+	// accepted, so a token solved on another site that uses the same keys
+	// does not pass.
+	Hostnames []string
+	// Timeout bounds one verification; zero means 5 seconds.
+	Timeout    time.Duration
+	HTTPClient *http.Client
+}
+
+// SupportsSiteverify reports whether typ is a widget Siteverify knows.
+func SupportsSiteverify(typ string) bool {
+	_, ok := siteverifyURLs[typ]
+	return ok
+}
+
+func (s Siteverify) Generate(id string) (*Challenge, string, error) {
+	return &Challenge{
+		Type:     s.Type,
+		Question: "Confirm that you are not a robot",
+		SiteKey:  s.SiteKey,
+	}, "", nil
+}
+
+func (s Siteverify) Check(id, answer, response string) bool {
+	return s.verify(response) == nil
+}
+
+// Issue returns the nonce as the captcha ID; the widget token sent with it
+// is all that is checked.
+func (s Siteverify) Issue(nonce, answer string, expiresAt time.Time) (string, error) {
+	return nonce, nil
+}
+
+// Redeem checks the widget token response with the vendor, whatever p is.
+// The vendor accepts each token only once.
+func (s Siteverify) Redeem(p Provider, id, response string) error {
+	return s.verify(response)
+}
+
+// verify returns nil if the vendor accepts token, ErrInvalid if it rejects
+// it, and another error if it could not be asked.
+func (s Siteverify) verify(token string) error {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return ErrInvalid
+	}
+
+	endpoint := s.URL
+	if endpoint == "" {
+		endpoint = siteverifyURLs[s.Type]
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	form := url.Values{"secret": {s.Secret}, "response": {token}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha: siteverify request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha: siteverify returned %s", resp.Status)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		Hostname   string   `json:"hostname"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxSiteverifyResponse)).Decode(&result); err != nil {
+		return fmt.Errorf("captcha: invalid siteverify response: %w", err)
+	}
+	if !result.Success {
+		// A wrong secret is a configuration error, not a wrong answer.
+		for _, code := range result.ErrorCodes {
+			if strings.Contains(code, "secret") {
+				return fmt.Errorf("captcha: siteverify rejected the secret: %s", strings.Join(result.ErrorCodes, ", "))
+			}
+		}
+		return ErrInvalid
+	}
+	if len(s.Hostnames) > 0 && !slices.Contains(s.Hostnames, result.Hostname) {
+		return ErrInvalid
+	}
+	return nil
+}
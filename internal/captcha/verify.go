@@ -0,0 +1,66 @@
+package captcha
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+	"web-app/internal/models"
+)
+
+// ErrInvalid is returned by Verify and Issuer.Redeem for a wrong answer and
+// for a captcha that is unknown, expired or already used. Callers should
+// not tell these apart to the client.
+var ErrInvalid = errors.New("captcha: invalid or expired")
+
+// Issuer binds issued captchas to their answers and lets each of them be
+// answered once.
+type Issuer interface {
+	// Issue returns the captcha ID to hand to the client for a challenge
+	// that was made for nonce and has answer.
+	Issue(nonce, answer string, expiresAt time.Time) (string, error)
+	// Redeem uses up captcha id and checks response against it with p,
+	// which must be the provider that made the challenge.
+	Redeem(p Provider, id, response string) error
+}
+
+// Store holds the answers of issued captchas. ConsumeCaptcha returns the
+// answer and removes the captcha in one step, or sql.ErrNoRows if it is
+// unknown or expired. database.Store implements it.
+type Store interface {
+	CreateCaptcha(captcha *models.Captcha) error
+	ConsumeCaptcha(id string) (string, error)
+}
+
+// Stored is an Issuer that keeps every captcha in a Store until it is
+// answered or expires. The captcha ID is the nonce.
+type Stored struct {
+	Store Store
+}
+
+func (s Stored) Issue(nonce, answer string, expiresAt time.Time) (string, error) {
+	return nonce, s.Store.CreateCaptcha(&models.Captcha{ID: nonce, Answer: answer, ExpiresAt: expiresAt})
+}
+
+func (s Stored) Redeem(p Provider, id, response string) error {
+	return Verify(s.Store, p, id, response)
+}
+
+// Verify uses up captcha id and checks response against it with p. The
+// captcha is gone afterwards whether the answer was right or not, so a
+// solved captcha cannot be replayed and a wrong one cannot be retried.
+func Verify(store Store, p Provider, id, response string) error {
+	if id == "" {
+		return ErrInvalid
+	}
+	answer, err := store.ConsumeCaptcha(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if !p.Check(id, answer, response) {
+		return ErrInvalid
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+	"web-app/internal/models"
+)
+
+func (db *DB) CreateCaptcha(captcha *models.Captcha) error {
+	query := "INSERT INTO captchas (id, answer, expires_at) VALUES (?, ?, ?)"
+	_, err := db.Exec(query, captcha.ID, captcha.Answer, captcha.ExpiresAt.UTC())
+	return err
+}
+
+// captchaAnswer looks the answer up without using the captcha; callers
+// outside this package only ever get it through ConsumeCaptcha.
+func (db *DB) captchaAnswer(id string) (string, error) {
+	var answer string
+	query := "SELECT answer FROM captchas WHERE id = ? AND expires_at > ?"
+	err := db.QueryRow(query, id, now()).Scan(&answer)
+	return answer, err
+}
+
+// ConsumeCaptcha deletes an unexpired captcha and returns its answer. Of
+// concurrent calls for the same ID only the one whose DELETE removed the
+// row gets the answer; the others see sql.ErrNoRows.
+func (db *DB) ConsumeCaptcha(id string) (string, error) {
+	answer, err := db.captchaAnswer(id)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := db.Exec("DELETE FROM captchas WHERE id = ?", id)
+	if err != nil {
+		return "", err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", sql.ErrNoRows
+	}
+	return answer, nil
+}
+
+// UseCaptchaNonce records the nonce of an answered signed captcha and
+// reports false if it was recorded before.
+func (db *DB) UseCaptchaNonce(nonce string, expiresAt time.Time) (bool, error) {
+	_, err := db.Exec("INSERT INTO captcha_replays (nonce, expires_at) VALUES (?, ?)", nonce, expiresAt.UTC())
+	if err == nil {
+		return true, nil
+	}
+	if db.Dialect.isDuplicateKey(err) {
+		return false, nil
+	}
+	return false, err
+}
@@ -3,15 +3,29 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"web-app/internal/passhash"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 type DB struct {
 	*sql.DB
+	Dialect Dialect
+
+	// TokenKey keys the HMAC under which session tokens are stored.
+	TokenKey []byte
+	// Passwords hashes user passwords; nil means passhash.Default.
+	Passwords passhash.Hasher
 }
 
 func InitDB(driver, dsn string) (*DB, error) {
+	dialect, err := dialectForDriver(driver)
+	if err != nil {
+		return nil, err
+	}
+
 	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -21,9 +35,47 @@ func InitDB(driver, dsn string) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &DB{db}, nil
+	customDB := &DB{DB: db, Dialect: dialect}
+	if dialect == SQLite {
+		if err := customDB.initSQLite(); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return customDB, nil
 }
 
 func (db *DB) Close() error {
 	return db.DB.Close()
 }
+
+// Exec, Query and QueryRow accept "?" placeholders for every dialect and
+// rewrite them where the driver expects something else.
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.DB.Exec(db.Dialect.rebind(query), args...)
+}
+
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.DB.Query(db.Dialect.rebind(query), args...)
+}
+
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	return db.DB.QueryRow(db.Dialect.rebind(query), args...)
+}
+
+// insertID runs an INSERT and returns the generated "id" column. PostgreSQL
+// drivers do not implement LastInsertId, so it uses RETURNING there instead.
+func (db *DB) insertID(query string, args ...any) (int64, error) {
+	if db.Dialect == Postgres {
+		var id int64
+		err := db.QueryRow(query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
@@ -1,13 +1,12 @@
 package database
 
 import (
-	"database/sql"
 	"os"
 	"testing"
+	"time"
 
 	"web-app/internal/models"
 
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
 )
 
@@ -23,49 +22,39 @@ func NewTestDB(t *testing.T) *DB {
 		t.Fatal("TEST_DB_DSN not set in .env file")
 	}
 
-	db, err := sql.Open("mysql", testDSN)
+	db, err := InitDB("mysql", testDSN)
 	if err != nil {
 		t.Fatalf("Failed to connect to test database: %v", err)
 	}
 
-	_, err = db.Exec("drop tables if exists users, sessions, captchas")
-	if err != nil {
-		t.Fatalf("Failed to drop tables: %v", err)
-	}
-
-	createTables(db, t)
+	resetSchema(db, t)
 
-	return &DB{DB: db}
+	return db
 }
 
-func createTables(db *sql.DB, t *testing.T) {
-	queries := []string{
-		`CREATE TABLE users (
-			id INT AUTO_INCREMENT PRIMARY KEY,
-			first_name VARCHAR(255) NOT NULL,
-			last_name VARCHAR(255) NOT NULL,
-			email VARCHAR(255) NOT NULL UNIQUE,
-			password_hash VARCHAR(255) NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-			)`,
-		`CREATE TABLE sessions (
-			session_token VARCHAR(255) PRIMARY KEY,
-			user_id INT NOT NULL,
-			expires_at TIMESTAMP NOT NULL
-			)`,
-		`CREATE TABLE captchas (
-			id VARCHAR(255) PRIMARY KEY,
-			answer VARCHAR(255) NOT NULL,
-			expires_at TIMESTAMP NOT NULL
-			)`,
+// resetSchema rolls back every applied migration, drops tables left over from
+// before migrations existed and then builds the schema from the migrations,
+// exactly as production does.
+func resetSchema(db *DB, t *testing.T) {
+	for {
+		rolledBack, err := db.MigrateDown()
+		if err != nil {
+			t.Fatalf("Failed to roll back migrations: %v", err)
+		}
+		if !rolledBack {
+			break
+		}
 	}
 
-	for _, query := range queries {
-		if _, err := db.Exec(query); err != nil {
-			t.Fatalf("Failed to create tables: %v", err)
+	for _, table := range []string{"sessions", "captchas", "users"} {
+		if _, err := db.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+			t.Fatalf("Failed to drop tables: %v", err)
 		}
 	}
 
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
 }
 
 func (db *DB) SeedUser(t *testing.T, user *models.User) int64 {
@@ -77,8 +66,22 @@ func (db *DB) SeedUser(t *testing.T, user *models.User) int64 {
 }
 
 func (db *DB) SeedCaptcha(t *testing.T, id, answer string) {
-	_, err := db.Exec("INSERT INTO captchas (id, answer, expires_at) VALUES (?, ?, NOW() + INTERVAL 5 MINUTE)",
-		id, answer)
+	err := db.CreateCaptcha(&models.Captcha{ID: id, Answer: answer, ExpiresAt: time.Now().Add(5 * time.Minute)})
+	if err != nil {
+		t.Fatalf("failed to seed captcha: %v", err)
+	}
+}
+
+func (m *MemoryStore) SeedUser(t *testing.T, user *models.User) int64 {
+	id, err := m.CreateUser(user)
+	if err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+	return id
+}
+
+func (m *MemoryStore) SeedCaptcha(t *testing.T, id, answer string) {
+	err := m.CreateCaptcha(&models.Captcha{ID: id, Answer: answer, ExpiresAt: time.Now().Add(5 * time.Minute)})
 	if err != nil {
 		t.Fatalf("failed to seed captcha: %v", err)
 	}
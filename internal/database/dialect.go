@@ -0,0 +1,114 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Dialect identifies the SQL flavour behind a DB. The zero value is MySQL so
+// a bare &DB{DB: conn} keeps working for the original backend.
+type Dialect int
+
+const (
+	MySQL Dialect = iota
+	SQLite
+	Postgres
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case SQLite:
+		return "sqlite"
+	case Postgres:
+		return "postgres"
+	default:
+		return "mysql"
+	}
+}
+
+// dialectForDriver maps a database/sql driver name to its dialect.
+func dialectForDriver(driver string) (Dialect, error) {
+	switch driver {
+	case "mysql":
+		return MySQL, nil
+	case "sqlite3", "sqlite":
+		return SQLite, nil
+	case "postgres", "postgresql":
+		return Postgres, nil
+	default:
+		return 0, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// DriverFromDSN picks the driver for a DSN when none is configured explicitly.
+// "postgres://..." and "postgresql://..." select PostgreSQL, "sqlite://app.db",
+// "sqlite:app.db" and "file:app.db" select SQLite; anything else is treated as
+// a MySQL DSN. The returned DSN is what the driver expects.
+func DriverFromDSN(dsn string) (driver, driverDSN string) {
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return "postgres", dsn
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return "sqlite3", strings.TrimPrefix(dsn, "sqlite://")
+	case strings.HasPrefix(dsn, "sqlite:"):
+		return "sqlite3", strings.TrimPrefix(dsn, "sqlite:")
+	case strings.HasPrefix(dsn, "file:"):
+		return "sqlite3", dsn
+	default:
+		return "mysql", dsn
+	}
+}
+
+// emailEquals is the condition that matches users.email to a parameter
+// without regard to letter case. MySQL's default collation and SQLite's
+// NOCASE already ignore case, and comparing the bare column keeps their
+// index usable; PostgreSQL compares lower() against the unique index on
+// lower(email).
+func (d Dialect) emailEquals() string {
+	if d == Postgres {
+		return "lower(email) = lower(?)"
+	}
+	return "email = ?"
+}
+
+func (d Dialect) isDuplicateKey(err error) bool {
+	switch d {
+	case SQLite:
+		return isSQLiteUniqueViolation(err)
+	case Postgres:
+		return isPostgresUniqueViolation(err)
+	default:
+		var mysqlErr *mysql.MySQLError
+		return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+	}
+}
+
+func (d Dialect) isMissingTable(err error) bool {
+	switch d {
+	case SQLite:
+		return isSQLiteMissingTable(err)
+	case Postgres:
+		return isPostgresMissingTable(err)
+	default:
+		var mysqlErr *mysql.MySQLError
+		return errors.As(err, &mysqlErr) && mysqlErr.Number == 1146
+	}
+}
+
+func (d Dialect) rebind(query string) string {
+	if d == Postgres {
+		return rebindPostgres(query)
+	}
+	return query
+}
+
+// now is the reference time for every expiry comparison. Timestamps are
+// written and compared in UTC from Go rather than with NOW(), so all
+// dialects agree on what "expired" means.
+func now() time.Time {
+	return time.Now().UTC()
+}
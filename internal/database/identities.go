@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"web-app/internal/models"
+)
+
+// ErrIdentityLinked means the external account is already linked to a user,
+// or the user already has an account linked at that provider.
+var ErrIdentityLinked = errors.New("external identity already linked")
+
+func (db *DB) CreateIdentity(identity *models.Identity) error {
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = now()
+	}
+	query := "INSERT INTO user_identities (provider, subject, user_id, email, created_at) VALUES (?, ?, ?, ?, ?)"
+	_, err := db.Exec(query, identity.Provider, identity.Subject, identity.UserID, identity.Email, identity.CreatedAt.UTC())
+	if err != nil && db.Dialect.isDuplicateKey(err) {
+		return fmt.Errorf("%w", ErrIdentityLinked)
+	}
+	return err
+}
+
+func (db *DB) GetIdentity(provider, subject string) (*models.Identity, error) {
+	i := models.Identity{Provider: provider, Subject: subject}
+	err := db.QueryRow("SELECT user_id, email, created_at FROM user_identities WHERE provider = ? AND subject = ?", provider, subject).
+		Scan(&i.UserID, &i.Email, &i.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+func (db *DB) ListUserIdentities(userID int) ([]models.Identity, error) {
+	rows, err := db.Query("SELECT provider, subject, email, created_at FROM user_identities WHERE user_id = ? ORDER BY provider", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []models.Identity
+	for rows.Next() {
+		i := models.Identity{UserID: userID}
+		if err := rows.Scan(&i.Provider, &i.Subject, &i.Email, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+func (db *DB) DeleteUserIdentity(userID int, provider string) (bool, error) {
+	result, err := db.Exec("DELETE FROM user_identities WHERE user_id = ? AND provider = ?", userID, provider)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (db *DB) CreateOIDCLogin(login *models.OIDCLogin) error {
+	linkUserID := sql.NullInt64{Int64: int64(login.LinkUserID), Valid: login.LinkUserID != 0}
+	query := "INSERT INTO oidc_logins (state_hash, provider, nonce, code_verifier, persistent, link_user_id, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	_, err := db.Exec(query, db.hashToken(login.State), login.Provider, login.Nonce, login.CodeVerifier, login.Persistent,
+		linkUserID, login.ExpiresAt.UTC())
+	return err
+}
+
+// ConsumeOIDCLogin returns the unexpired login started with state and
+// deletes it, so every state value is accepted at most once.
+func (db *DB) ConsumeOIDCLogin(state string) (*models.OIDCLogin, error) {
+	stateHash := db.hashToken(state)
+	l := models.OIDCLogin{State: state}
+	var linkUserID sql.NullInt64
+	err := db.QueryRow("SELECT provider, nonce, code_verifier, persistent, link_user_id, expires_at FROM oidc_logins WHERE state_hash = ? AND expires_at > ?",
+		stateHash, now()).Scan(&l.Provider, &l.Nonce, &l.CodeVerifier, &l.Persistent, &linkUserID, &l.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.Exec("DELETE FROM oidc_logins WHERE state_hash = ?", stateHash)
+	if err != nil {
+		return nil, err
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if deleted == 0 {
+		return nil, sql.ErrNoRows
+	}
+	l.LinkUserID = int(linkUserID.Int64)
+	return &l, nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+	"web-app/internal/models"
+)
+
+// GetLoginThrottle returns the unexpired failure counter of a subject.
+func (db *DB) GetLoginThrottle(kind, subject string) (*models.LoginThrottle, error) {
+	t := models.LoginThrottle{Kind: kind, Subject: subject}
+	var lockedUntil sql.NullTime
+	err := db.QueryRow("SELECT failures, last_failed_at, locked_until, expires_at FROM login_throttles WHERE kind = ? AND subject = ? AND expires_at > ?",
+		kind, subject, now()).Scan(&t.Failures, &t.LastFailedAt, &lockedUntil, &t.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		t.LockedUntil = &lockedUntil.Time
+	}
+	return &t, nil
+}
+
+// RecordLoginFailure adds a failure to the subject's counter and keeps the
+// counter for window after it. An expired counter starts over at one. The
+// increment happens in the UPDATE itself, so concurrent failures are all
+// counted.
+func (db *DB) RecordLoginFailure(kind, subject string, window time.Duration) (*models.LoginThrottle, error) {
+	at := now()
+	expiresAt := at.Add(window)
+	for attempt := 0; ; attempt++ {
+		query := "UPDATE login_throttles SET failures = CASE WHEN expires_at > ? THEN failures + 1 ELSE 1 END, " +
+			"locked_until = CASE WHEN expires_at > ? THEN locked_until ELSE NULL END, " +
+			"expires_at = CASE WHEN expires_at > ? AND locked_until IS NOT NULL THEN expires_at ELSE ? END, " +
+			"last_failed_at = ? WHERE kind = ? AND subject = ?"
+		result, err := db.Exec(query, at, at, at, expiresAt, at, kind, subject)
+		if err != nil {
+			return nil, err
+		}
+		if updated, err := result.RowsAffected(); err != nil {
+			return nil, err
+		} else if updated > 0 {
+			break
+		}
+
+		_, err = db.Exec("INSERT INTO login_throttles (kind, subject, failures, last_failed_at, expires_at) VALUES (?, ?, 1, ?, ?)",
+			kind, subject, at, expiresAt)
+		if err == nil {
+			break
+		}
+		// Another failure created the row first; count this one on top.
+		if !db.Dialect.isDuplicateKey(err) || attempt > 0 {
+			return nil, err
+		}
+	}
+	return db.GetLoginThrottle(kind, subject)
+}
+
+// LockLogin locks the subject out until until. The counter is kept as long
+// as the lock.
+func (db *DB) LockLogin(kind, subject string, until time.Time) error {
+	_, err := db.Exec("UPDATE login_throttles SET locked_until = ?, expires_at = ? WHERE kind = ? AND subject = ?",
+		until.UTC(), until.UTC(), kind, subject)
+	return err
+}
+
+// ClearLoginThrottle forgets the failures and any lock of the subject. It
+// reports whether there was anything to clear.
+func (db *DB) ClearLoginThrottle(kind, subject string) (bool, error) {
+	result, err := db.Exec("DELETE FROM login_throttles WHERE kind = ? AND subject = ? AND expires_at > ?", kind, subject, now())
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
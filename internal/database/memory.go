@@ -0,0 +1,1133 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"web-app/internal/models"
+	"web-app/internal/passhash"
+	"web-app/internal/ratelimit"
+	"web-app/internal/utils"
+)
+
+// MemoryStore keeps users, sessions, captchas, user tokens, two-factor
+// state, passkeys, external identities, OAuth clients and grants, failed
+// login counters and rate limit buckets in process memory. It is meant for
+// tests and local experiments: nothing survives a restart and the data is
+// not shared between instances.
+type MemoryStore struct {
+	// TokenKey keys the HMAC under which session tokens are stored.
+	TokenKey []byte
+	// Passwords hashes user passwords; nil means passhash.Default.
+	Passwords passhash.Hasher
+
+	mu       sync.Mutex
+	nextID   int
+	users    map[int]*memoryUser
+	sessions map[string]*memorySession // keyed by token hash
+	captchas map[string]*models.Captcha
+	tokens   map[string]*memoryToken // keyed by token hash
+
+	captchaReplays map[string]time.Time // expiry by nonce
+
+	totp          map[int]*models.TOTP
+	recoveryCodes map[int]map[string]bool         // user -> code hash -> used
+	mfaChallenges map[string]*models.MFAChallenge // keyed by token hash
+
+	passkeys           map[string]*models.Passkey           // keyed by public ID
+	webauthnChallenges map[string]*models.WebAuthnChallenge // keyed by challenge hash
+
+	identities map[[2]string]*models.Identity // keyed by provider and subject
+	oidcLogins map[string]*models.OIDCLogin   // keyed by state hash
+
+	oauthClients        map[string]*models.OAuthClient // keyed by client ID
+	oauthConsents       map[oauthConsentKey]*models.OAuthConsent
+	oauthAuthorizations map[string]*models.OAuthAuthorization // keyed by handle hash
+	oauthTokens         map[string]*models.OAuthToken         // keyed by token hash
+
+	loginThrottles map[[2]string]*models.LoginThrottle // keyed by kind and subject
+	rateLimits     map[string]time.Time                // full time by key
+}
+
+type oauthConsentKey struct {
+	userID   int
+	clientID string
+}
+
+type memoryToken struct {
+	models.UserToken
+	bindingHash string
+	used        bool
+}
+
+type memorySession struct {
+	models.Session
+	previousTokenHash string
+}
+
+func (s *memorySession) active(now time.Time) bool {
+	return s.ExpiresAt.After(now) && s.AbsoluteExpiresAt.After(now)
+}
+
+type memoryUser struct {
+	user         models.User
+	passwordHash string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:    make(map[int]*memoryUser),
+		sessions: make(map[string]*memorySession),
+		captchas: make(map[string]*models.Captcha),
+		tokens:   make(map[string]*memoryToken),
+
+		captchaReplays: make(map[string]time.Time),
+
+		totp:          make(map[int]*models.TOTP),
+		recoveryCodes: make(map[int]map[string]bool),
+		mfaChallenges: make(map[string]*models.MFAChallenge),
+
+		passkeys:           make(map[string]*models.Passkey),
+		webauthnChallenges: make(map[string]*models.WebAuthnChallenge),
+
+		identities: make(map[[2]string]*models.Identity),
+		oidcLogins: make(map[string]*models.OIDCLogin),
+
+		oauthClients:        make(map[string]*models.OAuthClient),
+		oauthConsents:       make(map[oauthConsentKey]*models.OAuthConsent),
+		oauthAuthorizations: make(map[string]*models.OAuthAuthorization),
+		oauthTokens:         make(map[string]*models.OAuthToken),
+
+		loginThrottles: make(map[[2]string]*models.LoginThrottle),
+		rateLimits:     make(map[string]time.Time),
+	}
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+func (m *MemoryStore) findUserByEmail(email string) *memoryUser {
+	for _, u := range m.users {
+		if strings.EqualFold(u.user.Email, email) {
+			return u
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateUser(user *models.User) (int64, error) {
+	hashedPass, err := hashPassword(m.Passwords, user.Password)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findUserByEmail(user.Email) != nil {
+		return 0, fmt.Errorf("%w", ErrEmailAlreadyRegistered)
+	}
+
+	m.nextID++
+	now := time.Now()
+	m.users[m.nextID] = &memoryUser{
+		user: models.User{
+			ID:        m.nextID,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Email:     user.Email,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		passwordHash: hashedPass,
+	}
+	return int64(m.nextID), nil
+}
+
+func (m *MemoryStore) EmailExists(email string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.findUserByEmail(email) != nil, nil
+}
+
+func (m *MemoryStore) Authenticate(email, password string) (int, error) {
+	m.mu.Lock()
+	u := m.findUserByEmail(email)
+	var hash string
+	if u != nil {
+		hash = u.passwordHash
+	}
+	m.mu.Unlock()
+	if u == nil {
+		return 0, sql.ErrNoRows
+	}
+
+	if err := checkPassword(m.Passwords, hash, password); err != nil {
+		return 0, err
+	}
+
+	if passwordHasher(m.Passwords).NeedsRehash(hash) {
+		if rehashed, err := hashPassword(m.Passwords, password); err != nil {
+			log.Printf("Failed to rehash password of user %d: %v", u.user.ID, err)
+		} else {
+			m.mu.Lock()
+			if u.passwordHash == hash {
+				u.passwordHash = rehashed
+			}
+			m.mu.Unlock()
+		}
+	}
+	return u.user.ID, nil
+}
+
+func (m *MemoryStore) GetUserByID(userID int) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	user := u.user
+	return &user, nil
+}
+
+func (m *MemoryStore) GetUserByEmail(email string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.findUserByEmail(email)
+	if u == nil {
+		return nil, sql.ErrNoRows
+	}
+	user := u.user
+	return &user, nil
+}
+
+func (m *MemoryStore) UpdateUser(userID int, firstName, lastName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u, ok := m.users[userID]; ok {
+		u.user.FirstName = firstName
+		u.user.LastName = lastName
+		u.user.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (m *MemoryStore) VerifyPassword(userID int, password string) error {
+	m.mu.Lock()
+	u, ok := m.users[userID]
+	var hash string
+	if ok {
+		hash = u.passwordHash
+	}
+	m.mu.Unlock()
+	if !ok {
+		return sql.ErrNoRows
+	}
+	return checkPassword(m.Passwords, hash, password)
+}
+
+func (m *MemoryStore) UpdatePassword(userID int, password string) error {
+	hashedPass, err := hashPassword(m.Passwords, password)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u, ok := m.users[userID]; ok {
+		u.passwordHash = hashedPass
+		u.user.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (m *MemoryStore) MarkEmailVerified(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u, ok := m.users[userID]; ok && !u.user.EmailVerified {
+		u.user.EmailVerified = true
+		u.user.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateSession(session *models.Session) error {
+	if err := prepareSession(session); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokenHash := utils.HashToken(m.TokenKey, session.Token)
+	if _, exists := m.sessions[tokenHash]; exists {
+		return fmt.Errorf("session token already exists")
+	}
+	s := &memorySession{Session: *session}
+	s.Token = ""
+	m.sessions[tokenHash] = s
+	return nil
+}
+
+func (m *MemoryStore) GetSessionByToken(token string) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	tokenHash := utils.HashToken(m.TokenKey, token)
+	s, ok := m.sessions[tokenHash]
+	if !ok {
+		for _, candidate := range m.sessions {
+			if candidate.previousTokenHash == tokenHash && candidate.TokenIssuedAt.After(now.Add(-rotationGracePeriod)) {
+				s, ok = candidate, true
+				break
+			}
+		}
+	}
+	if !ok || !s.active(now) {
+		return nil, sql.ErrNoRows
+	}
+	session := s.Session
+	return &session, nil
+}
+
+func (m *MemoryStore) ListUserSessions(userID int) ([]models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var sessions []models.Session
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.active(now) {
+			sessions = append(sessions, s.Session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (m *MemoryStore) RenewSession(id string, lastSeen, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sessions {
+		if s.ID == id {
+			s.LastSeenAt = lastSeen
+			s.ExpiresAt = expiresAt
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) RotateSessionToken(id, token string, issuedAt time.Time, keepPrevious bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, s := range m.sessions {
+		if s.ID != id {
+			continue
+		}
+		s.previousTokenHash = ""
+		if keepPrevious {
+			s.previousTokenHash = key
+		}
+		s.TokenIssuedAt = issuedAt
+		delete(m.sessions, key)
+		m.sessions[utils.HashToken(m.TokenKey, token)] = s
+		return nil
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteSession(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, utils.HashToken(m.TokenKey, token))
+	return nil
+}
+
+func (m *MemoryStore) DeleteUserSession(userID int, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, s := range m.sessions {
+		if s.UserID == userID && s.ID == id {
+			delete(m.sessions, key)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) DeleteUserSessions(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, s := range m.sessions {
+		if s.UserID == userID {
+			delete(m.sessions, key)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteOtherUserSessions(userID int, keepID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, s := range m.sessions {
+		if s.UserID == userID && s.ID != keepID {
+			delete(m.sessions, key)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateCaptcha(captcha *models.Captcha) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := *captcha
+	m.captchas[captcha.ID] = &c
+	return nil
+}
+
+func (m *MemoryStore) ConsumeCaptcha(id string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.captchas[id]
+	if !ok || !c.ExpiresAt.After(time.Now()) {
+		return "", sql.ErrNoRows
+	}
+	delete(m.captchas, id)
+	return c.Answer, nil
+}
+
+func (m *MemoryStore) UseCaptchaNonce(nonce string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, used := m.captchaReplays[nonce]; used {
+		return false, nil
+	}
+	m.captchaReplays[nonce] = expiresAt
+	return true, nil
+}
+
+func (m *MemoryStore) CreateUserToken(token *models.UserToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	t := &memoryToken{UserToken: *token}
+	t.Token, t.Binding = "", ""
+	if token.Binding != "" {
+		t.bindingHash = utils.HashToken(m.TokenKey, token.Binding)
+	}
+	m.tokens[utils.HashToken(m.TokenKey, token.Token)] = t
+	return nil
+}
+
+func (m *MemoryStore) ConsumeUserToken(purpose, token, binding string) (*models.UserToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bindingHash := ""
+	if binding != "" {
+		bindingHash = utils.HashToken(m.TokenKey, binding)
+	}
+	t, ok := m.tokens[utils.HashToken(m.TokenKey, token)]
+	if !ok || t.used || t.Purpose != purpose || t.bindingHash != bindingHash || !t.ExpiresAt.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	t.used = true
+	consumed := t.UserToken
+	return &consumed, nil
+}
+
+func (m *MemoryStore) DeleteUserTokens(userID int, purpose string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, t := range m.tokens {
+		if t.UserID == userID && t.Purpose == purpose {
+			delete(m.tokens, key)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetTOTP(userID int) (*models.TOTP, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.totp[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	totp := *t
+	return &totp, nil
+}
+
+func (m *MemoryStore) SetTOTPSecret(userID int, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.totp[userID]; ok && t.Confirmed {
+		return fmt.Errorf("%w", ErrTOTPAlreadyEnabled)
+	}
+	m.totp[userID] = &models.TOTP{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (m *MemoryStore) ConfirmTOTP(userID int, counter int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.totp[userID]
+	if !ok || t.Confirmed {
+		return false, nil
+	}
+	t.Confirmed = true
+	t.LastCounter = counter
+	return true, nil
+}
+
+func (m *MemoryStore) UseTOTPCounter(userID int, counter int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.totp[userID]
+	if !ok || !t.Confirmed || t.LastCounter >= counter {
+		return false, nil
+	}
+	t.LastCounter = counter
+	return true, nil
+}
+
+func (m *MemoryStore) DeleteTOTP(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.totp, userID)
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+func (m *MemoryStore) ReplaceRecoveryCodes(userID int, codes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hashes := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		hashes[hashRecoveryCode(code)] = false
+	}
+	m.recoveryCodes[userID] = hashes
+	return nil
+}
+
+func (m *MemoryStore) UseRecoveryCode(userID int, code string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash := hashRecoveryCode(code)
+	used, ok := m.recoveryCodes[userID][hash]
+	if !ok || used {
+		return false, nil
+	}
+	m.recoveryCodes[userID][hash] = true
+	return true, nil
+}
+
+func (m *MemoryStore) CountRecoveryCodes(userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, used := range m.recoveryCodes[userID] {
+		if !used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) CreateMFAChallenge(challenge *models.MFAChallenge) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := *challenge
+	c.Token = ""
+	m.mfaChallenges[utils.HashToken(m.TokenKey, challenge.Token)] = &c
+	return nil
+}
+
+func (m *MemoryStore) GetMFAChallenge(token string) (*models.MFAChallenge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.mfaChallenges[utils.HashToken(m.TokenKey, token)]
+	if !ok || !c.ExpiresAt.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	challenge := *c
+	challenge.Token = token
+	return &challenge, nil
+}
+
+func (m *MemoryStore) RecordMFAFailure(token string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.mfaChallenges[utils.HashToken(m.TokenKey, token)]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	c.Attempts++
+	return c.Attempts, nil
+}
+
+func (m *MemoryStore) DeleteMFAChallenge(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.mfaChallenges, utils.HashToken(m.TokenKey, token))
+	return nil
+}
+
+func copyPasskey(p *models.Passkey) models.Passkey {
+	passkey := *p
+	passkey.CredentialID = append([]byte(nil), p.CredentialID...)
+	passkey.PublicKey = append([]byte(nil), p.PublicKey...)
+	if p.LastUsedAt != nil {
+		lastUsedAt := *p.LastUsedAt
+		passkey.LastUsedAt = &lastUsedAt
+	}
+	return passkey
+}
+
+func (m *MemoryStore) CreatePasskey(passkey *models.Passkey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.passkeys {
+		if bytes.Equal(p.CredentialID, passkey.CredentialID) {
+			return fmt.Errorf("%w", ErrPasskeyExists)
+		}
+	}
+	if err := preparePasskey(passkey); err != nil {
+		return err
+	}
+	p := copyPasskey(passkey)
+	m.passkeys[p.ID] = &p
+	return nil
+}
+
+func (m *MemoryStore) GetPasskeyByCredentialID(credentialID []byte) (*models.Passkey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.passkeys {
+		if bytes.Equal(p.CredentialID, credentialID) {
+			passkey := copyPasskey(p)
+			return &passkey, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemoryStore) ListUserPasskeys(userID int) ([]models.Passkey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var passkeys []models.Passkey
+	for _, p := range m.passkeys {
+		if p.UserID == userID {
+			passkeys = append(passkeys, copyPasskey(p))
+		}
+	}
+	sort.Slice(passkeys, func(i, j int) bool { return passkeys[i].CreatedAt.Before(passkeys[j].CreatedAt) })
+	return passkeys, nil
+}
+
+func (m *MemoryStore) UpdatePasskeyUsage(id string, signCount uint32, usedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if p, ok := m.passkeys[id]; ok {
+		p.SignCount = signCount
+		p.LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteUserPasskey(userID int, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.passkeys[id]
+	if !ok || p.UserID != userID {
+		return false, nil
+	}
+	delete(m.passkeys, id)
+	return true, nil
+}
+
+func (m *MemoryStore) DeleteUserPasskeys(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, p := range m.passkeys {
+		if p.UserID == userID {
+			delete(m.passkeys, id)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) hashChallenge(challenge []byte) string {
+	return utils.HashToken(m.TokenKey, passkeyEncoding.EncodeToString(challenge))
+}
+
+func (m *MemoryStore) CreateWebAuthnChallenge(challenge *models.WebAuthnChallenge) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := *challenge
+	c.Challenge = nil
+	m.webauthnChallenges[m.hashChallenge(challenge.Challenge)] = &c
+	return nil
+}
+
+func (m *MemoryStore) ConsumeWebAuthnChallenge(challenge []byte, ceremony string) (*models.WebAuthnChallenge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := m.hashChallenge(challenge)
+	c, ok := m.webauthnChallenges[key]
+	if !ok || c.Ceremony != ceremony || !c.ExpiresAt.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	delete(m.webauthnChallenges, key)
+	consumed := *c
+	consumed.Challenge = challenge
+	return &consumed, nil
+}
+
+func (m *MemoryStore) CreateIdentity(identity *models.Identity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := [2]string{identity.Provider, identity.Subject}
+	if _, ok := m.identities[key]; ok {
+		return fmt.Errorf("%w", ErrIdentityLinked)
+	}
+	for _, i := range m.identities {
+		if i.UserID == identity.UserID && i.Provider == identity.Provider {
+			return fmt.Errorf("%w", ErrIdentityLinked)
+		}
+	}
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+	i := *identity
+	m.identities[key] = &i
+	return nil
+}
+
+func (m *MemoryStore) GetIdentity(provider, subject string) (*models.Identity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, ok := m.identities[[2]string{provider, subject}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	identity := *i
+	return &identity, nil
+}
+
+func (m *MemoryStore) ListUserIdentities(userID int) ([]models.Identity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var identities []models.Identity
+	for _, i := range m.identities {
+		if i.UserID == userID {
+			identities = append(identities, *i)
+		}
+	}
+	sort.Slice(identities, func(a, b int) bool { return identities[a].Provider < identities[b].Provider })
+	return identities, nil
+}
+
+func (m *MemoryStore) DeleteUserIdentity(userID int, provider string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, i := range m.identities {
+		if i.UserID == userID && i.Provider == provider {
+			delete(m.identities, key)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) CreateOIDCLogin(login *models.OIDCLogin) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := *login
+	l.State = ""
+	m.oidcLogins[utils.HashToken(m.TokenKey, login.State)] = &l
+	return nil
+}
+
+func (m *MemoryStore) ConsumeOIDCLogin(state string) (*models.OIDCLogin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := utils.HashToken(m.TokenKey, state)
+	l, ok := m.oidcLogins[key]
+	if !ok || !l.ExpiresAt.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	delete(m.oidcLogins, key)
+	login := *l
+	login.State = state
+	return &login, nil
+}
+
+func copyOAuthClient(c *models.OAuthClient) *models.OAuthClient {
+	client := *c
+	client.RedirectURIs = append([]string(nil), c.RedirectURIs...)
+	return &client
+}
+
+func (m *MemoryStore) CreateOAuthClient(client *models.OAuthClient, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := prepareOAuthClient(client, secret); err != nil {
+		return err
+	}
+	if _, ok := m.oauthClients[client.ID]; ok {
+		return fmt.Errorf("oauth client %q already exists", client.ID)
+	}
+	m.oauthClients[client.ID] = copyOAuthClient(client)
+	return nil
+}
+
+func (m *MemoryStore) GetOAuthClient(id string) (*models.OAuthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.oauthClients[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyOAuthClient(c), nil
+}
+
+func (m *MemoryStore) AuthenticateOAuthClient(id, secret string) (*models.OAuthClient, error) {
+	client, err := m.GetOAuthClient(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkClientSecret(client, secret); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (m *MemoryStore) ListOAuthClients() ([]models.OAuthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var clients []models.OAuthClient
+	for _, c := range m.oauthClients {
+		clients = append(clients, *copyOAuthClient(c))
+	}
+	sort.Slice(clients, func(a, b int) bool { return clients[a].CreatedAt.Before(clients[b].CreatedAt) })
+	return clients, nil
+}
+
+func (m *MemoryStore) DeleteOAuthClient(id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.oauthClients[id]; !ok {
+		return false, nil
+	}
+	delete(m.oauthClients, id)
+	for key := range m.oauthConsents {
+		if key.clientID == id {
+			delete(m.oauthConsents, key)
+		}
+	}
+	for key, a := range m.oauthAuthorizations {
+		if a.ClientID == id {
+			delete(m.oauthAuthorizations, key)
+		}
+	}
+	for key, t := range m.oauthTokens {
+		if t.ClientID == id {
+			delete(m.oauthTokens, key)
+		}
+	}
+	return true, nil
+}
+
+func (m *MemoryStore) GetOAuthConsent(userID int, clientID string) (*models.OAuthConsent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.oauthConsents[oauthConsentKey{userID, clientID}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	consent := *c
+	return &consent, nil
+}
+
+func (m *MemoryStore) SaveOAuthConsent(consent *models.OAuthConsent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if consent.CreatedAt.IsZero() {
+		consent.CreatedAt = time.Now()
+	}
+	c := *consent
+	m.oauthConsents[oauthConsentKey{consent.UserID, consent.ClientID}] = &c
+	return nil
+}
+
+func (m *MemoryStore) CreateOAuthAuthorization(a *models.OAuthAuthorization) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *a
+	stored.Handle = ""
+	m.oauthAuthorizations[utils.HashToken(m.TokenKey, a.Handle)] = &stored
+	return nil
+}
+
+func (m *MemoryStore) ConsumeOAuthAuthorization(kind, handle string) (*models.OAuthAuthorization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := utils.HashToken(m.TokenKey, handle)
+	a, ok := m.oauthAuthorizations[key]
+	if !ok || a.Kind != kind || !a.ExpiresAt.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	delete(m.oauthAuthorizations, key)
+	consumed := *a
+	consumed.Handle = handle
+	return &consumed, nil
+}
+
+func (m *MemoryStore) CreateOAuthToken(token *models.OAuthToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	t := *token
+	t.Token = ""
+	m.oauthTokens[utils.HashToken(m.TokenKey, token.Token)] = &t
+	return nil
+}
+
+func (m *MemoryStore) GetOAuthToken(kind, token string) (*models.OAuthToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.oauthTokens[utils.HashToken(m.TokenKey, token)]
+	if !ok || t.Kind != kind || !t.ExpiresAt.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	found := *t
+	found.Token = token
+	return &found, nil
+}
+
+func (m *MemoryStore) ConsumeOAuthToken(kind, token string) (*models.OAuthToken, error) {
+	t, err := m.GetOAuthToken(kind, token)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := utils.HashToken(m.TokenKey, token)
+	if _, ok := m.oauthTokens[key]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	delete(m.oauthTokens, key)
+	return t, nil
+}
+
+func (m *MemoryStore) DeleteUserOAuthTokens(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, t := range m.oauthTokens {
+		if t.UserID == userID {
+			delete(m.oauthTokens, key)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetLoginThrottle(kind, subject string) (*models.LoginThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.loginThrottles[[2]string{kind, subject}]
+	if !ok || !t.ExpiresAt.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	throttle := *t
+	return &throttle, nil
+}
+
+func (m *MemoryStore) RecordLoginFailure(kind, subject string, window time.Duration) (*models.LoginThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	key := [2]string{kind, subject}
+	t, ok := m.loginThrottles[key]
+	if !ok || !t.ExpiresAt.After(now) {
+		t = &models.LoginThrottle{Kind: kind, Subject: subject}
+		m.loginThrottles[key] = t
+	}
+	t.Failures++
+	t.LastFailedAt = now
+	if t.LockedUntil == nil {
+		t.ExpiresAt = now.Add(window)
+	}
+	throttle := *t
+	return &throttle, nil
+}
+
+func (m *MemoryStore) LockLogin(kind, subject string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.loginThrottles[[2]string{kind, subject}]; ok {
+		t.LockedUntil = &until
+		t.ExpiresAt = until
+	}
+	return nil
+}
+
+func (m *MemoryStore) ClearLoginThrottle(kind, subject string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := [2]string{kind, subject}
+	t, ok := m.loginThrottles[key]
+	if !ok || !t.ExpiresAt.After(time.Now()) {
+		return false, nil
+	}
+	delete(m.loginThrottles, key)
+	return true, nil
+}
+
+func (m *MemoryStore) TakeRateLimit(key string, rule ratelimit.Rule) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	full, wait := rule.Take(m.rateLimits[key], time.Now())
+	m.rateLimits[key] = full
+	return wait, nil
+}
+
+func (m *MemoryStore) CleanupExpired() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	sessionsDeleted, captchasDeleted, tokensDeleted := 0, 0, 0
+	for key, s := range m.sessions {
+		if !s.active(now) {
+			delete(m.sessions, key)
+			sessionsDeleted++
+		}
+	}
+	for id, c := range m.captchas {
+		if c.ExpiresAt.Before(now) {
+			delete(m.captchas, id)
+			captchasDeleted++
+		}
+	}
+	for key, t := range m.tokens {
+		if t.ExpiresAt.Before(now) {
+			delete(m.tokens, key)
+			tokensDeleted++
+		}
+	}
+	for key, c := range m.mfaChallenges {
+		if c.ExpiresAt.Before(now) {
+			delete(m.mfaChallenges, key)
+		}
+	}
+	for key, c := range m.webauthnChallenges {
+		if c.ExpiresAt.Before(now) {
+			delete(m.webauthnChallenges, key)
+		}
+	}
+	for key, l := range m.oidcLogins {
+		if l.ExpiresAt.Before(now) {
+			delete(m.oidcLogins, key)
+		}
+	}
+	for key, a := range m.oauthAuthorizations {
+		if a.ExpiresAt.Before(now) {
+			delete(m.oauthAuthorizations, key)
+		}
+	}
+	for key, t := range m.oauthTokens {
+		if t.ExpiresAt.Before(now) {
+			delete(m.oauthTokens, key)
+		}
+	}
+	for key, t := range m.loginThrottles {
+		if t.ExpiresAt.Before(now) {
+			delete(m.loginThrottles, key)
+		}
+	}
+	for key, full := range m.rateLimits {
+		if full.Before(now) {
+			delete(m.rateLimits, key)
+		}
+	}
+	for nonce, expiresAt := range m.captchaReplays {
+		if expiresAt.Before(now) {
+			delete(m.captchaReplays, nonce)
+		}
+	}
+	log.Printf("CleanupExpired completed: sessions=%d, captchas=%d, tokens=%d", sessionsDeleted, captchasDeleted, tokensDeleted)
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"web-app/internal/models"
+)
+
+var ErrTOTPAlreadyEnabled = errors.New("two-factor authentication already enabled")
+
+// hashRecoveryCode hashes a recovery code without the token key: the codes
+// must outlive a rotated SESSION_SECRET, and they carry enough entropy that
+// a plain SHA-256 cannot be reversed.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func (db *DB) GetTOTP(userID int) (*models.TOTP, error) {
+	t := models.TOTP{UserID: userID}
+	err := db.QueryRow("SELECT secret, confirmed_at IS NOT NULL, last_counter FROM user_totp WHERE user_id = ?", userID).
+		Scan(&t.Secret, &t.Confirmed, &t.LastCounter)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SetTOTPSecret starts an enrollment, replacing any unconfirmed one. It
+// fails with ErrTOTPAlreadyEnabled while a confirmed enrollment exists.
+func (db *DB) SetTOTPSecret(userID int, secret string) error {
+	if _, err := db.Exec("DELETE FROM user_totp WHERE user_id = ? AND confirmed_at IS NULL", userID); err != nil {
+		return err
+	}
+	_, err := db.Exec("INSERT INTO user_totp (user_id, secret, created_at) VALUES (?, ?, ?)", userID, secret, now())
+	if err != nil && db.Dialect.isDuplicateKey(err) {
+		return fmt.Errorf("%w", ErrTOTPAlreadyEnabled)
+	}
+	return err
+}
+
+// ConfirmTOTP enables a pending enrollment and records counter as used. It
+// returns false when there was nothing to confirm.
+func (db *DB) ConfirmTOTP(userID int, counter int64) (bool, error) {
+	result, err := db.Exec("UPDATE user_totp SET confirmed_at = ?, last_counter = ? WHERE user_id = ? AND confirmed_at IS NULL",
+		now(), counter, userID)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+// UseTOTPCounter records counter as used. It returns false if that time
+// step, or a later one, was already used: the code is a replay.
+func (db *DB) UseTOTPCounter(userID int, counter int64) (bool, error) {
+	result, err := db.Exec("UPDATE user_totp SET last_counter = ? WHERE user_id = ? AND last_counter < ? AND confirmed_at IS NOT NULL",
+		counter, userID, counter)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+// DeleteTOTP turns two-factor authentication off and drops the recovery
+// codes with it.
+func (db *DB) DeleteTOTP(userID int) error {
+	if _, err := db.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	_, err := db.Exec("DELETE FROM user_totp WHERE user_id = ?", userID)
+	return err
+}
+
+// ReplaceRecoveryCodes swaps all recovery codes of userID for codes in one
+// transaction.
+func (db *DB) ReplaceRecoveryCodes(userID int, codes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(db.Dialect.rebind("DELETE FROM recovery_codes WHERE user_id = ?"), userID); err != nil {
+		return err
+	}
+	insert := db.Dialect.rebind("INSERT INTO recovery_codes (code_hash, user_id) VALUES (?, ?)")
+	for _, code := range codes {
+		if _, err := tx.Exec(insert, hashRecoveryCode(code), userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode spends one unused recovery code. It returns false if the
+// code is unknown or was already used.
+func (db *DB) UseRecoveryCode(userID int, code string) (bool, error) {
+	result, err := db.Exec("UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		now(), userID, hashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+	used, err := result.RowsAffected()
+	return used > 0, err
+}
+
+func (db *DB) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+func (db *DB) CreateMFAChallenge(challenge *models.MFAChallenge) error {
+	query := "INSERT INTO mfa_challenges (token_hash, user_id, persistent, expires_at) VALUES (?, ?, ?, ?)"
+	_, err := db.Exec(query, db.hashToken(challenge.Token), challenge.UserID, challenge.Persistent, challenge.ExpiresAt.UTC())
+	return err
+}
+
+func (db *DB) GetMFAChallenge(token string) (*models.MFAChallenge, error) {
+	c := models.MFAChallenge{Token: token}
+	err := db.QueryRow("SELECT user_id, persistent, attempts, expires_at FROM mfa_challenges WHERE token_hash = ? AND expires_at > ?",
+		db.hashToken(token), now()).Scan(&c.UserID, &c.Persistent, &c.Attempts, &c.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// RecordMFAFailure counts a wrong code against the challenge and returns the
+// new number of failed attempts.
+func (db *DB) RecordMFAFailure(token string) (int, error) {
+	tokenHash := db.hashToken(token)
+	if _, err := db.Exec("UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = ?", tokenHash); err != nil {
+		return 0, err
+	}
+	var attempts int
+	err := db.QueryRow("SELECT attempts FROM mfa_challenges WHERE token_hash = ?", tokenHash).Scan(&attempts)
+	return attempts, err
+}
+
+func (db *DB) DeleteMFAChallenge(token string) error {
+	_, err := db.Exec("DELETE FROM mfa_challenges WHERE token_hash = ?", db.hashToken(token))
+	return err
+}
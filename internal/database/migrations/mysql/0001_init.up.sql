@@ -1,7 +1,4 @@
-CREATE DATABASE IF NOT EXISTS simple_web_app;
-USE simple_web_app;
-
-CREATE TABLE users (
+CREATE TABLE IF NOT EXISTS users (
     id INT AUTO_INCREMENT PRIMARY KEY,
     first_name VARCHAR(50) NOT NULL,
     last_name VARCHAR(50) NOT NULL,
@@ -11,15 +8,15 @@ CREATE TABLE users (
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
 );
 
-CREATE TABLE sessions (
+CREATE TABLE IF NOT EXISTS sessions (
     session_token VARCHAR(64) PRIMARY KEY,
     user_id INT NOT NULL,
     expires_at TIMESTAMP NOT NULL,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
-CREATE TABLE captchas (
+CREATE TABLE IF NOT EXISTS captchas (
     id CHAR(36) PRIMARY KEY,
     answer VARCHAR(10) NOT NULL,
     expires_at TIMESTAMP DEFAULT (CURRENT_TIMESTAMP + INTERVAL 5 MINUTE)
-);
\ No newline at end of file
+);
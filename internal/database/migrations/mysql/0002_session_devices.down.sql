@@ -0,0 +1,9 @@
+ALTER TABLE sessions
+    DROP PRIMARY KEY,
+    DROP INDEX sessions_session_token,
+    DROP COLUMN id,
+    DROP COLUMN user_agent,
+    DROP COLUMN ip_address,
+    DROP COLUMN created_at,
+    DROP COLUMN last_seen_at,
+    ADD PRIMARY KEY (session_token);
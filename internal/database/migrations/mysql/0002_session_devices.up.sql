@@ -0,0 +1,14 @@
+ALTER TABLE sessions
+    DROP PRIMARY KEY,
+    ADD COLUMN id CHAR(32) NULL FIRST,
+    ADD COLUMN user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    ADD COLUMN created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE sessions SET id = REPLACE(UUID(), '-', '');
+
+ALTER TABLE sessions
+    MODIFY id CHAR(32) NOT NULL,
+    ADD PRIMARY KEY (id),
+    ADD UNIQUE KEY sessions_session_token (session_token);
@@ -0,0 +1,6 @@
+DELETE FROM sessions WHERE session_token IS NULL;
+
+ALTER TABLE sessions
+    DROP INDEX sessions_token_hash,
+    DROP COLUMN token_hash,
+    MODIFY session_token VARCHAR(64) NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE sessions
+    ADD COLUMN token_hash CHAR(64) NULL AFTER id,
+    ADD UNIQUE KEY sessions_token_hash (token_hash),
+    MODIFY session_token VARCHAR(64) NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE sessions ADD COLUMN absolute_expires_at TIMESTAMP NULL AFTER expires_at;
+
+UPDATE sessions SET absolute_expires_at = expires_at;
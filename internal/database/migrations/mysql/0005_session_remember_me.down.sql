@@ -0,0 +1,5 @@
+ALTER TABLE sessions
+    DROP INDEX sessions_previous_token_hash,
+    DROP COLUMN persistent,
+    DROP COLUMN previous_token_hash,
+    DROP COLUMN token_issued_at;
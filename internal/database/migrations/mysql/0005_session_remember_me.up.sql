@@ -0,0 +1,7 @@
+ALTER TABLE sessions
+    ADD COLUMN persistent BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN previous_token_hash CHAR(64) NULL AFTER token_hash,
+    ADD COLUMN token_issued_at TIMESTAMP NULL,
+    ADD INDEX sessions_previous_token_hash (previous_token_hash);
+
+UPDATE sessions SET token_issued_at = created_at;
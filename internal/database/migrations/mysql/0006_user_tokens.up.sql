@@ -0,0 +1,10 @@
+CREATE TABLE user_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    purpose VARCHAR(32) NOT NULL,
+    user_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    INDEX user_tokens_user_purpose (user_id, purpose),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+-- Magic sign-in links only work in the browser that asked for them. The
+-- column holds the hash of the secret kept in that browser's cookie.
+ALTER TABLE user_tokens ADD COLUMN binding_hash CHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- Rate limit buckets shared by all instances of the app. bucket_key is the
+-- SHA-256 of the limited key and full_at, in Unix nanoseconds, is when the
+-- bucket has refilled, after which the row can go.
+CREATE TABLE rate_limits (
+    bucket_key CHAR(64) NOT NULL PRIMARY KEY,
+    full_at BIGINT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    INDEX rate_limits_expires_at (expires_at)
+);
@@ -0,0 +1,7 @@
+-- Nonces of answered signed captchas, kept until the captcha would have
+-- expired so that each token is accepted only once.
+CREATE TABLE captcha_replays (
+    nonce VARCHAR(64) NOT NULL PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL,
+    INDEX captcha_replays_expires_at (expires_at)
+);
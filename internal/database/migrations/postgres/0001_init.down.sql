@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS captchas;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
+DROP FUNCTION IF EXISTS set_updated_at();
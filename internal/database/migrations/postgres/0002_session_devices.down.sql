@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS sessions_user_id;
+
+ALTER TABLE sessions
+    DROP CONSTRAINT sessions_pkey,
+    DROP CONSTRAINT sessions_session_token_key,
+    DROP COLUMN id,
+    DROP COLUMN user_agent,
+    DROP COLUMN ip_address,
+    DROP COLUMN created_at,
+    DROP COLUMN last_seen_at,
+    ADD PRIMARY KEY (session_token);
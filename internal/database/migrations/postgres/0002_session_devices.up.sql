@@ -0,0 +1,16 @@
+ALTER TABLE sessions
+    DROP CONSTRAINT sessions_pkey,
+    ADD COLUMN id CHAR(32),
+    ADD COLUMN user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE sessions SET id = md5(random()::text || session_token);
+
+ALTER TABLE sessions
+    ALTER COLUMN id SET NOT NULL,
+    ADD PRIMARY KEY (id),
+    ADD CONSTRAINT sessions_session_token_key UNIQUE (session_token);
+
+CREATE INDEX sessions_user_id ON sessions (user_id);
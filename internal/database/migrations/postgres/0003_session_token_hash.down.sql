@@ -0,0 +1,6 @@
+DELETE FROM sessions WHERE session_token IS NULL;
+
+ALTER TABLE sessions
+    DROP CONSTRAINT sessions_token_hash_key,
+    DROP COLUMN token_hash,
+    ALTER COLUMN session_token SET NOT NULL;
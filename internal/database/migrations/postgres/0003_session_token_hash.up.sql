@@ -0,0 +1,4 @@
+ALTER TABLE sessions
+    ADD COLUMN token_hash CHAR(64),
+    ADD CONSTRAINT sessions_token_hash_key UNIQUE (token_hash),
+    ALTER COLUMN session_token DROP NOT NULL;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS sessions_previous_token_hash;
+
+ALTER TABLE sessions
+    DROP COLUMN persistent,
+    DROP COLUMN previous_token_hash,
+    DROP COLUMN token_issued_at;
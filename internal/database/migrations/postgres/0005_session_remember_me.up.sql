@@ -0,0 +1,8 @@
+ALTER TABLE sessions
+    ADD COLUMN persistent BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN previous_token_hash CHAR(64),
+    ADD COLUMN token_issued_at TIMESTAMPTZ;
+
+UPDATE sessions SET token_issued_at = created_at;
+
+CREATE INDEX sessions_previous_token_hash ON sessions (previous_token_hash);
@@ -0,0 +1,10 @@
+CREATE TABLE user_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    purpose VARCHAR(32) NOT NULL,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX user_tokens_user_purpose ON user_tokens (user_id, purpose);
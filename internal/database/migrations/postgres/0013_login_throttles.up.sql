@@ -0,0 +1,13 @@
+-- Failed password logins per account (normalized email) and per client IP.
+-- A row lives until expires_at, after which its counter starts over.
+CREATE TABLE login_throttles (
+    kind VARCHAR(10) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    failures INTEGER NOT NULL,
+    last_failed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMPTZ NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (kind, subject)
+);
+
+CREATE INDEX login_throttles_expires_at ON login_throttles (expires_at);
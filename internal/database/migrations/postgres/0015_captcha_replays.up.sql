@@ -0,0 +1,8 @@
+-- Nonces of answered signed captchas, kept until the captcha would have
+-- expired so that each token is accepted only once.
+CREATE TABLE captcha_replays (
+    nonce VARCHAR(64) NOT NULL PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX captcha_replays_expires_at ON captcha_replays (expires_at);
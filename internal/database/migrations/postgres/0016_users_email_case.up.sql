@@ -0,0 +1,5 @@
+-- Emails are unique without regard to letter case, as they are on MySQL
+-- and SQLite. Fails if two accounts differ only in case; merge them first.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+
+CREATE UNIQUE INDEX users_email_lower ON users (lower(email));
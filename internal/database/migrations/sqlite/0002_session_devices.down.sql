@@ -0,0 +1,12 @@
+CREATE TABLE sessions_old (
+    session_token VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO sessions_old (session_token, user_id, expires_at)
+    SELECT session_token, user_id, expires_at FROM sessions;
+
+DROP TABLE sessions;
+ALTER TABLE sessions_old RENAME TO sessions;
@@ -0,0 +1,20 @@
+CREATE TABLE sessions_old (
+    id CHAR(32) PRIMARY KEY,
+    session_token VARCHAR(64) NOT NULL UNIQUE,
+    user_id INTEGER NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO sessions_old (id, session_token, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at)
+    SELECT id, session_token, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at
+    FROM sessions WHERE session_token IS NOT NULL;
+
+DROP TABLE sessions;
+ALTER TABLE sessions_old RENAME TO sessions;
+
+CREATE INDEX sessions_user_id ON sessions (user_id);
@@ -0,0 +1,20 @@
+CREATE TABLE sessions_new (
+    id CHAR(32) PRIMARY KEY,
+    token_hash CHAR(64) UNIQUE,
+    session_token VARCHAR(64) UNIQUE,
+    user_id INTEGER NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO sessions_new (id, session_token, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at)
+    SELECT id, session_token, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at FROM sessions;
+
+DROP TABLE sessions;
+ALTER TABLE sessions_new RENAME TO sessions;
+
+CREATE INDEX sessions_user_id ON sessions (user_id);
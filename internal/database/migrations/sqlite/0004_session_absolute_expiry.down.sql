@@ -0,0 +1 @@
+ALTER TABLE sessions DROP COLUMN absolute_expires_at;
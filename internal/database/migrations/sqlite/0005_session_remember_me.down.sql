@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS sessions_previous_token_hash;
+
+ALTER TABLE sessions DROP COLUMN persistent;
+ALTER TABLE sessions DROP COLUMN previous_token_hash;
+ALTER TABLE sessions DROP COLUMN token_issued_at;
@@ -0,0 +1,7 @@
+ALTER TABLE sessions ADD COLUMN persistent BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE sessions ADD COLUMN previous_token_hash CHAR(64);
+ALTER TABLE sessions ADD COLUMN token_issued_at TIMESTAMP;
+
+UPDATE sessions SET token_issued_at = created_at;
+
+CREATE INDEX sessions_previous_token_hash ON sessions (previous_token_hash);
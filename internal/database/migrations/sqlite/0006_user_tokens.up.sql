@@ -0,0 +1,11 @@
+CREATE TABLE user_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    purpose VARCHAR(32) NOT NULL,
+    user_id INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_tokens_user_purpose ON user_tokens (user_id, purpose);
@@ -0,0 +1,21 @@
+CREATE TABLE webauthn_credentials (
+    id CHAR(32) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    credential_id VARCHAR(350) NOT NULL UNIQUE,
+    public_key TEXT NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webauthn_credentials_user_id ON webauthn_credentials (user_id);
+
+CREATE TABLE webauthn_challenges (
+    challenge_hash CHAR(64) PRIMARY KEY,
+    ceremony VARCHAR(16) NOT NULL,
+    user_id INTEGER NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
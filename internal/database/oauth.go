@@ -0,0 +1,231 @@
+package database
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"web-app/internal/models"
+	"web-app/internal/utils"
+)
+
+// ErrInvalidClientSecret means a client authenticated with the wrong secret,
+// or with any secret at all when it is a public client.
+var ErrInvalidClientSecret = errors.New("invalid client secret")
+
+// hashClientSecret hashes a client secret without the token key, for the
+// same reasons as hashRecoveryCode: secrets are configured into other apps
+// and must outlive a rotated SESSION_SECRET.
+func hashClientSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkClientSecret compares secret with the stored hash. A public client,
+// with an empty hash, must not send a secret.
+func checkClientSecret(client *models.OAuthClient, secret string) error {
+	if subtle.ConstantTimeCompare([]byte(hashClientSecret(secret)), []byte(client.SecretHash)) != 1 {
+		return ErrInvalidClientSecret
+	}
+	return nil
+}
+
+// prepareOAuthClient fills in the client ID and creation time a caller left
+// empty and stores the hash of secret.
+func prepareOAuthClient(client *models.OAuthClient, secret string) error {
+	if client.ID == "" {
+		id, err := utils.GenerateSecureToken(16)
+		if err != nil {
+			return err
+		}
+		client.ID = id
+	}
+	if client.CreatedAt.IsZero() {
+		client.CreatedAt = now()
+	}
+	client.SecretHash = hashClientSecret(secret)
+	return nil
+}
+
+// CreateOAuthClient registers a client. An empty secret registers a public
+// client.
+func (db *DB) CreateOAuthClient(client *models.OAuthClient, secret string) error {
+	if err := prepareOAuthClient(client, secret); err != nil {
+		return err
+	}
+	query := "INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, created_at) VALUES (?, ?, ?, ?, ?)"
+	_, err := db.Exec(query, client.ID, client.Name, client.SecretHash, strings.Join(client.RedirectURIs, "\n"), client.CreatedAt.UTC())
+	return err
+}
+
+const oauthClientColumns = "id, name, secret_hash, redirect_uris, created_at"
+
+func scanOAuthClient(row interface{ Scan(...any) error }) (*models.OAuthClient, error) {
+	var c models.OAuthClient
+	var redirectURIs string
+	if err := row.Scan(&c.ID, &c.Name, &c.SecretHash, &redirectURIs, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	c.RedirectURIs = strings.Fields(redirectURIs)
+	return &c, nil
+}
+
+func (db *DB) GetOAuthClient(id string) (*models.OAuthClient, error) {
+	return scanOAuthClient(db.QueryRow("SELECT "+oauthClientColumns+" FROM oauth_clients WHERE id = ?", id))
+}
+
+// AuthenticateOAuthClient returns the client if secret is its secret. It
+// fails with sql.ErrNoRows for an unknown client and ErrInvalidClientSecret
+// for a wrong secret.
+func (db *DB) AuthenticateOAuthClient(id, secret string) (*models.OAuthClient, error) {
+	client, err := db.GetOAuthClient(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkClientSecret(client, secret); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (db *DB) ListOAuthClients() ([]models.OAuthClient, error) {
+	rows, err := db.Query("SELECT " + oauthClientColumns + " FROM oauth_clients ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []models.OAuthClient
+	for rows.Next() {
+		c, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *c)
+	}
+	return clients, rows.Err()
+}
+
+// DeleteOAuthClient removes a client together with its consents, codes and
+// tokens.
+func (db *DB) DeleteOAuthClient(id string) (bool, error) {
+	for _, table := range []string{"oauth_tokens", "oauth_authorizations", "oauth_consents"} {
+		if _, err := db.Exec("DELETE FROM "+table+" WHERE client_id = ?", id); err != nil {
+			return false, err
+		}
+	}
+	result, err := db.Exec("DELETE FROM oauth_clients WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (db *DB) GetOAuthConsent(userID int, clientID string) (*models.OAuthConsent, error) {
+	c := models.OAuthConsent{UserID: userID, ClientID: clientID}
+	err := db.QueryRow("SELECT scope, created_at FROM oauth_consents WHERE user_id = ? AND client_id = ?", userID, clientID).
+		Scan(&c.Scope, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveOAuthConsent records consent, replacing what the user allowed the
+// client before.
+func (db *DB) SaveOAuthConsent(consent *models.OAuthConsent) error {
+	if consent.CreatedAt.IsZero() {
+		consent.CreatedAt = now()
+	}
+	if _, err := db.Exec("DELETE FROM oauth_consents WHERE user_id = ? AND client_id = ?", consent.UserID, consent.ClientID); err != nil {
+		return err
+	}
+	_, err := db.Exec("INSERT INTO oauth_consents (user_id, client_id, scope, created_at) VALUES (?, ?, ?, ?)",
+		consent.UserID, consent.ClientID, consent.Scope, consent.CreatedAt.UTC())
+	return err
+}
+
+func (db *DB) CreateOAuthAuthorization(a *models.OAuthAuthorization) error {
+	query := "INSERT INTO oauth_authorizations (handle_hash, kind, client_id, user_id, redirect_uri, scope, state, nonce, code_challenge, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err := db.Exec(query, db.hashToken(a.Handle), a.Kind, a.ClientID, a.UserID, a.RedirectURI, a.Scope, a.State, a.Nonce,
+		a.CodeChallenge, a.ExpiresAt.UTC())
+	return err
+}
+
+// ConsumeOAuthAuthorization returns the unexpired authorization of kind
+// named by handle and deletes it, so every consent request and every code
+// is used at most once.
+func (db *DB) ConsumeOAuthAuthorization(kind, handle string) (*models.OAuthAuthorization, error) {
+	handleHash := db.hashToken(handle)
+	a := models.OAuthAuthorization{Handle: handle, Kind: kind}
+	err := db.QueryRow("SELECT client_id, user_id, redirect_uri, scope, state, nonce, code_challenge, expires_at FROM oauth_authorizations WHERE handle_hash = ? AND kind = ? AND expires_at > ?",
+		handleHash, kind, now()).Scan(&a.ClientID, &a.UserID, &a.RedirectURI, &a.Scope, &a.State, &a.Nonce, &a.CodeChallenge, &a.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.Exec("DELETE FROM oauth_authorizations WHERE handle_hash = ?", handleHash)
+	if err != nil {
+		return nil, err
+	}
+	// A concurrent request may have consumed it between the two statements.
+	if deleted, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if deleted == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &a, nil
+}
+
+func (db *DB) CreateOAuthToken(token *models.OAuthToken) error {
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = now()
+	}
+	query := "INSERT INTO oauth_tokens (token_hash, kind, client_id, user_id, scope, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	_, err := db.Exec(query, db.hashToken(token.Token), token.Kind, token.ClientID, token.UserID, token.Scope,
+		token.CreatedAt.UTC(), token.ExpiresAt.UTC())
+	return err
+}
+
+// GetOAuthToken returns the unexpired token of kind.
+func (db *DB) GetOAuthToken(kind, token string) (*models.OAuthToken, error) {
+	t := models.OAuthToken{Token: token, Kind: kind}
+	err := db.QueryRow("SELECT client_id, user_id, scope, created_at, expires_at FROM oauth_tokens WHERE token_hash = ? AND kind = ? AND expires_at > ?",
+		db.hashToken(token), kind, now()).Scan(&t.ClientID, &t.UserID, &t.Scope, &t.CreatedAt, &t.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ConsumeOAuthToken returns the unexpired token of kind and deletes it.
+// Refresh tokens are consumed this way, so each one is redeemed only once.
+func (db *DB) ConsumeOAuthToken(kind, token string) (*models.OAuthToken, error) {
+	t, err := db.GetOAuthToken(kind, token)
+	if err != nil {
+		return nil, err
+	}
+	result, err := db.Exec("DELETE FROM oauth_tokens WHERE token_hash = ?", db.hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if deleted == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+// DeleteUserOAuthTokens revokes every token issued for the user, for
+// example after a password change.
+func (db *DB) DeleteUserOAuthTokens(userID int) error {
+	_, err := db.Exec("DELETE FROM oauth_tokens WHERE user_id = ?", userID)
+	return err
+}
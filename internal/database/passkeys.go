@@ -0,0 +1,155 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+	"web-app/internal/models"
+	"web-app/internal/utils"
+)
+
+var ErrPasskeyExists = errors.New("passkey already registered")
+
+const passkeyColumns = "id, user_id, credential_id, public_key, sign_count, name, created_at, last_used_at"
+
+// Credential IDs and public keys are binary; they are stored as unpadded
+// base64url so every dialect can keep them in a plain text column.
+var passkeyEncoding = base64.RawURLEncoding
+
+func scanPasskey(row interface{ Scan(...any) error }) (*models.Passkey, error) {
+	var p models.Passkey
+	var credentialID, publicKey string
+	var signCount int64
+	var lastUsedAt sql.NullTime
+	if err := row.Scan(&p.ID, &p.UserID, &credentialID, &publicKey, &signCount, &p.Name, &p.CreatedAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.CredentialID, err = passkeyEncoding.DecodeString(credentialID); err != nil {
+		return nil, fmt.Errorf("invalid stored credential ID: %w", err)
+	}
+	if p.PublicKey, err = passkeyEncoding.DecodeString(publicKey); err != nil {
+		return nil, fmt.Errorf("invalid stored public key: %w", err)
+	}
+	p.SignCount = uint32(signCount)
+	if lastUsedAt.Valid {
+		p.LastUsedAt = &lastUsedAt.Time
+	}
+	return &p, nil
+}
+
+// preparePasskey fills in the public ID and creation time a caller left
+// empty.
+func preparePasskey(passkey *models.Passkey) error {
+	if passkey.ID == "" {
+		id, err := utils.GenerateSecureToken(16)
+		if err != nil {
+			return err
+		}
+		passkey.ID = id
+	}
+	if passkey.CreatedAt.IsZero() {
+		passkey.CreatedAt = now()
+	}
+	return nil
+}
+
+// CreatePasskey stores a newly registered credential. It fails with
+// ErrPasskeyExists when the credential ID is already registered to anyone.
+func (db *DB) CreatePasskey(passkey *models.Passkey) error {
+	if err := preparePasskey(passkey); err != nil {
+		return err
+	}
+	query := "INSERT INTO webauthn_credentials (id, user_id, credential_id, public_key, sign_count, name, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	_, err := db.Exec(query, passkey.ID, passkey.UserID, passkeyEncoding.EncodeToString(passkey.CredentialID),
+		passkeyEncoding.EncodeToString(passkey.PublicKey), int64(passkey.SignCount), passkey.Name, passkey.CreatedAt.UTC())
+	if err != nil && db.Dialect.isDuplicateKey(err) {
+		return fmt.Errorf("%w", ErrPasskeyExists)
+	}
+	return err
+}
+
+func (db *DB) GetPasskeyByCredentialID(credentialID []byte) (*models.Passkey, error) {
+	query := "SELECT " + passkeyColumns + " FROM webauthn_credentials WHERE credential_id = ?"
+	return scanPasskey(db.QueryRow(query, passkeyEncoding.EncodeToString(credentialID)))
+}
+
+func (db *DB) ListUserPasskeys(userID int) ([]models.Passkey, error) {
+	rows, err := db.Query("SELECT "+passkeyColumns+" FROM webauthn_credentials WHERE user_id = ? ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passkeys []models.Passkey
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, *p)
+	}
+	return passkeys, rows.Err()
+}
+
+// UpdatePasskeyUsage records a successful login with the passkey and the
+// signature counter the authenticator reported.
+func (db *DB) UpdatePasskeyUsage(id string, signCount uint32, usedAt time.Time) error {
+	_, err := db.Exec("UPDATE webauthn_credentials SET sign_count = ?, last_used_at = ? WHERE id = ?", int64(signCount), usedAt.UTC(), id)
+	return err
+}
+
+func (db *DB) DeleteUserPasskey(userID int, id string) (bool, error) {
+	result, err := db.Exec("DELETE FROM webauthn_credentials WHERE user_id = ? AND id = ?", userID, id)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+// DeleteUserPasskeys removes every passkey of userID, as when the account
+// is recovered through a password reset.
+func (db *DB) DeleteUserPasskeys(userID int) error {
+	_, err := db.Exec("DELETE FROM webauthn_credentials WHERE user_id = ?", userID)
+	return err
+}
+
+func (db *DB) hashChallenge(challenge []byte) string {
+	return db.hashToken(passkeyEncoding.EncodeToString(challenge))
+}
+
+func (db *DB) CreateWebAuthnChallenge(challenge *models.WebAuthnChallenge) error {
+	userID := sql.NullInt64{Int64: int64(challenge.UserID), Valid: challenge.UserID != 0}
+	query := "INSERT INTO webauthn_challenges (challenge_hash, ceremony, user_id, expires_at) VALUES (?, ?, ?, ?)"
+	_, err := db.Exec(query, db.hashChallenge(challenge.Challenge), challenge.Ceremony, userID, challenge.ExpiresAt.UTC())
+	return err
+}
+
+// ConsumeWebAuthnChallenge looks up an unexpired challenge issued for
+// ceremony and deletes it, so every challenge is answered at most once.
+func (db *DB) ConsumeWebAuthnChallenge(challenge []byte, ceremony string) (*models.WebAuthnChallenge, error) {
+	challengeHash := db.hashChallenge(challenge)
+	c := models.WebAuthnChallenge{Challenge: challenge, Ceremony: ceremony}
+	var userID sql.NullInt64
+	err := db.QueryRow("SELECT user_id, expires_at FROM webauthn_challenges WHERE challenge_hash = ? AND ceremony = ? AND expires_at > ?",
+		challengeHash, ceremony, now()).Scan(&userID, &c.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.Exec("DELETE FROM webauthn_challenges WHERE challenge_hash = ?", challengeHash)
+	if err != nil {
+		return nil, err
+	}
+	// A concurrent request may have consumed it between the two statements.
+	if deleted, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if deleted == 0 {
+		return nil, sql.ErrNoRows
+	}
+	c.UserID = int(userID.Int64)
+	return &c, nil
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+	"web-app/internal/ratelimit"
+)
+
+// maxRateLimitAttempts bounds the compare-and-swap retries of TakeRateLimit.
+const maxRateLimitAttempts = 5
+
+// TakeRateLimit takes one request from the bucket of key. The bucket is
+// read, updated in Go and written back only if no other request changed it
+// in between; a request that keeps losing that race is refused, since that
+// many concurrent requests for one key are over any sensible limit.
+func (db *DB) TakeRateLimit(key string, rule ratelimit.Rule) (time.Duration, error) {
+	sum := sha256.Sum256([]byte(key))
+	bucket := hex.EncodeToString(sum[:])
+
+	for attempt := 0; attempt < maxRateLimitAttempts; attempt++ {
+		at := now()
+		var fullAt int64
+		err := db.QueryRow("SELECT full_at FROM rate_limits WHERE bucket_key = ?", bucket).Scan(&fullAt)
+		exists := err == nil
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+
+		var full time.Time
+		if exists {
+			full = time.Unix(0, fullAt)
+		}
+		next, wait := rule.Take(full, at)
+		if wait > 0 {
+			return wait, nil
+		}
+
+		if exists {
+			result, err := db.Exec("UPDATE rate_limits SET full_at = ?, expires_at = ? WHERE bucket_key = ? AND full_at = ?",
+				next.UnixNano(), next, bucket, fullAt)
+			if err != nil {
+				return 0, err
+			}
+			if updated, err := result.RowsAffected(); err != nil {
+				return 0, err
+			} else if updated > 0 {
+				return 0, nil
+			}
+			continue
+		}
+
+		_, err = db.Exec("INSERT INTO rate_limits (bucket_key, full_at, expires_at) VALUES (?, ?, ?)",
+			bucket, next.UnixNano(), next)
+		if err == nil {
+			return 0, nil
+		}
+		if !db.Dialect.isDuplicateKey(err) {
+			return 0, err
+		}
+	}
+	return rule.Interval(), nil
+}
@@ -1,54 +1,221 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
 	"log"
+	"time"
 	"web-app/internal/models"
+	"web-app/internal/utils"
 )
 
+const sessionColumns = "id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, absolute_expires_at, persistent, token_issued_at"
+
+// activeSession matches sessions that are within both their idle and their
+// absolute lifetime. It takes the current time twice.
+const activeSession = "expires_at > ? AND absolute_expires_at > ?"
+
+// rotationGracePeriod is how long the token replaced by a rotation keeps
+// working, so requests already in flight with the old cookie are not logged
+// out.
+const rotationGracePeriod = time.Minute
+
+// prepareSession fills in the ID and timestamps a caller left empty, so a
+// bare Session{Token, UserID, ExpiresAt} is still a valid row.
+func prepareSession(session *models.Session) error {
+	if session.ID == "" {
+		id, err := utils.GenerateSecureToken(16)
+		if err != nil {
+			return err
+		}
+		session.ID = id
+	}
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now()
+	}
+	if session.LastSeenAt.IsZero() {
+		session.LastSeenAt = session.CreatedAt
+	}
+	if session.AbsoluteExpiresAt.IsZero() {
+		session.AbsoluteExpiresAt = session.ExpiresAt
+	}
+	if session.TokenIssuedAt.IsZero() {
+		session.TokenIssuedAt = session.CreatedAt
+	}
+	return nil
+}
+
+func scanSession(row interface{ Scan(...any) error }) (*models.Session, error) {
+	var s models.Session
+	var tokenIssuedAt sql.NullTime
+	err := row.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IPAddress, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.AbsoluteExpiresAt,
+		&s.Persistent, &tokenIssuedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.TokenIssuedAt = s.CreatedAt
+	if tokenIssuedAt.Valid {
+		s.TokenIssuedAt = tokenIssuedAt.Time
+	}
+	return &s, nil
+}
+
+// hashToken is how session tokens are stored: only the keyed hash reaches
+// the database, the raw value lives in the browser cookie.
+func (db *DB) hashToken(token string) string {
+	return utils.HashToken(db.TokenKey, token)
+}
+
 func (db *DB) CreateSession(session *models.Session) error {
-	query := "INSERT INTO sessions (session_token, user_id, expires_at) VALUES (?, ?, ?)"
-	_, err := db.Exec(query, session.Token, session.UserID, session.ExpiresAt)
+	if err := prepareSession(session); err != nil {
+		return err
+	}
+
+	query := "INSERT INTO sessions (token_hash, " + sessionColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err := db.Exec(query, db.hashToken(session.Token), session.ID, session.UserID, session.UserAgent, session.IPAddress,
+		session.CreatedAt.UTC(), session.LastSeenAt.UTC(), session.ExpiresAt.UTC(), session.AbsoluteExpiresAt.UTC(),
+		session.Persistent, session.TokenIssuedAt.UTC())
 	return err
 }
 
-func (db *DB) GetUserIDByToken(token string) (int, error) {
-	var userID int
-	query := "SELECT user_id FROM sessions WHERE session_token = ? AND expires_at > NOW()"
+func (db *DB) GetSessionByToken(token string) (*models.Session, error) {
+	tokenHash := db.hashToken(token)
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE " +
+		"(token_hash = ? OR (previous_token_hash = ? AND token_issued_at > ?)) AND " + activeSession
+	session, err := scanSession(db.QueryRow(query, tokenHash, tokenHash, now().Add(-rotationGracePeriod), now(), now()))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return session, err
+	}
+
+	// Sessions created before token hashing still carry the raw token. They
+	// are upgraded to a hash on first use and otherwise simply expire.
+	query = "SELECT " + sessionColumns + " FROM sessions WHERE token_hash IS NULL AND session_token = ? AND " + activeSession
+	session, err = scanSession(db.QueryRow(query, token, now(), now()))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("UPDATE sessions SET token_hash = ?, session_token = NULL WHERE id = ?", tokenHash, session.ID); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
 
-	err := db.QueryRow(query, token).Scan(&userID)
+func (db *DB) ListUserSessions(userID int) ([]models.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE user_id = ? AND " + activeSession + " ORDER BY last_seen_at DESC"
+	rows, err := db.Query(query, userID, now(), now())
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return userID, nil
+	var sessions []models.Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, rows.Err()
 }
 
-func (db *DB) GetValidSessionToken(userID int) (string, error) {
-	var token string
-	query := "SELECT session_token FROM sessions WHERE user_id = ? AND expires_at > NOW()"
-	err := db.QueryRow(query, userID).Scan(&token)
-	return token, err
+// RenewSession records activity and slides the idle expiry. Callers keep
+// expiresAt within the session's absolute lifetime.
+func (db *DB) RenewSession(id string, lastSeen, expiresAt time.Time) error {
+	_, err := db.Exec("UPDATE sessions SET last_seen_at = ?, expires_at = ? WHERE id = ?", lastSeen.UTC(), expiresAt.UTC(), id)
+	return err
 }
 
-func (db *DB) UpdateSessionExpiry(token string) error {
-	_, err := db.Exec("UPDATE sessions SET expires_at = DATE_ADD(NOW(), INTERVAL 24 HOUR) WHERE session_token = ?", token)
+// RotateSessionToken replaces a session's token. With keepPrevious the old
+// token keeps working for rotationGracePeriod; without it the old token is
+// dead immediately.
+func (db *DB) RotateSessionToken(id, token string, issuedAt time.Time, keepPrevious bool) error {
+	previous := "NULL"
+	if keepPrevious {
+		previous = "token_hash"
+	}
+	query := "UPDATE sessions SET previous_token_hash = " + previous + ", token_hash = ?, token_issued_at = ? WHERE id = ?"
+	_, err := db.Exec(query, db.hashToken(token), issuedAt.UTC(), id)
+	return err
+}
+
+func (db *DB) DeleteSession(token string) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE token_hash = ? OR session_token = ?", db.hashToken(token), token)
+	return err
+}
+
+func (db *DB) DeleteUserSession(userID int, id string) (bool, error) {
+	result, err := db.Exec("DELETE FROM sessions WHERE user_id = ? AND id = ?", userID, id)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (db *DB) DeleteUserSessions(userID int) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	return err
+}
+
+// DeleteOtherUserSessions revokes every session of userID except keepID.
+func (db *DB) DeleteOtherUserSessions(userID int, keepID string) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE user_id = ? AND id <> ?", userID, keepID)
 	return err
 }
 
 func (db *DB) CleanupExpired() error {
-	sessionsResult, err := db.Exec("DELETE FROM sessions WHERE expires_at < NOW()")
+	sessionsResult, err := db.Exec("DELETE FROM sessions WHERE expires_at < ? OR absolute_expires_at < ? OR absolute_expires_at IS NULL", now(), now())
+	if err != nil {
+		return err
+	}
+
+	captchasResult, err := db.Exec("DELETE FROM captchas WHERE expires_at < ?", now())
 	if err != nil {
 		return err
 	}
 
-	captchasResult, err := db.Exec("DELETE FROM captchas WHERE expires_at < NOW()")
+	tokensResult, err := db.Exec("DELETE FROM user_tokens WHERE expires_at < ?", now())
 	if err != nil {
 		return err
 	}
 
+	if _, err := db.Exec("DELETE FROM mfa_challenges WHERE expires_at < ?", now()); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("DELETE FROM webauthn_challenges WHERE expires_at < ?", now()); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("DELETE FROM oidc_logins WHERE expires_at < ?", now()); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("DELETE FROM oauth_authorizations WHERE expires_at < ?", now()); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("DELETE FROM oauth_tokens WHERE expires_at < ?", now()); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("DELETE FROM login_throttles WHERE expires_at < ?", now()); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("DELETE FROM rate_limits WHERE expires_at < ?", now()); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("DELETE FROM captcha_replays WHERE expires_at < ?", now()); err != nil {
+		return err
+	}
+
 	sessionsDeleted, _ := sessionsResult.RowsAffected()
 	captchasDeleted, _ := captchasResult.RowsAffected()
-	log.Printf("CleanupExpired completed: sessions=%d, captchas=%d", sessionsDeleted, captchasDeleted)
+	tokensDeleted, _ := tokensResult.RowsAffected()
+	log.Printf("CleanupExpired completed: sessions=%d, captchas=%d, tokens=%d", sessionsDeleted, captchasDeleted, tokensDeleted)
 
 	return nil
 }
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"time"
+	"web-app/internal/models"
+	"web-app/internal/ratelimit"
+)
+
+// UserStore persists user accounts and their password hashes.
+type UserStore interface {
+	CreateUser(user *models.User) (int64, error)
+	EmailExists(email string) (bool, error)
+	Authenticate(email, password string) (int, error)
+	GetUserByID(userID int) (*models.User, error)
+	GetUserByEmail(email string) (*models.User, error)
+	UpdateUser(userID int, firstName, lastName string) error
+	VerifyPassword(userID int, password string) error
+	UpdatePassword(userID int, password string) error
+	MarkEmailVerified(userID int) error
+}
+
+// SessionStore persists login sessions. Every login gets its own row, found
+// by its cookie token and addressed elsewhere by its public ID.
+type SessionStore interface {
+	CreateSession(session *models.Session) error
+	GetSessionByToken(token string) (*models.Session, error)
+	ListUserSessions(userID int) ([]models.Session, error)
+	RenewSession(id string, lastSeen, expiresAt time.Time) error
+	RotateSessionToken(id, token string, issuedAt time.Time, keepPrevious bool) error
+	DeleteSession(token string) error
+	DeleteUserSession(userID int, id string) (bool, error)
+	DeleteUserSessions(userID int) error
+	DeleteOtherUserSessions(userID int, keepID string) error
+}
+
+// CaptchaStore persists issued captcha challenges until they are answered
+// or expire. ConsumeCaptcha returns the answer and removes the captcha in
+// one step, so each captcha can be checked only once. Signed captchas are
+// not stored; UseCaptchaNonce keeps their replay set instead.
+type CaptchaStore interface {
+	CreateCaptcha(captcha *models.Captcha) error
+	ConsumeCaptcha(id string) (string, error)
+	UseCaptchaNonce(nonce string, expiresAt time.Time) (bool, error)
+}
+
+// TokenStore persists single-use tokens mailed to users, such as password
+// reset links. Tokens and their browser bindings are stored hashed, like
+// session tokens.
+type TokenStore interface {
+	CreateUserToken(token *models.UserToken) error
+	ConsumeUserToken(purpose, token, binding string) (*models.UserToken, error)
+	DeleteUserTokens(userID int, purpose string) error
+}
+
+// MFAStore persists two-factor enrollments, recovery codes and the pending
+// logins that still wait for their second factor.
+type MFAStore interface {
+	GetTOTP(userID int) (*models.TOTP, error)
+	SetTOTPSecret(userID int, secret string) error
+	ConfirmTOTP(userID int, counter int64) (bool, error)
+	UseTOTPCounter(userID int, counter int64) (bool, error)
+	DeleteTOTP(userID int) error
+
+	ReplaceRecoveryCodes(userID int, codes []string) error
+	UseRecoveryCode(userID int, code string) (bool, error)
+	CountRecoveryCodes(userID int) (int, error)
+
+	CreateMFAChallenge(challenge *models.MFAChallenge) error
+	GetMFAChallenge(token string) (*models.MFAChallenge, error)
+	RecordMFAFailure(token string) (int, error)
+	DeleteMFAChallenge(token string) error
+}
+
+// PasskeyStore persists WebAuthn credentials and the challenges handed out
+// for registering or using them.
+type PasskeyStore interface {
+	CreatePasskey(passkey *models.Passkey) error
+	GetPasskeyByCredentialID(credentialID []byte) (*models.Passkey, error)
+	ListUserPasskeys(userID int) ([]models.Passkey, error)
+	UpdatePasskeyUsage(id string, signCount uint32, usedAt time.Time) error
+	DeleteUserPasskey(userID int, id string) (bool, error)
+	DeleteUserPasskeys(userID int) error
+
+	CreateWebAuthnChallenge(challenge *models.WebAuthnChallenge) error
+	ConsumeWebAuthnChallenge(challenge []byte, ceremony string) (*models.WebAuthnChallenge, error)
+}
+
+// IdentityStore persists links between users and their accounts at
+// external OpenID Connect providers, and the logins in flight there.
+type IdentityStore interface {
+	CreateIdentity(identity *models.Identity) error
+	GetIdentity(provider, subject string) (*models.Identity, error)
+	ListUserIdentities(userID int) ([]models.Identity, error)
+	DeleteUserIdentity(userID int, provider string) (bool, error)
+
+	CreateOIDCLogin(login *models.OIDCLogin) error
+	ConsumeOIDCLogin(state string) (*models.OIDCLogin, error)
+}
+
+// OAuthStore persists the clients registered with the authorization server
+// and what they were granted: consents, pending requests and authorization
+// codes, and access and refresh tokens.
+type OAuthStore interface {
+	CreateOAuthClient(client *models.OAuthClient, secret string) error
+	GetOAuthClient(id string) (*models.OAuthClient, error)
+	AuthenticateOAuthClient(id, secret string) (*models.OAuthClient, error)
+	ListOAuthClients() ([]models.OAuthClient, error)
+	DeleteOAuthClient(id string) (bool, error)
+
+	GetOAuthConsent(userID int, clientID string) (*models.OAuthConsent, error)
+	SaveOAuthConsent(consent *models.OAuthConsent) error
+
+	CreateOAuthAuthorization(authorization *models.OAuthAuthorization) error
+	ConsumeOAuthAuthorization(kind, handle string) (*models.OAuthAuthorization, error)
+
+	CreateOAuthToken(token *models.OAuthToken) error
+	GetOAuthToken(kind, token string) (*models.OAuthToken, error)
+	ConsumeOAuthToken(kind, token string) (*models.OAuthToken, error)
+	DeleteUserOAuthTokens(userID int) error
+}
+
+// LoginThrottleStore counts failed password logins per account and per
+// client IP, and wrong captcha answers per client IP, and keeps temporary
+// lockouts.
+type LoginThrottleStore interface {
+	GetLoginThrottle(kind, subject string) (*models.LoginThrottle, error)
+	RecordLoginFailure(kind, subject string, window time.Duration) (*models.LoginThrottle, error)
+	LockLogin(kind, subject string, until time.Time) error
+	ClearLoginThrottle(kind, subject string) (bool, error)
+}
+
+// RateLimitStore keeps token buckets for rate limits shared by several
+// instances of the app.
+type RateLimitStore interface {
+	TakeRateLimit(key string, rule ratelimit.Rule) (time.Duration, error)
+}
+
+// Store is everything the HTTP layer needs from a storage backend.
+// *DB (SQL) and *MemoryStore both implement it.
+type Store interface {
+	UserStore
+	SessionStore
+	CaptchaStore
+	TokenStore
+	MFAStore
+	PasskeyStore
+	IdentityStore
+	OAuthStore
+	LoginThrottleStore
+	RateLimitStore
+	CleanupExpired() error
+	Close() error
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"database/sql"
+	"web-app/internal/models"
+)
+
+func (db *DB) CreateUserToken(token *models.UserToken) error {
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = now()
+	}
+	query := "INSERT INTO user_tokens (token_hash, purpose, user_id, binding_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)"
+	_, err := db.Exec(query, db.hashToken(token.Token), token.Purpose, token.UserID, db.hashBinding(token.Binding),
+		token.CreatedAt.UTC(), token.ExpiresAt.UTC())
+	return err
+}
+
+// hashBinding hashes the browser secret of a bound token. Unbound tokens
+// store an empty hash, which no secret can match.
+func (db *DB) hashBinding(binding string) string {
+	if binding == "" {
+		return ""
+	}
+	return db.hashToken(binding)
+}
+
+// ConsumeUserToken marks an unused, unexpired token of the given purpose as
+// used and returns it. binding must match the secret the token was bound to,
+// or be empty for an unbound token; a mismatch leaves the token usable. The
+// UPDATE is the single point of truth, so two concurrent requests with the
+// same token cannot both succeed.
+func (db *DB) ConsumeUserToken(purpose, token, binding string) (*models.UserToken, error) {
+	tokenHash := db.hashToken(token)
+	result, err := db.Exec("UPDATE user_tokens SET used_at = ? WHERE token_hash = ? AND purpose = ? AND binding_hash = ? AND used_at IS NULL AND expires_at > ?",
+		now(), tokenHash, purpose, db.hashBinding(binding), now())
+	if err != nil {
+		return nil, err
+	}
+	if consumed, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if consumed == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	t := models.UserToken{Purpose: purpose}
+	err = db.QueryRow("SELECT user_id, created_at, expires_at FROM user_tokens WHERE token_hash = ?", tokenHash).
+		Scan(&t.UserID, &t.CreatedAt, &t.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (db *DB) DeleteUserTokens(userID int, purpose string) error {
+	_, err := db.Exec("DELETE FROM user_tokens WHERE user_id = ? AND purpose = ?", userID, purpose)
+	return err
+}
@@ -1,36 +1,56 @@
 package database
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"web-app/internal/models"
-
-	"github.com/go-sql-driver/mysql"
-	"golang.org/x/crypto/bcrypt"
+	"web-app/internal/passhash"
 )
 
 var ErrEmailAlreadyRegistered = errors.New("email already registered")
 
+// passwordHasher returns h, or the default hasher when none is configured.
+func passwordHasher(h passhash.Hasher) passhash.Hasher {
+	if h == nil {
+		return passhash.Default
+	}
+	return h
+}
+
+func hashPassword(h passhash.Hasher, password string) (string, error) {
+	return passwordHasher(h).Hash(password)
+}
+
+func checkPassword(h passhash.Hasher, hash, password string) error {
+	err := passwordHasher(h).Verify(hash, password)
+	if errors.Is(err, passhash.ErrMismatch) {
+		return fmt.Errorf("invalid credentials") // Wrong password
+	}
+	return err
+}
+
 func (db *DB) CreateUser(user *models.User) (int64, error) {
-	hashedPass, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPass, err := hashPassword(db.Passwords, user.Password)
 	if err != nil {
 		return 0, err
 	}
 
 	query := "insert into users (first_name, last_name, email, password_hash) values (?, ?, ?, ?)"
-	result, err := db.Exec(query, user.FirstName, user.LastName, user.Email, string(hashedPass))
+	id, err := db.insertID(query, user.FirstName, user.LastName, user.Email, hashedPass)
 	if err != nil {
-		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+		if db.Dialect.isDuplicateKey(err) {
 			return 0, fmt.Errorf("%w", ErrEmailAlreadyRegistered)
 		}
 		return 0, err
 	}
-	return result.LastInsertId()
+	return id, nil
 }
 
 func (db *DB) EmailExists(email string) (bool, error) {
 	var exists bool
-	query := "select exists(select 1 from users where email = ?)"
+	query := "select exists(select 1 from users where " + db.Dialect.emailEquals() + ")"
 	err := db.QueryRow(query, email).Scan(&exists)
 	if err != nil {
 		return false, err
@@ -38,40 +58,66 @@ func (db *DB) EmailExists(email string) (bool, error) {
 	return exists, nil
 }
 
+// Authenticate checks the password of the user with email. A hash from an
+// older algorithm or with other parameters than the configured hasher's is
+// replaced while the password is at hand.
 func (db *DB) Authenticate(email, password string) (int, error) {
 	var id int
 	var hashedPassword string
 
-	query := "SELECT id, password_hash FROM users WHERE email = ?"
+	query := "SELECT id, password_hash FROM users WHERE " + db.Dialect.emailEquals()
 	err := db.QueryRow(query, email).Scan(&id, &hashedPassword)
 	if err != nil {
-		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1146 {
+		if db.Dialect.isMissingTable(err) {
 			return 0, fmt.Errorf("invalid credentials")
 		}
 		return 0, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	if err != nil {
-		if err == bcrypt.ErrMismatchedHashAndPassword {
-			return 0, fmt.Errorf("invalid credentials") // Wrong password
-		}
+	if err := checkPassword(db.Passwords, hashedPassword, password); err != nil {
 		return 0, err
 	}
 
+	if passwordHasher(db.Passwords).NeedsRehash(hashedPassword) {
+		if err := db.rehashPassword(id, hashedPassword, password); err != nil {
+			log.Printf("Failed to rehash password of user %d: %v", id, err)
+		}
+	}
+
 	return id, nil
 }
 
-func (db *DB) GetUserByID(userID int) (*models.User, error) {
-	var user models.User
-	query := "SELECT id, first_name, last_name, email, created_at FROM users WHERE id = ?"
-	err := db.QueryRow(query, userID).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.CreatedAt)
+// rehashPassword replaces oldHash with a hash from the configured hasher,
+// unless the password was changed in the meantime.
+func (db *DB) rehashPassword(userID int, oldHash, password string) error {
+	hashedPass, err := hashPassword(db.Passwords, password)
 	if err != nil {
+		return err
+	}
+	_, err = db.Exec("UPDATE users SET password_hash = ? WHERE id = ? AND password_hash = ?", hashedPass, userID, oldHash)
+	return err
+}
+
+const userColumns = "id, first_name, last_name, email, email_verified_at, created_at"
+
+func scanUser(row interface{ Scan(...any) error }) (*models.User, error) {
+	var user models.User
+	var verifiedAt sql.NullTime
+	if err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &verifiedAt, &user.CreatedAt); err != nil {
 		return nil, err
 	}
+	user.EmailVerified = verifiedAt.Valid
 	return &user, nil
 }
 
+func (db *DB) GetUserByID(userID int) (*models.User, error) {
+	return scanUser(db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", userID))
+}
+
+func (db *DB) GetUserByEmail(email string) (*models.User, error) {
+	return scanUser(db.QueryRow("SELECT "+userColumns+" FROM users WHERE "+db.Dialect.emailEquals(), email))
+}
+
 func (db *DB) UpdateUser(userID int, firstName, lastName string) error {
 	query := "UPDATE users SET first_name = ?, last_name = ? WHERE id = ?"
 	_, err := db.Exec(query, firstName, lastName, userID)
@@ -85,15 +131,20 @@ func (db *DB) VerifyPassword(userID int, password string) error {
 	if err != nil {
 		return err
 	}
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return checkPassword(db.Passwords, hash, password)
 }
 
 func (db *DB) UpdatePassword(userID int, password string) error {
-	hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPass, err := hashPassword(db.Passwords, password)
 	if err != nil {
 		return err
 	}
 	query := "UPDATE users SET password_hash = ? WHERE id = ?"
-	_, err = db.Exec(query, string(hashedPass), userID)
+	_, err = db.Exec(query, hashedPass, userID)
+	return err
+}
+
+func (db *DB) MarkEmailVerified(userID int) error {
+	_, err := db.Exec("UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL", now(), userID)
 	return err
 }
@@ -0,0 +1,74 @@
+package jose
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Audience is the "aud" claim, which may be a single string or an array.
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("jose: invalid audience: %w", err)
+	}
+	*a = many
+	return nil
+}
+
+func (a Audience) Contains(audience string) bool {
+	return slices.Contains(a, audience)
+}
+
+// Claims are the registered JWT claims (RFC 7519). Times are Unix seconds.
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	Expiry    int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// Leeway is the clock skew tolerated between this server and token issuers.
+const Leeway = time.Minute
+
+var ErrExpired = errors.New("jose: token expired")
+
+// Validate checks issuer, audience and the validity window at now. An
+// expiry is required.
+func (c Claims) Validate(issuer, audience string, now time.Time) error {
+	if c.Issuer != issuer {
+		return fmt.Errorf("jose: unexpected issuer %q", c.Issuer)
+	}
+	if !c.Audience.Contains(audience) {
+		return errors.New("jose: token not issued for this audience")
+	}
+	if c.Expiry == 0 || now.Add(-Leeway).Unix() >= c.Expiry {
+		return ErrExpired
+	}
+	if c.NotBefore != 0 && now.Add(Leeway).Unix() < c.NotBefore {
+		return errors.New("jose: token not valid yet")
+	}
+	if c.IssuedAt != 0 && now.Add(Leeway).Unix() < c.IssuedAt {
+		return errors.New("jose: token issued in the future")
+	}
+	return nil
+}
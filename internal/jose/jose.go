@@ -0,0 +1,288 @@
+// Package jose signs and verifies compact JSON Web Signatures (RFC 7515)
+// with RS256 or ES256 and handles the matching JSON Web Keys (RFC 7517).
+// It is the subset OpenID Connect needs for ID tokens; unsigned tokens and
+// symmetric algorithms are refused on purpose.
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+var (
+	ErrMalformed    = errors.New("jose: malformed token")
+	ErrUnknownKey   = errors.New("jose: no matching key")
+	ErrBadSignature = errors.New("jose: invalid signature")
+)
+
+var b64 = base64.RawURLEncoding
+
+// Header is the protected JOSE header of a token.
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// JSONWebKey is a public RSA or P-256 key as published in a JWKS document.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// KeySet is a JWKS document.
+type KeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// NewJSONWebKey describes pub, an *rsa.PublicKey or a P-256
+// *ecdsa.PublicKey, for publication under kid.
+func NewJSONWebKey(pub crypto.PublicKey, kid string) (JSONWebKey, error) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{
+			Kty: "RSA", Kid: kid, Use: "sig", Alg: RS256,
+			N: b64.EncodeToString(key.N.Bytes()),
+			E: b64.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return JSONWebKey{}, errors.New("jose: only P-256 EC keys are supported")
+		}
+		raw, err := key.Bytes()
+		if err != nil {
+			return JSONWebKey{}, err
+		}
+		return JSONWebKey{
+			Kty: "EC", Kid: kid, Use: "sig", Alg: ES256, Crv: "P-256",
+			X: b64.EncodeToString(raw[1:33]),
+			Y: b64.EncodeToString(raw[33:65]),
+		}, nil
+	default:
+		return JSONWebKey{}, fmt.Errorf("jose: unsupported key type %T", pub)
+	}
+}
+
+// PublicKey decodes the key into an *rsa.PublicKey or *ecdsa.PublicKey.
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := b64.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jose: invalid RSA modulus: %w", err)
+		}
+		e, err := b64.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("jose: invalid RSA exponent")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("jose: RSA key shorter than 2048 bits")
+		}
+		return key, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("jose: unsupported curve %q", k.Crv)
+		}
+		x, errX := b64.DecodeString(k.X)
+		y, errY := b64.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("jose: invalid EC coordinates")
+		}
+		return ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+	default:
+		return nil, fmt.Errorf("jose: unsupported key type %q", k.Kty)
+	}
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the key, base64url
+// encoded. It is a stable key ID derived from the key alone.
+func (k JSONWebKey) Thumbprint() string {
+	// The required members in lexicographic order, without whitespace.
+	var canonical string
+	if k.Kty == "EC" {
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Crv, k.X, k.Y)
+	} else {
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return b64.EncodeToString(sum[:])
+}
+
+// algorithm returns the only signature algorithm the key may be used with.
+func (k JSONWebKey) algorithm() string {
+	if k.Kty == "EC" {
+		return ES256
+	}
+	return RS256
+}
+
+// candidates returns the keys a token signed with header may verify
+// against. Without a kid every key of the right type is tried.
+func (s KeySet) candidates(header Header) []JSONWebKey {
+	var keys []JSONWebKey
+	for _, k := range s.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if k.algorithm() != header.Alg || (header.Kid != "" && k.Kid != header.Kid) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Sign serializes claims as the payload of a compact JWS signed with key, an
+// *rsa.PrivateKey (RS256) or a P-256 *ecdsa.PrivateKey (ES256).
+func Sign(claims any, key crypto.Signer, kid string) (string, error) {
+	var alg string
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		alg = RS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return "", errors.New("jose: only P-256 EC keys are supported")
+		}
+		alg = ES256
+	default:
+		return "", fmt.Errorf("jose: unsupported key type %T", key)
+	}
+
+	header, err := json.Marshal(Header{Alg: alg, Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		sig, err = signES256(k, digest[:])
+	}
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + b64.EncodeToString(sig), nil
+}
+
+// signES256 produces the fixed-size R||S signature JWS uses instead of the
+// ASN.1 form crypto/ecdsa returns.
+func signES256(key *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	der, err := ecdsa.SignASN1(rand.Reader, key, digest)
+	if err != nil {
+		return nil, err
+	}
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &rs); err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	rs.R.FillBytes(sig[:32])
+	rs.S.FillBytes(sig[32:])
+	return sig, nil
+}
+
+// ParseHeader decodes the header of token without verifying anything.
+func ParseHeader(token string) (Header, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Header{}, ErrMalformed
+	}
+	raw, err := b64.DecodeString(parts[0])
+	if err != nil {
+		return Header{}, ErrMalformed
+	}
+	var header Header
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return Header{}, ErrMalformed
+	}
+	return header, nil
+}
+
+// Verify checks the signature of token against keys and returns its
+// payload. The algorithm comes from the key, never from the token alone, so
+// a token cannot pick "none" or downgrade to a weaker algorithm.
+func Verify(token string, keys KeySet) ([]byte, error) {
+	header, err := ParseHeader(token)
+	if err != nil {
+		return nil, err
+	}
+	if header.Alg != RS256 && header.Alg != ES256 {
+		return nil, fmt.Errorf("jose: unsupported algorithm %q", header.Alg)
+	}
+
+	parts := strings.Split(token, ".")
+	payload, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	candidates := keys.candidates(header)
+	if len(candidates) == 0 {
+		return nil, ErrUnknownKey
+	}
+	for _, k := range candidates {
+		pub, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		if verifySignature(pub, digest[:], sig) {
+			return payload, nil
+		}
+	}
+	return nil, ErrBadSignature
+}
+
+func verifySignature(pub crypto.PublicKey, digest, sig []byte) bool {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		if len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(key, digest, r, s)
+	default:
+		return false
+	}
+}
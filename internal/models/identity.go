@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Identity links an account at an external OpenID Connect provider, named
+// by the provider's stable subject identifier, to a local user.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCLogin is the state of a login started at an external provider, kept
+// until the provider redirects back. LinkUserID is set when a signed-in user
+// links a new identity instead of logging in.
+type OIDCLogin struct {
+	State        string    `json:"-"`
+	Provider     string    `json:"provider"`
+	Nonce        string    `json:"-"`
+	CodeVerifier string    `json:"-"`
+	Persistent   bool      `json:"persistent"`
+	LinkUserID   int       `json:"link_user_id"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
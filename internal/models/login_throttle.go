@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Kinds of subjects whose failed logins are counted. ThrottleCaptcha counts
+// wrong captcha answers at registration instead.
+const (
+	ThrottleAccount = "account" // subject is the normalized email
+	ThrottleIP      = "ip"      // subject is the client IP address
+	ThrottleCaptcha = "captcha" // subject is the client IP address
+)
+
+// LoginThrottle counts recent failed password logins for one subject. The
+// counter starts over once ExpiresAt passes.
+type LoginThrottle struct {
+	Kind         string     `json:"kind"`
+	Subject      string     `json:"subject"`
+	Failures     int        `json:"failures"`
+	LastFailedAt time.Time  `json:"last_failed_at"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+}
+
+// Locked reports whether the subject is locked out at t.
+func (l *LoginThrottle) Locked(t time.Time) bool {
+	return l.LockedUntil != nil && l.LockedUntil.After(t)
+}
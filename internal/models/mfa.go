@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// TOTP is a user's authenticator app enrollment. It only protects logins
+// once Confirmed, i.e. after the user proved the app produces valid codes.
+type TOTP struct {
+	UserID    int    `json:"user_id"`
+	Secret    string `json:"-"`
+	Confirmed bool   `json:"confirmed"`
+	// LastCounter is the newest time step already used, so a code cannot
+	// be replayed.
+	LastCounter int64 `json:"-"`
+}
+
+// MFAChallenge is the pending state between a correct password and the
+// second factor. It is not a session: it only allows finishing the login.
+type MFAChallenge struct {
+	Token      string    `json:"-"`
+	UserID     int       `json:"user_id"`
+	Persistent bool      `json:"persistent"`
+	Attempts   int       `json:"attempts"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
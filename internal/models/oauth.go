@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// OAuthClient is an application registered to log its users in through this
+// server. Clients without a secret are public (single-page or native apps)
+// and rely on PKCE alone.
+type OAuthClient struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	SecretHash   string    `json:"-"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// OAuthConsent records the scopes a user has allowed a client, so the
+// consent screen is not shown again for them.
+type OAuthConsent struct {
+	UserID    int       `json:"user_id"`
+	ClientID  string    `json:"client_id"`
+	Scope     string    `json:"scope"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Kinds of OAuthAuthorization.
+const (
+	// AuthorizationRequest waits on the consent screen for the user's
+	// decision.
+	AuthorizationRequest = "request"
+	// AuthorizationCode has been approved and handed to the client, which
+	// redeems it at the token endpoint.
+	AuthorizationCode = "code"
+)
+
+// OAuthAuthorization is an authorization request by a client for a user,
+// first while it waits for consent and then as the issued authorization
+// code. Only the hash of Handle is stored.
+type OAuthAuthorization struct {
+	Handle        string    `json:"-"`
+	Kind          string    `json:"kind"`
+	ClientID      string    `json:"client_id"`
+	UserID        int       `json:"user_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Scope         string    `json:"scope"`
+	State         string    `json:"-"`
+	Nonce         string    `json:"-"`
+	CodeChallenge string    `json:"-"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// Kinds of OAuthToken.
+const (
+	OAuthAccessToken  = "access"
+	OAuthRefreshToken = "refresh"
+)
+
+// OAuthToken is an access or refresh token issued to a client. Only its
+// hash is stored.
+type OAuthToken struct {
+	Token     string    `json:"-"`
+	Kind      string    `json:"kind"`
+	ClientID  string    `json:"client_id"`
+	UserID    int       `json:"user_id"`
+	Scope     string    `json:"scope"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
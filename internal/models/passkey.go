@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Passkey is a WebAuthn credential registered by a user. CredentialID and
+// PublicKey are the raw bytes from the authenticator.
+type Passkey struct {
+	ID           string     `json:"id"`
+	UserID       int        `json:"user_id"`
+	CredentialID []byte     `json:"-"`
+	PublicKey    []byte     `json:"-"`
+	SignCount    uint32     `json:"-"`
+	Name         string     `json:"name"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
+
+// Ceremonies a WebAuthn challenge can be issued for.
+const (
+	CeremonyRegister = "register"
+	CeremonyLogin    = "login"
+)
+
+// WebAuthnChallenge is a challenge handed to the browser for one ceremony.
+// UserID is zero for passwordless logins, where the user is not known yet.
+type WebAuthnChallenge struct {
+	Challenge []byte    `json:"-"`
+	Ceremony  string    `json:"ceremony"`
+	UserID    int       `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
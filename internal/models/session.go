@@ -3,7 +3,20 @@ package models
 import "time"
 
 type Session struct {
-	Token     string    `json:"token"`
-	UserID    int       `json:"user_id"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID         string    `json:"id"`
+	Token      string    `json:"-"`
+	UserID     int       `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+
+	// AbsoluteExpiresAt caps how far activity can slide ExpiresAt.
+	AbsoluteExpiresAt time.Time `json:"absolute_expires_at"`
+
+	// Persistent sessions come from "remember me" logins: they outlive the
+	// browser and their token is rotated periodically.
+	Persistent    bool      `json:"persistent"`
+	TokenIssuedAt time.Time `json:"-"`
 }
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Purposes of one-time tokens mailed to users.
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+	TokenMagicLogin        = "magic_login"
+	TokenAccountUnlock     = "account_unlock"
+)
+
+// UserToken is a single-use token sent to a user out of band, for example in
+// a password reset link. Only its hash is stored.
+type UserToken struct {
+	Token string `json:"-"`
+	// Binding is a secret held by the browser the token was issued to. A
+	// bound token is only accepted together with it. Only its hash is
+	// stored as well.
+	Binding   string    `json:"-"`
+	Purpose   string    `json:"purpose"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
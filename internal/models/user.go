@@ -10,4 +10,8 @@ type User struct {
 	Password  string    `json:"password,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// EmailVerified is set once the user opened the verification link
+	// mailed to Email.
+	EmailVerified bool `json:"email_verified"`
 }
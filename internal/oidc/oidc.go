@@ -0,0 +1,296 @@
+// Package oidc is an OpenID Connect relying party for the authorization code
+// flow with PKCE. A Provider discovers its issuer's endpoints, builds the
+// authorization URL, exchanges the returned code and validates the ID token
+// against the issuer's published keys.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"web-app/internal/jose"
+)
+
+// maxResponseSize bounds what is read from the issuer.
+const maxResponseSize = 1 << 20
+
+// keyRefreshInterval limits how often an unknown key ID makes the provider
+// refetch the JWKS, so forged tokens cannot flood the issuer with requests.
+const keyRefreshInterval = time.Minute
+
+// Config describes one registered client at one issuer.
+type Config struct {
+	// Issuer is the issuer identifier, e.g. "https://login.example.com".
+	// Discovery is read from Issuer + "/.well-known/openid-configuration".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered with the issuer.
+	RedirectURL string
+	// Scopes defaults to openid, email and profile.
+	Scopes []string
+}
+
+// Metadata is the part of the discovery document the flow uses.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider talks to one issuer. Discovery and keys are fetched on first use
+// and cached, so a provider that is down does not stop the app from starting.
+type Provider struct {
+	Config
+	HTTPClient *http.Client
+
+	mu              sync.Mutex
+	metadata        *Metadata
+	keys            jose.KeySet
+	keysFetched     bool
+	keysRefreshedAt time.Time
+}
+
+func NewProvider(config Config) *Provider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &Provider{Config: config, HTTPClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// IDToken holds the validated claims of an ID token.
+type IDToken struct {
+	jose.Claims
+	Nonce           string       `json:"nonce"`
+	AuthorizedParty string       `json:"azp"`
+	Email           string       `json:"email"`
+	EmailVerified   flexibleBool `json:"email_verified"`
+	GivenName       string       `json:"given_name"`
+	FamilyName      string       `json:"family_name"`
+	Name            string       `json:"name"`
+}
+
+// flexibleBool accepts true and "true": some issuers send email_verified as
+// a string.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"true"`:
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// RandomString returns a URL-safe random value for state, nonce or a PKCE
+// verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge derives the S256 PKCE challenge for verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s returned %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// Discover returns the issuer's metadata, fetching it once.
+func (p *Provider) Discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	var m Metadata
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &m); err != nil {
+		return nil, fmt.Errorf("oidc: discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(m.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("oidc: discovery document is for issuer %q", m.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document lacks required endpoints")
+	}
+	p.metadata = &m
+	return p.metadata, nil
+}
+
+// AuthCodeURL returns where to send the browser to log in.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	m, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc: invalid authorization endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange trades an authorization code for tokens and returns the raw ID
+// token. It does not validate it; see VerifyIDToken.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	m, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.ClientSecret == "" {
+		form.Set("client_id", p.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc: token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&body); err != nil {
+		return "", fmt.Errorf("oidc: invalid token response (%s): %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("oidc: token request rejected: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("oidc: token response has no id_token")
+	}
+	return body.IDToken, nil
+}
+
+// keySet returns the cached JWKS. With refresh it refetches the keys,
+// unless another refresh happened within keyRefreshInterval.
+func (p *Provider) keySet(ctx context.Context, refresh bool) (jose.KeySet, error) {
+	m, err := p.Discover(ctx)
+	if err != nil {
+		return jose.KeySet{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if refresh && time.Since(p.keysRefreshedAt) < keyRefreshInterval {
+		return p.keys, nil
+	}
+	if p.keysFetched && !refresh {
+		return p.keys, nil
+	}
+	var keys jose.KeySet
+	if err := p.getJSON(ctx, m.JWKSURI, &keys); err != nil {
+		return jose.KeySet{}, fmt.Errorf("oidc: fetching keys failed: %w", err)
+	}
+	p.keys = keys
+	p.keysFetched = true
+	if refresh {
+		p.keysRefreshedAt = time.Now()
+	}
+	return keys, nil
+}
+
+// VerifyIDToken checks the signature and claims of rawIDToken: issuer,
+// audience, authorized party, validity window and that nonce matches the
+// one sent with the authorization request.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDToken, error) {
+	keys, err := p.keySet(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := jose.Verify(rawIDToken, keys)
+	if errors.Is(err, jose.ErrUnknownKey) {
+		// The issuer may have rotated its keys since the last fetch.
+		if keys, err = p.keySet(ctx, true); err != nil {
+			return nil, err
+		}
+		payload, err = jose.Verify(rawIDToken, keys)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var token IDToken
+	if err := json.Unmarshal(payload, &token); err != nil {
+		return nil, fmt.Errorf("oidc: invalid ID token claims: %w", err)
+	}
+	// p.Issuer has no trailing "/", which some providers keep in iss.
+	claims := token.Claims
+	claims.Issuer = strings.TrimSuffix(claims.Issuer, "/")
+	if err := claims.Validate(p.Issuer, p.ClientID, time.Now()); err != nil {
+		return nil, err
+	}
+	if len(token.Audience) > 1 && token.AuthorizedParty != p.ClientID {
+		return nil, errors.New("oidc: ID token has another authorized party")
+	}
+	if token.Subject == "" {
+		return nil, errors.New("oidc: ID token has no subject")
+	}
+	if nonce == "" || token.Nonce != nonce {
+		return nil, errors.New("oidc: nonce mismatch")
+	}
+	return &token, nil
+}
@@ -0,0 +1,151 @@
+// Package passhash hashes and verifies user passwords.
+//
+// New hashes use argon2id in the PHC string format
+// ($argon2id$v=19$m=...,t=...,p=...$salt$key). bcrypt hashes from before
+// argon2id keep verifying, and NeedsRehash tells when a stored hash should
+// be replaced on the next successful login.
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrMismatch is returned by Verify for a wrong password.
+var ErrMismatch = errors.New("password does not match")
+
+// ErrUnknownHash is returned for a stored hash in no supported format.
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Hasher hashes new passwords and checks passwords against stored hashes.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify checks password against a hash in any supported format. It
+	// returns ErrMismatch for a wrong password.
+	Verify(hash, password string) error
+	// NeedsRehash reports whether hash is not what Hash would produce: it
+	// uses another algorithm or other parameters.
+	NeedsRehash(hash string) bool
+}
+
+// Argon2id hashes with argon2id, as recommended by RFC 9106 and OWASP.
+type Argon2id struct {
+	// Memory is in KiB.
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2id uses the OWASP baseline: 19 MiB, two passes, one thread.
+func DefaultArgon2id() Argon2id {
+	return Argon2id{Memory: 19 * 1024, Time: 2, Threads: 1, SaltLen: 16, KeyLen: 32}
+}
+
+// Default is the hasher used when none is configured.
+var Default Hasher = DefaultArgon2id()
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+	return a.encode(salt, key), nil
+}
+
+func (a Argon2id) encode(salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func (a Argon2id) Verify(hash, password string) error {
+	return verify(hash, password)
+}
+
+func (a Argon2id) NeedsRehash(hash string) bool {
+	params, _, _, err := decodeArgon2id(hash)
+	return err != nil || params != a
+}
+
+// decodeArgon2id parses a PHC string made by Argon2id.Hash.
+func decodeArgon2id(hash string) (Argon2id, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return Argon2id{}, nil, nil, ErrUnknownHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2id{}, nil, nil, ErrUnknownHash
+	}
+	var a Argon2id
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &a.Memory, &a.Time, &a.Threads); err != nil || a.Time == 0 || a.Threads == 0 {
+		return Argon2id{}, nil, nil, ErrUnknownHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2id{}, nil, nil, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2id{}, nil, nil, ErrUnknownHash
+	}
+	a.SaltLen, a.KeyLen = uint32(len(salt)), uint32(len(key))
+	return a, salt, key, nil
+}
+
+// Bcrypt hashes with bcrypt. It is kept for existing hashes; bcrypt only
+// looks at the first 72 bytes of a password, so Hash refuses longer ones.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b Bcrypt) Verify(hash, password string) error {
+	return verify(hash, password)
+}
+
+func (b Bcrypt) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != b.Cost
+}
+
+// verify checks password against a hash from any of the hashers, so
+// switching hashers never locks anyone out.
+func verify(hash, password string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return err
+		}
+		derived := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
+		if subtle.ConstantTimeCompare(derived, key) != 1 {
+			return ErrMismatch
+		}
+		return nil
+	}
+
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return ErrUnknownHash
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatch
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+// Package ratelimit implements token bucket rate limits.
+//
+// A bucket holds up to Rule.Limit requests and refills at Limit per
+// Rule.Period. Its whole state is the time at which it will be full again,
+// which makes it cheap to keep in memory and easy to update atomically in a
+// database shared by several instances.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule allows Limit requests per Period for each key, all of them at once
+// if the key has been quiet for a whole Period.
+type Rule struct {
+	Limit  int
+	Period time.Duration
+}
+
+// Interval is the time in which the bucket regains one request.
+func (r Rule) Interval() time.Duration {
+	return r.Period / time.Duration(r.Limit)
+}
+
+// Take adds one request to a bucket that is full again at full. If the
+// request fits it returns the new full time and zero; otherwise it returns
+// full unchanged and how long the request has to wait.
+func (r Rule) Take(full, now time.Time) (time.Time, time.Duration) {
+	if full.Before(now) {
+		full = now
+	}
+	next := full.Add(r.Interval())
+	if wait := next.Sub(now) - r.Period; wait > 0 {
+		return full, wait
+	}
+	return next, 0
+}
+
+// ParseRule reads a rule written as "LIMIT/PERIOD", such as "10/1m" or
+// "100/24h".
+func ParseRule(s string) (Rule, error) {
+	limit, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("rate limit %q: expected LIMIT/PERIOD", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	if err != nil || n <= 0 {
+		return Rule{}, fmt.Errorf("rate limit %q: limit must be a positive integer", s)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || d <= 0 {
+		return Rule{}, fmt.Errorf("rate limit %q: period must be a positive duration", s)
+	}
+	return Rule{Limit: n, Period: d}, nil
+}
+
+// Limiter decides whether one more request for key fits rule. It returns
+// zero if the request may go ahead and how long to wait otherwise.
+type Limiter interface {
+	Allow(key string, rule Rule) (time.Duration, error)
+}
+
+// sweepInterval is how often Memory forgets buckets that are full again.
+const sweepInterval = time.Minute
+
+// Memory keeps the buckets in this process. Each instance of the app counts
+// on its own; use StoreLimiter when several of them share the traffic.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]time.Time // full time by key
+	lastSweep time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]time.Time)}
+}
+
+func (m *Memory) Allow(key string, rule Rule) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		// A full bucket is the same as no bucket.
+		for k, full := range m.buckets {
+			if !full.After(now) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	full, wait := rule.Take(m.buckets[key], now)
+	m.buckets[key] = full
+	return wait, nil
+}
+
+// Store keeps buckets where every instance of the app sees them.
+// database.Store implements it.
+type Store interface {
+	TakeRateLimit(key string, rule Rule) (time.Duration, error)
+}
+
+// StoreLimiter is a Limiter over a Store, shared by all instances that use
+// the same database.
+type StoreLimiter struct {
+	Store Store
+}
+
+func (s StoreLimiter) Allow(key string, rule Rule) (time.Duration, error) {
+	return s.Store.TakeRateLimit(key, rule)
+}
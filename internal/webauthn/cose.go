@@ -0,0 +1,109 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers offered to authenticators, in order of
+// preference.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+var SupportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters (RFC 9053).
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1 // n for RSA
+	coseX   = -2 // e for RSA
+	coseY   = -3
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// verifier checks a signature over data.
+type verifier func(data, sig []byte) bool
+
+// parsePublicKey decodes a COSE_Key into a verifier for its algorithm.
+func parsePublicKey(coseKey []byte) (verifier, error) {
+	decoded, rest, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("invalid public key: trailing data")
+	}
+	key, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, errors.New("invalid public key: not a map")
+	}
+
+	kty, _ := key[int64(coseKty)].(int64)
+	alg, _ := key[int64(coseAlg)].(int64)
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := key[int64(coseCrv)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		y, _ := key[int64(coseY)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid public key: bad P-256 parameters")
+		}
+		pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %w", err)
+		}
+		return func(data, sig []byte) bool {
+			digest := sha256.Sum256(data)
+			return ecdsa.VerifyASN1(pub, digest[:], sig)
+		}, nil
+
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := key[int64(coseCrv)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid public key: bad Ed25519 parameters")
+		}
+		return func(data, sig []byte) bool {
+			return ed25519.Verify(ed25519.PublicKey(x), data, sig)
+		}, nil
+
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := key[int64(coseCrv)].([]byte)
+		e, _ := key[int64(coseX)].([]byte)
+		if len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid public key: bad RSA exponent")
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("invalid public key: RSA key too small")
+		}
+		return func(data, sig []byte) bool {
+			digest := sha256.Sum256(data)
+			return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported public key type %d with algorithm %d", kty, alg)
+	}
+}
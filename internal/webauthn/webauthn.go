@@ -0,0 +1,226 @@
+// Package webauthn verifies the two WebAuthn ceremonies, registration and
+// assertion, for a single relying party. It accepts "none" attestation only:
+// the app trusts any authenticator the user chooses, so there is no
+// attestation statement to check. Challenge bookkeeping and credential
+// storage are left to the caller.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// MaxCredentialIDLength bounds the credential IDs accepted at registration.
+// The specification allows up to 1023 bytes; real authenticators use far
+// less, and a small bound keeps the ID indexable in every database.
+const MaxCredentialIDLength = 255
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+var ErrSignCountRegressed = errors.New("webauthn: signature counter did not increase; the authenticator may be cloned")
+
+// RelyingParty identifies this site to authenticators. ID is the registrable
+// domain (for example "example.com" or "localhost") and Origin the exact
+// origin pages are served from, such as "https://example.com".
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// ClientData is the part of clientDataJSON the relying party checks.
+type ClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// ParseClientData decodes clientDataJSON, so the caller can look up the
+// challenge it answers before verifying the ceremony.
+func ParseClientData(clientDataJSON []byte) (*ClientData, []byte, error) {
+	var cd ClientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return nil, nil, fmt.Errorf("webauthn: invalid client data: %w", err)
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(cd.Challenge)
+	if err != nil {
+		return nil, nil, fmt.Errorf("webauthn: invalid challenge encoding: %w", err)
+	}
+	return &cd, challenge, nil
+}
+
+func (rp RelyingParty) checkClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	cd, got, err := ParseClientData(clientDataJSON)
+	if err != nil {
+		return err
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("webauthn: unexpected client data type %q", cd.Type)
+	}
+	if subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return errors.New("webauthn: challenge mismatch")
+	}
+	if cd.Origin != rp.Origin {
+		return fmt.Errorf("webauthn: unexpected origin %q", cd.Origin)
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("webauthn: authenticator data too short")
+	}
+	ad := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if ad.flags&flagAttested == 0 {
+		return ad, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, errors.New("webauthn: attested credential data too short")
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen > len(rest) {
+		return nil, errors.New("webauthn: credential ID truncated")
+	}
+	ad.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: invalid credential public key: %w", err)
+	}
+	ad.publicKey = rest[:len(rest)-len(after)]
+	return ad, nil
+}
+
+func (rp RelyingParty) checkAuthenticatorData(ad *authenticatorData) error {
+	expected := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, expected[:]) {
+		return errors.New("webauthn: relying party ID mismatch")
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return errors.New("webauthn: user was not present")
+	}
+	return nil
+}
+
+// Credential is a newly registered public key credential. PublicKey is the
+// COSE_Key exactly as the authenticator sent it.
+type Credential struct {
+	ID           []byte
+	PublicKey    []byte
+	SignCount    uint32
+	UserVerified bool
+}
+
+// VerifyRegistration checks the response to a navigator.credentials.create()
+// call made with challenge.
+func (rp RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: invalid attestation object: %w", err)
+	}
+	att, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, errors.New("webauthn: attestation object is not a map")
+	}
+	if format, _ := att["fmt"].(string); format != "none" {
+		return nil, fmt.Errorf("webauthn: unsupported attestation format %q", format)
+	}
+	rawAuthData, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("webauthn: attestation object has no authenticator data")
+	}
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(ad); err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil {
+		return nil, errors.New("webauthn: no attested credential data")
+	}
+	if len(ad.credentialID) == 0 || len(ad.credentialID) > MaxCredentialIDLength {
+		return nil, errors.New("webauthn: unsupported credential ID length")
+	}
+	// Refuse keys that could not verify a login later.
+	if _, err := parsePublicKey(ad.publicKey); err != nil {
+		return nil, fmt.Errorf("webauthn: %w", err)
+	}
+
+	return &Credential{
+		ID:           append([]byte(nil), ad.credentialID...),
+		PublicKey:    append([]byte(nil), ad.publicKey...),
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// Assertion is the verified result of a login ceremony.
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// VerifyAssertion checks the response to a navigator.credentials.get() call
+// made with challenge, for a credential stored with publicKey and signCount.
+func (rp RelyingParty) VerifyAssertion(challenge, publicKey []byte, signCount uint32, clientDataJSON, authData, signature []byte) (*Assertion, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(ad); err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authData...), clientDataHash[:]...)
+	verify, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: %w", err)
+	}
+	if !verify(signed, signature) {
+		return nil, errors.New("webauthn: invalid signature")
+	}
+
+	// Authenticators that keep no counter always report zero.
+	if (ad.signCount != 0 || signCount != 0) && ad.signCount <= signCount {
+		return nil, ErrSignCountRegressed
+	}
+
+	return &Assertion{SignCount: ad.signCount, UserVerified: ad.flags&flagUserVerified != 0}, nil
+}
@@ -0,0 +1,152 @@
+// Package webauthntest provides a software authenticator for exercising
+// WebAuthn ceremonies in tests, in the spirit of net/http/httptest.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+)
+
+// Authenticator holds one ES256 credential. Origin and RPID are what it
+// claims in every response; tests change them to simulate phishing.
+type Authenticator struct {
+	RPID   string
+	Origin string
+	// UserVerified sets the UV flag, as after a PIN or biometric check.
+	UserVerified bool
+
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+}
+
+func New(rpID, origin string) (*Authenticator, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &Authenticator{RPID: rpID, Origin: origin, UserVerified: true, key: key, credentialID: id}, nil
+}
+
+func (a *Authenticator) CredentialID() []byte {
+	return a.credentialID
+}
+
+// SetSignCount sets the counter the next assertion increments, for example
+// to replay an old value.
+func (a *Authenticator) SetSignCount(n uint32) {
+	a.signCount = n
+}
+
+// Create answers a registration challenge with "none" attestation.
+func (a *Authenticator) Create(challenge []byte) (clientDataJSON, attestationObject []byte) {
+	clientDataJSON = a.clientData("webauthn.create", challenge)
+
+	authData := a.authData(0x40)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, a.coseKey()...)
+
+	var att []byte
+	att = appendHeader(att, 5, 3)
+	att = appendText(att, "fmt")
+	att = appendText(att, "none")
+	att = appendText(att, "attStmt")
+	att = appendHeader(att, 5, 0)
+	att = appendText(att, "authData")
+	att = appendBytes(att, authData)
+	return clientDataJSON, att
+}
+
+// Get answers a login challenge, incrementing the signature counter.
+func (a *Authenticator) Get(challenge []byte) (clientDataJSON, authData, signature []byte) {
+	a.signCount++
+	clientDataJSON = a.clientData("webauthn.get", challenge)
+	authData = a.authData(0)
+
+	hash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), hash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return clientDataJSON, authData, signature
+}
+
+func (a *Authenticator) clientData(typ string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":        typ,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+func (a *Authenticator) authData(extraFlags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	flags := byte(0x01) | extraFlags
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *Authenticator) coseKey() []byte {
+	point, err := a.key.PublicKey.Bytes()
+	if err != nil {
+		panic(err)
+	}
+	var key []byte
+	key = appendHeader(key, 5, 5)
+	key = appendInt(key, 1) // kty: EC2
+	key = appendInt(key, 2)
+	key = appendInt(key, 3) // alg: ES256
+	key = appendInt(key, -7)
+	key = appendInt(key, -1) // crv: P-256
+	key = appendInt(key, 1)
+	key = appendInt(key, -2) // x
+	key = appendBytes(key, point[1:33])
+	key = appendInt(key, -3) // y
+	key = appendBytes(key, point[33:65])
+	return key
+}
+
+func appendHeader(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major<<5|byte(n))
+	case n <= 0xff:
+		return append(b, major<<5|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, major<<5|25), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, major<<5|26), uint32(n))
+	}
+}
+
+func appendInt(b []byte, n int64) []byte {
+	if n < 0 {
+		return appendHeader(b, 1, uint64(-1-n))
+	}
+	return appendHeader(b, 0, uint64(n))
+}
+
+func appendBytes(b, data []byte) []byte {
+	return append(appendHeader(b, 2, uint64(len(data))), data...)
+}
+
+func appendText(b []byte, s string) []byte {
+	return append(appendHeader(b, 3, uint64(len(s))), s...)
+}
@@ -1,13 +1,70 @@
 package server
 
 import (
+	"crypto"
+	"log"
+	"sync"
+	"time"
+	"web-app/internal/captcha"
 	"web-app/internal/database"
+	"web-app/internal/mail"
+	"web-app/internal/models"
+	"web-app/internal/ratelimit"
 )
 
 type App struct {
-	DB *database.DB
+	DB     database.Store
+	Mailer mail.Mailer
+	Config Config
+	// OIDCProviders are the external identity providers, keyed by name.
+	OIDCProviders map[string]*OIDCProvider
+	// SigningKey signs the ID tokens this app issues as an OpenID Connect
+	// provider. Without it the authorization server endpoints are disabled.
+	SigningKey crypto.Signer
+	// OnAccountLocked, if set, is called after too many failed logins lock
+	// user's account, in addition to the email with the unlock link.
+	OnAccountLocked func(user *models.User, until time.Time)
+	// Captcha makes the challenges of GET /captcha and checks the answers
+	// sent to HandleRegister.
+	Captcha captcha.Provider
+	// CaptchaIssuer hands out the captcha IDs and redeems them. NewApp
+	// stores every captcha in DB; a captcha.Signed issuer stores only the
+	// answered ones.
+	CaptchaIssuer captcha.Issuer
+	// Limiter keeps the buckets of the RateLimit middleware. NewApp starts
+	// with one in memory; instances behind a load balancer should share a
+	// ratelimit.StoreLimiter.
+	Limiter ratelimit.Limiter
+
+	// mailing counts the emails still being sent in the background.
+	mailing sync.WaitGroup
+}
+
+func NewApp(db database.Store) *App {
+	return &App{
+		DB:            db,
+		Mailer:        mail.LogMailer{},
+		Config:        DefaultConfig(),
+		Captcha:       captcha.Image{},
+		CaptchaIssuer: captcha.Stored{Store: db},
+		Limiter:       ratelimit.NewMemory(),
+	}
+}
+
+// sendInBackground runs send without making the request wait for it and
+// logs its error under name. Handlers that mail only registered addresses
+// use it, so they answer as fast whether or not the account exists.
+func (app *App) sendInBackground(name string, send func() error) {
+	app.mailing.Add(1)
+	go func() {
+		defer app.mailing.Done()
+		if err := send(); err != nil {
+			log.Printf("DEBUG: %s Error: %v", name, err)
+		}
+	}()
 }
 
-func NewApp(db *database.DB) *App {
-	return &App{DB: db}
+// WaitForMail blocks until the emails sent in the background are out.
+func (app *App) WaitForMail() {
+	app.mailing.Wait()
 }
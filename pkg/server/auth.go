@@ -6,10 +6,28 @@ import (
 
 func (app *App) RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if _, ok := r.Context().Value("userID").(int); !ok {
+		userID, ok := r.Context().Value("userID").(int)
+		if !ok {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
+		if app.Config.UnverifiedPolicy == VerificationBlock && !app.emailVerified(userID) {
+			http.Error(w, "Email address not verified", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireVerifiedEmail guards routes that unverified users may not use under
+// the limited and block policies. It goes after RequireAuth.
+func (app *App) RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value("userID").(int)
+		if !ok || !app.emailVerified(userID) {
+			http.Error(w, "Email address not verified", http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"web-app/internal/captcha"
+	"web-app/internal/models"
+)
+
+// verifyCaptcha checks the captcha sent with a registration, or with a
+// login that needs one, and answers the request with fail if it fails.
+// Wrong answers are counted against the client IP; once CaptchaMaxFailures
+// of them fall within LoginFailureWindow the IP may not try again for
+// LoginLockoutDuration.
+func (app *App) verifyCaptcha(w http.ResponseWriter, r *http.Request, id, answer string, fail func(http.ResponseWriter, string, int)) bool {
+	ip := clientIP(r)
+	if wait := app.captchaRetryAfter(ip); wait > 0 {
+		w.Header().Set("Retry-After", retryAfterSeconds(wait))
+		fail(w, "Too many wrong captcha answers. Try again later", http.StatusTooManyRequests)
+		return false
+	}
+
+	err := app.CaptchaIssuer.Redeem(app.Captcha, id, answer)
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, captcha.ErrInvalid) {
+		log.Printf("DEBUG: Captcha Redeem Error: %v", err)
+		fail(w, "Could not verify captcha", http.StatusInternalServerError)
+		return false
+	}
+
+	if until, locked := app.countLoginFailure(models.ThrottleCaptcha, ip, app.Config.CaptchaMaxFailures); locked {
+		log.Printf("WARNING: captchas from %s locked until %s after repeated wrong answers", ip, until.Format(time.RFC3339))
+	}
+	fail(w, "Invalid captcha answer", http.StatusUnauthorized)
+	return false
+}
+
+// captchaRetryAfter returns how long ip is locked out of answering
+// captchas, or zero.
+func (app *App) captchaRetryAfter(ip string) time.Duration {
+	t, err := app.DB.GetLoginThrottle(models.ThrottleCaptcha, ip)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("DEBUG: GetLoginThrottle Error: %v", err)
+		}
+		return 0
+	}
+	if !t.Locked(time.Now()) {
+		return 0
+	}
+	return time.Until(*t.LockedUntil)
+}
@@ -0,0 +1,161 @@
+package server
+
+import "time"
+
+// VerificationPolicy decides what users who have not verified their email
+// address yet may do.
+type VerificationPolicy string
+
+const (
+	// VerificationAllow treats unverified users like everyone else.
+	VerificationAllow VerificationPolicy = "allow"
+	// VerificationLimited lets unverified users log in, but routes wrapped
+	// in RequireVerifiedEmail refuse them.
+	VerificationLimited VerificationPolicy = "limited"
+	// VerificationBlock refuses to log unverified users in, and RequireAuth
+	// rejects any session they still have.
+	VerificationBlock VerificationPolicy = "block"
+)
+
+// Config holds the tunable security policy of the HTTP layer. NewApp starts
+// from DefaultConfig; main overrides fields from the environment.
+type Config struct {
+	// SessionIdleTimeout ends a session after this long without requests.
+	SessionIdleTimeout time.Duration
+	// SessionAbsoluteTimeout ends a session this long after login, no
+	// matter how active it has been.
+	SessionAbsoluteTimeout time.Duration
+	// SessionRenewInterval is the minimum time between the writes that
+	// slide a session's idle timeout forward.
+	SessionRenewInterval time.Duration
+
+	// RememberMeIdleTimeout and RememberMeAbsoluteTimeout replace the two
+	// session timeouts for logins with "remember me" checked.
+	RememberMeIdleTimeout     time.Duration
+	RememberMeAbsoluteTimeout time.Duration
+	// RememberMeRotationInterval is how often a remembered session gets a
+	// fresh token, limiting how long a copied cookie stays useful.
+	RememberMeRotationInterval time.Duration
+
+	// BaseURL is the public origin used in links sent by email. It is never
+	// taken from the request, so a forged Host header cannot redirect them.
+	BaseURL string
+	// PasswordResetTTL is how long a password reset link stays valid.
+	PasswordResetTTL time.Duration
+	// MagicLinkTTL is how long an emailed sign-in link stays valid.
+	MagicLinkTTL time.Duration
+
+	// LoginMaxFailures is how many failed password logins an account
+	// tolerates within LoginFailureWindow before it is locked for
+	// LoginLockoutDuration. Zero disables the lockout.
+	LoginMaxFailures int
+	// LoginIPMaxFailures is the same limit for one client IP across all
+	// accounts.
+	LoginIPMaxFailures int
+	// LoginFailureWindow is how long a failed login is remembered.
+	LoginFailureWindow time.Duration
+	// LoginLockoutDuration is how long a lockout lasts unless the account
+	// is unlocked earlier.
+	LoginLockoutDuration time.Duration
+	// LoginDelayBase is the wait imposed on an account after its second
+	// failed login. It doubles with every further failure.
+	LoginDelayBase time.Duration
+	// LoginCaptchaAfter is how many recent failed logins of an account make
+	// HandleLogin ask for a captcha as well as the password. Zero never
+	// asks.
+	LoginCaptchaAfter int
+	// LoginIPCaptchaAfter is the same for one client IP across all
+	// accounts.
+	LoginIPCaptchaAfter int
+	// CaptchaMaxFailures is how many wrong captcha answers one client IP
+	// may give within LoginFailureWindow before it cannot register for
+	// LoginLockoutDuration. Zero disables the lockout.
+	CaptchaMaxFailures int
+
+	// UnverifiedPolicy applies to users whose email is not verified yet.
+	UnverifiedPolicy VerificationPolicy
+	// EmailVerificationTTL is how long an email verification link stays
+	// valid.
+	EmailVerificationTTL time.Duration
+
+	// TOTPIssuer names this service in authenticator apps.
+	TOTPIssuer string
+	// MFAChallengeTTL is how long a user has to enter the second factor
+	// after a correct password.
+	MFAChallengeTTL time.Duration
+	// MFAMaxAttempts is how many wrong codes a pending login tolerates
+	// before the password has to be entered again.
+	MFAMaxAttempts int
+
+	// WebAuthnRPID is the domain passkeys are bound to. Browsers only offer
+	// a passkey on that domain and its subdomains.
+	WebAuthnRPID string
+	// WebAuthnRPName is the site name authenticators show next to a passkey.
+	WebAuthnRPName string
+	// WebAuthnOrigin is the exact origin the login and profile pages are
+	// served from; ceremonies signed for any other origin are rejected.
+	WebAuthnOrigin string
+	// PasskeyChallengeTTL is how long the browser has to finish a passkey
+	// registration or login.
+	PasskeyChallengeTTL time.Duration
+
+	// OIDCLoginTTL is how long a user has to finish signing in at an
+	// external identity provider.
+	OIDCLoginTTL time.Duration
+
+	// OAuthConsentTTL is how long the consent screen shown to a client's
+	// user waits for a decision.
+	OAuthConsentTTL time.Duration
+	// OAuthCodeTTL is how long a client has to redeem an authorization code.
+	OAuthCodeTTL time.Duration
+	// OAuthAccessTokenTTL is the lifetime of access and ID tokens issued to
+	// clients.
+	OAuthAccessTokenTTL time.Duration
+	// OAuthRefreshTokenTTL is the lifetime of a refresh token. Every use
+	// replaces it with a new one.
+	OAuthRefreshTokenTTL time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		SessionIdleTimeout:     24 * time.Hour,
+		SessionAbsoluteTimeout: 7 * 24 * time.Hour,
+		SessionRenewInterval:   5 * time.Minute,
+
+		RememberMeIdleTimeout:      30 * 24 * time.Hour,
+		RememberMeAbsoluteTimeout:  90 * 24 * time.Hour,
+		RememberMeRotationInterval: 24 * time.Hour,
+
+		BaseURL:          "http://localhost:8080",
+		PasswordResetTTL: time.Hour,
+		MagicLinkTTL:     15 * time.Minute,
+
+		LoginMaxFailures:     5,
+		LoginIPMaxFailures:   50,
+		LoginFailureWindow:   15 * time.Minute,
+		LoginLockoutDuration: 15 * time.Minute,
+		LoginDelayBase:       time.Second,
+		LoginCaptchaAfter:    2,
+		LoginIPCaptchaAfter:  10,
+		CaptchaMaxFailures:   20,
+
+		UnverifiedPolicy:     VerificationAllow,
+		EmailVerificationTTL: 48 * time.Hour,
+
+		TOTPIssuer:      "web-app",
+		MFAChallengeTTL: 5 * time.Minute,
+		MFAMaxAttempts:  5,
+
+		WebAuthnRPID:        "localhost",
+		WebAuthnRPName:      "web-app",
+		WebAuthnOrigin:      "http://localhost:8080",
+		PasskeyChallengeTTL: 5 * time.Minute,
+
+		OIDCLoginTTL: 10 * time.Minute,
+
+		OAuthConsentTTL:      10 * time.Minute,
+		OAuthCodeTTL:         time.Minute,
+		OAuthAccessTokenTTL:  time.Hour,
+		OAuthRefreshTokenTTL: 30 * 24 * time.Hour,
+	}
+}
@@ -6,10 +6,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"time"
 	"web-app/internal/database"
 	"web-app/internal/models"
-	"web-app/internal/utils"
 	"web-app/internal/validator"
 )
 
@@ -45,12 +43,7 @@ func (app *App) HandleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var dbCaptchaAnswer string
-	err := app.DB.QueryRow("select answer from captchas where id = ? and expires_at > NOW()",
-		data.CaptchaID).Scan(&dbCaptchaAnswer)
-	if err != nil || dbCaptchaAnswer != data.CaptchaAnswer {
-		log.Printf("DEBUG: Captcha DB Lookup Error: %v", err)
-		http.Error(w, "Invalid captcha answer", http.StatusUnauthorized)
+	if !app.verifyCaptcha(w, r, data.CaptchaID, data.CaptchaAnswer, http.Error) {
 		return
 	}
 
@@ -72,33 +65,26 @@ func (app *App) HandleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sessionToken, err := utils.GenerateSecureToken(24)
-	if err != nil {
-		log.Printf("DEBUG: GenerateSecureToken Error: %v", err)
-		http.Error(w, "Failed to generate session token", http.StatusInternalServerError)
-		return
+	data.User.ID = int(userID)
+	if err := app.sendEmailVerification(&data.User); err != nil {
+		log.Printf("DEBUG: SendEmailVerification Error: %v", err)
 	}
 
-	session := &models.Session{
-		Token:     sessionToken,
-		UserID:    int(userID),
-		ExpiresAt: time.Now().Add(24 * time.Hour),
+	if app.Config.UnverifiedPolicy == VerificationBlock {
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":               "User registered successfully. Check your email to verify your address before logging in",
+			"verification_required": true,
+		})
+		return
 	}
 
-	if err := app.DB.CreateSession(session); err != nil {
+	if err := app.startSession(w, r, int(userID), false); err != nil {
 		log.Printf("DEBUG: CreateSession Error: %v", err)
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    session.Token,
-		Path:     "/",
-		HttpOnly: true,
-		Expires:  session.ExpiresAt,
-	})
-
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully"})
 }
@@ -110,50 +96,75 @@ func (app *App) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email         string `json:"email"`
+		Password      string `json:"password"`
+		RememberMe    bool   `json:"remember_me"`
+		CaptchaID     string `json:"captcha_id"`
+		CaptchaAnswer string `json:"captcha_answer"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
+	ip := clientIP(r)
+	wait, captchaRequired := app.loginRetryAfter(input.Email, ip)
+	if wait > 0 {
+		w.Header().Set("Retry-After", retryAfterSeconds(wait))
+		http.Error(w, "Too many failed login attempts. Try again later", http.StatusTooManyRequests)
+		return
+	}
+	if captchaRequired {
+		if input.CaptchaID == "" {
+			captchaRequiredError(w, "Captcha required", http.StatusUnauthorized)
+			return
+		}
+		if !app.verifyCaptcha(w, r, input.CaptchaID, input.CaptchaAnswer, captchaRequiredError) {
+			return
+		}
+	}
+
 	userID, err := app.DB.Authenticate(input.Email, input.Password)
 	if err != nil {
+		app.recordLoginFailure(input.Email, ip)
+		if _, required := app.loginRetryAfter(input.Email, ip); required {
+			captchaRequiredError(w, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
+	if app.Config.UnverifiedPolicy == VerificationBlock && !app.emailVerified(userID) {
+		http.Error(w, "Email address not verified", http.StatusForbidden)
+		return
+	}
 
-	token, err := app.DB.GetValidSessionToken(userID)
-	expiresAt := time.Now().Add(24 * time.Hour)
-
-	if err == nil && token != "" {
-		if err := app.DB.UpdateSessionExpiry(token); err != nil {
-			log.Printf("DEBUG: UpdateSessionExpiry Error: %v", err)
-			http.Error(w, "Failed to update session", http.StatusInternalServerError)
-			return
-		}
-	} else {
-		token, _ = utils.GenerateSecureToken(32)
-		session := &models.Session{
-			Token:     token,
-			UserID:    userID,
-			ExpiresAt: expiresAt,
-		}
-		if err := app.DB.CreateSession(session); err != nil {
-			log.Printf("DEBUG: CreateSession Error: %v", err)
-			http.Error(w, "Failed to create session", http.StatusInternalServerError)
+	mfaRequired, err := app.twoFactorEnabled(userID)
+	if err != nil {
+		log.Printf("DEBUG: GetTOTP Error: %v", err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	if mfaRequired {
+		if err := app.startMFAChallenge(w, userID, input.RememberMe); err != nil {
+			log.Printf("DEBUG: CreateMFAChallenge Error: %v", err)
+			http.Error(w, "Failed to log in", http.StatusInternalServerError)
 			return
 		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":      "Two-factor code required",
+			"mfa_required": true,
+		})
+		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    token,
-		Path:     "/",
-		Expires:  expiresAt,
-		HttpOnly: true,
-	})
+	if err := app.startSession(w, r, userID, input.RememberMe); err != nil {
+		log.Printf("DEBUG: CreateSession Error: %v", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	app.clearLoginFailures(input.Email)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "User logged in successfully"})
@@ -182,6 +193,7 @@ func (app *App) SessionHandler(w http.ResponseWriter, r *http.Request) {
 		"authenticated": true,
 		"firstName":     user.FirstName,
 		"lastName":      user.LastName,
+		"emailVerified": user.EmailVerified,
 	})
 }
 
@@ -191,6 +203,45 @@ func (app *App) HandleLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if token, ok := r.Context().Value("sessionToken").(string); ok {
+		if err := app.DB.DeleteSession(token); err != nil {
+			log.Printf("DEBUG: DeleteSession Error: %v", err)
+			http.Error(w, "Failed to log out", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	clearSessionCookie(w)
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "Logged out")
+}
+
+func (app *App) HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := app.DB.DeleteUserSessions(userID); err != nil {
+		log.Printf("DEBUG: DeleteUserSessions Error: %v", err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	clearSessionCookie(w)
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "Logged out from all devices")
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_token",
 		Value:    "",
@@ -198,9 +249,6 @@ func (app *App) HandleLogout(w http.ResponseWriter, r *http.Request) {
 		MaxAge:   -1,
 		HttpOnly: true,
 	})
-
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprint(w, "Logged out")
 }
 
 func (app *App) HandleUpdateName(w http.ResponseWriter, r *http.Request) {
@@ -276,6 +324,12 @@ func (app *App) HandleUpdatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := app.renewSession(w, r, userID); err != nil {
+		log.Printf("DEBUG: RenewSession Error: %v", err)
+		http.Error(w, "Failed to secure sessions", http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Password updated successfully"})
 }
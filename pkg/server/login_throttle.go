@@ -0,0 +1,217 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"web-app/internal/mail"
+	"web-app/internal/models"
+)
+
+// maxLoginDelay caps the progressive delay when the lockout is disabled.
+const maxLoginDelay = time.Minute
+
+// LoginSubject is the account key of the failure counter. It is the email
+// as typed, normalized, rather than a user ID, so unknown emails are
+// throttled exactly like registered ones and the answers give nothing away.
+func LoginSubject(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// retryAfterSeconds formats d for a Retry-After header, rounding up.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
+
+// loginDelay is how long an account must wait after its last failure,
+// given the number of recent failures. The first failure costs nothing, so
+// a typo does not slow anyone down.
+func (app *App) loginDelay(failures int) time.Duration {
+	if failures < 2 || app.Config.LoginDelayBase <= 0 {
+		return 0
+	}
+	delay := app.Config.LoginDelayBase
+	for i := 2; i < failures && delay < maxLoginDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxLoginDelay)
+}
+
+// CaptchaRequiredHeader is set on login responses when the next attempt
+// has to include a captcha_id and captcha_answer. The JSON body says the
+// same with "captcha_required": true.
+const CaptchaRequiredHeader = "X-Captcha-Required"
+
+// captchaRequiredError fails a login like http.Error, with a JSON body
+// that tells the login page to show a captcha for the next attempt.
+func captchaRequiredError(w http.ResponseWriter, message string, code int) {
+	w.Header().Set(CaptchaRequiredHeader, "true")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":          message,
+		"captcha_required": true,
+	})
+}
+
+// loginRetryAfter returns how long a password login for email from ip has
+// to wait, or zero if it may go ahead, and whether it needs a captcha.
+func (app *App) loginRetryAfter(email, ip string) (time.Duration, bool) {
+	now := time.Now()
+	var wait time.Duration
+	captchaRequired := false
+	for _, kind := range []string{models.ThrottleAccount, models.ThrottleIP} {
+		subject := ip
+		if kind == models.ThrottleAccount {
+			subject = LoginSubject(email)
+		}
+		t, err := app.DB.GetLoginThrottle(kind, subject)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("DEBUG: GetLoginThrottle Error: %v", err)
+			}
+			continue
+		}
+
+		var until time.Time
+		if t.Locked(now) {
+			until = *t.LockedUntil
+		} else if kind == models.ThrottleAccount {
+			until = t.LastFailedAt.Add(app.loginDelay(t.Failures))
+		}
+		wait = max(wait, until.Sub(now))
+
+		captchaAfter := app.Config.LoginIPCaptchaAfter
+		if kind == models.ThrottleAccount {
+			captchaAfter = app.Config.LoginCaptchaAfter
+		}
+		if captchaAfter > 0 && t.Failures >= captchaAfter {
+			captchaRequired = true
+		}
+	}
+	return wait, captchaRequired
+}
+
+// recordLoginFailure counts a wrong password against the account and the
+// client IP and locks whichever reached its limit.
+func (app *App) recordLoginFailure(email, ip string) {
+	subject := LoginSubject(email)
+	if until, locked := app.countLoginFailure(models.ThrottleAccount, subject, app.Config.LoginMaxFailures); locked {
+		log.Printf("WARNING: login for %s locked until %s after repeated failures", subject, until.Format(time.RFC3339))
+		app.notifyAccountLocked(email, until)
+	}
+	if until, locked := app.countLoginFailure(models.ThrottleIP, ip, app.Config.LoginIPMaxFailures); locked {
+		log.Printf("WARNING: logins from %s locked until %s after repeated failures", ip, until.Format(time.RFC3339))
+	}
+}
+
+// clearLoginFailures forgets the failed logins of email's account once a
+// login has fully succeeded, second factor included. Failures counted
+// against the client IP stay.
+func (app *App) clearLoginFailures(email string) {
+	if _, err := app.DB.ClearLoginThrottle(models.ThrottleAccount, LoginSubject(email)); err != nil {
+		log.Printf("DEBUG: ClearLoginThrottle Error: %v", err)
+	}
+}
+
+// countLoginFailure records one failure and reports whether it locked the
+// subject out.
+func (app *App) countLoginFailure(kind, subject string, maxFailures int) (time.Time, bool) {
+	t, err := app.DB.RecordLoginFailure(kind, subject, app.Config.LoginFailureWindow)
+	if err != nil {
+		log.Printf("DEBUG: RecordLoginFailure Error: %v", err)
+		return time.Time{}, false
+	}
+	if maxFailures <= 0 || t.Failures < maxFailures || t.Locked(time.Now()) {
+		return time.Time{}, false
+	}
+
+	until := time.Now().Add(app.Config.LoginLockoutDuration)
+	if err := app.DB.LockLogin(kind, subject, until); err != nil {
+		log.Printf("DEBUG: LockLogin Error: %v", err)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// notifyAccountLocked tells the owner of a locked account, if the email
+// belongs to one, and mails a link that lifts the lock.
+func (app *App) notifyAccountLocked(email string, until time.Time) {
+	user, err := app.DB.GetUserByEmail(email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("DEBUG: GetUserByEmail Error: %v", err)
+		}
+		return
+	}
+
+	// The login that set off the lock must not take longer than one for an
+	// unknown email.
+	app.sendInBackground("SendUnlockLink", func() error { return app.sendUnlockLink(user, until) })
+	if app.OnAccountLocked != nil {
+		app.OnAccountLocked(user, until)
+	}
+}
+
+func (app *App) sendUnlockLink(user *models.User, until time.Time) error {
+	link, err := app.issueUserToken(user.ID, models.TokenAccountUnlock, "", "/unlock-account", time.Until(until))
+	if err != nil {
+		return err
+	}
+
+	return app.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your account has been locked",
+		Body: fmt.Sprintf("Hello %s,\n\nAfter several failed login attempts, logging in to your account with a password is blocked until %s.\n\n"+
+			"If it was you, open this link to unlock the account now:\n\n%s\n\n"+
+			"If it was not you, someone may be guessing your password; consider changing it once you are logged in.\n",
+			user.FirstName, until.UTC().Format("2006-01-02 15:04 MST"), link),
+	})
+}
+
+// HandleUnlockAccount lifts a lockout with the link from the lock
+// notification. Failures counted against the client IP stay.
+func (app *App) HandleUnlockAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	token, err := app.DB.ConsumeUserToken(models.TokenAccountUnlock, input.Token, "")
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("DEBUG: ConsumeUserToken Error: %v", err)
+		}
+		http.Error(w, "Invalid or expired unlock link", http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.DB.GetUserByID(token.UserID)
+	if err != nil {
+		log.Printf("DEBUG: GetUserByID Error: %v", err)
+		http.Error(w, "Failed to unlock account", http.StatusInternalServerError)
+		return
+	}
+	if _, err := app.DB.ClearLoginThrottle(models.ThrottleAccount, LoginSubject(user.Email)); err != nil {
+		log.Printf("DEBUG: ClearLoginThrottle Error: %v", err)
+		http.Error(w, "Failed to unlock account", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account unlocked. You can log in again"})
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"web-app/internal/mail"
+	"web-app/internal/models"
+	"web-app/internal/utils"
+	"web-app/internal/validator"
+)
+
+const (
+	magicLinkCookieName = "magic_link"
+	magicLinkMessage    = "If that email is registered, a sign-in link has been sent"
+)
+
+func clearMagicLinkCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicLinkCookieName,
+		Value:    "",
+		Path:     "/login/magic",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+// HandleMagicLinkRequest mails a one-time sign-in link. The token in the
+// link is bound to a secret kept in this browser's cookie, so a link that
+// leaks from the mailbox cannot be used anywhere else. The answer and the
+// cookie are the same whether or not the email is registered.
+func (app *App) HandleMagicLinkRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if !validator.IsValidEmail(input.Email) {
+		http.Error(w, "Invalid email format", http.StatusBadRequest)
+		return
+	}
+
+	binding, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		log.Printf("DEBUG: GenerateSecureToken Error: %v", err)
+		http.Error(w, "Failed to send sign-in link", http.StatusInternalServerError)
+		return
+	}
+
+	// The link is issued and mailed in the background, so the answer does
+	// not take longer for registered addresses.
+	user, err := app.DB.GetUserByEmail(input.Email)
+	if err == nil {
+		app.sendInBackground("SendMagicLink", func() error { return app.sendMagicLink(user, binding) })
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("DEBUG: GetUserByEmail Error: %v", err)
+	}
+
+	// Strict: the link itself is opened from a mail client, but the cookie
+	// is only needed by the fetch the sign-in page makes afterwards.
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicLinkCookieName,
+		Value:    binding,
+		Path:     "/login/magic",
+		MaxAge:   int(app.Config.MagicLinkTTL / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": magicLinkMessage})
+}
+
+func (app *App) sendMagicLink(user *models.User, binding string) error {
+	link, err := app.issueUserToken(user.ID, models.TokenMagicLogin, binding, "/login/magic", app.Config.MagicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	return app.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Hello %s,\n\nOpen this link in the same browser where you asked for it to sign in:\n\n%s\n\n"+
+			"The link works once and expires in %s. If you did not ask for it, you can ignore this email.\n",
+			user.FirstName, link, app.Config.MagicLinkTTL),
+	})
+}
+
+// HandleMagicLinkLogin redeems a sign-in link. It goes through the same
+// second factor as a password login; the email address counts as verified,
+// since the link could only be read from its mailbox.
+func (app *App) HandleMagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Token      string `json:"token"`
+		RememberMe bool   `json:"remember_me"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	cookie, err := r.Cookie(magicLinkCookieName)
+	if err != nil || cookie.Value == "" {
+		http.Error(w, "Open the sign-in link in the browser where you asked for it", http.StatusBadRequest)
+		return
+	}
+
+	token, err := app.DB.ConsumeUserToken(models.TokenMagicLogin, input.Token, cookie.Value)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("DEBUG: ConsumeUserToken Error: %v", err)
+		}
+		http.Error(w, "Invalid or expired sign-in link", http.StatusBadRequest)
+		return
+	}
+	clearMagicLinkCookie(w)
+
+	if err := app.DB.MarkEmailVerified(token.UserID); err != nil {
+		log.Printf("DEBUG: MarkEmailVerified Error: %v", err)
+	}
+
+	mfaRequired, err := app.twoFactorEnabled(token.UserID)
+	if err != nil {
+		log.Printf("DEBUG: GetTOTP Error: %v", err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	if mfaRequired {
+		if err := app.startMFAChallenge(w, token.UserID, input.RememberMe); err != nil {
+			log.Printf("DEBUG: CreateMFAChallenge Error: %v", err)
+			http.Error(w, "Failed to log in", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":      "Two-factor code required",
+			"mfa_required": true,
+		})
+		return
+	}
+
+	if err := app.startSession(w, r, token.UserID, input.RememberMe); err != nil {
+		log.Printf("DEBUG: CreateSession Error: %v", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "User logged in successfully"})
+}
@@ -0,0 +1,644 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"web-app/internal/database"
+	"web-app/internal/jose"
+	"web-app/internal/models"
+	"web-app/internal/utils"
+)
+
+// Scopes clients may request, in the order they are listed back.
+var oauthScopes = []string{"openid", "profile", "email", "offline_access"}
+
+// oauthError is an error response as defined by RFC 6749. Errors with
+// redirect set go back to the client's redirect URI; the others mean the
+// client or redirect URI itself cannot be trusted, so the user sees them.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	redirect    bool
+}
+
+// parseScope splits and checks a scope parameter and returns it in
+// canonical order without duplicates.
+func parseScope(scope string) (string, bool) {
+	requested := strings.Fields(scope)
+	var parsed []string
+	for _, s := range oauthScopes {
+		if slices.Contains(requested, s) {
+			parsed = append(parsed, s)
+		}
+	}
+	for _, s := range requested {
+		if !slices.Contains(oauthScopes, s) {
+			return "", false
+		}
+	}
+	return strings.Join(parsed, " "), len(parsed) > 0
+}
+
+func hasScope(scope, s string) bool {
+	return slices.Contains(strings.Fields(scope), s)
+}
+
+// scopeCovers reports whether granted includes every scope in requested.
+func scopeCovers(granted, requested string) bool {
+	for _, s := range strings.Fields(requested) {
+		if !hasScope(granted, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// clientRedirectURL adds params and state to the client's redirect URI.
+func clientRedirectURL(redirectURI, state string, params url.Values) string {
+	u, _ := url.Parse(redirectURI)
+	q := u.Query()
+	for key, values := range params {
+		q[key] = values
+	}
+	if state != "" {
+		q.Set("state", state)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// parseAuthorizationRequest validates the parameters of an authorization
+// request. Only the authorization code flow with S256 PKCE is supported.
+func (app *App) parseAuthorizationRequest(q url.Values) (*models.OAuthAuthorization, *models.OAuthClient, *oauthError) {
+	client, err := app.DB.GetOAuthClient(q.Get("client_id"))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("DEBUG: GetOAuthClient Error: %v", err)
+			return nil, nil, &oauthError{Code: "server_error"}
+		}
+		return nil, nil, &oauthError{Code: "invalid_request", Description: "Unknown client"}
+	}
+	// The redirect URI must match a registered one exactly; anything looser
+	// would let an attacker have codes sent to their own site.
+	if !slices.Contains(client.RedirectURIs, q.Get("redirect_uri")) {
+		return nil, nil, &oauthError{Code: "invalid_request", Description: "Redirect URI not registered for this client"}
+	}
+
+	authorization := &models.OAuthAuthorization{
+		ClientID:      client.ID,
+		RedirectURI:   q.Get("redirect_uri"),
+		State:         q.Get("state"),
+		Nonce:         q.Get("nonce"),
+		CodeChallenge: q.Get("code_challenge"),
+	}
+	if len(authorization.State) > 512 || len(authorization.Nonce) > 512 {
+		authorization.State = ""
+		return authorization, client, &oauthError{Code: "invalid_request", Description: "state or nonce too long", redirect: true}
+	}
+	if q.Get("response_type") != "code" {
+		return authorization, client, &oauthError{Code: "unsupported_response_type", redirect: true}
+	}
+	scope, ok := parseScope(q.Get("scope"))
+	if !ok {
+		return authorization, client, &oauthError{Code: "invalid_scope", redirect: true}
+	}
+	authorization.Scope = scope
+	if q.Get("code_challenge_method") != "S256" || len(authorization.CodeChallenge) != 43 {
+		return authorization, client, &oauthError{Code: "invalid_request", Description: "PKCE with S256 is required", redirect: true}
+	}
+	return authorization, client, nil
+}
+
+// writeAuthorizationError reports err to the client when it can be trusted
+// with it and to the user otherwise.
+func writeAuthorizationError(w http.ResponseWriter, r *http.Request, authorization *models.OAuthAuthorization, err *oauthError) {
+	if !err.redirect {
+		message := "Invalid authorization request"
+		if err.Description != "" {
+			message += ": " + err.Description
+		}
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	params := url.Values{"error": {err.Code}}
+	if err.Description != "" {
+		params.Set("error_description", err.Description)
+	}
+	http.Redirect(w, r, clientRedirectURL(authorization.RedirectURI, authorization.State, params), http.StatusFound)
+}
+
+// issueAuthorizationCode turns an approved authorization into a code and
+// returns where to send the browser with it.
+func (app *App) issueAuthorizationCode(authorization *models.OAuthAuthorization) (string, error) {
+	code, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	issued := *authorization
+	issued.Handle = code
+	issued.Kind = models.AuthorizationCode
+	issued.ExpiresAt = time.Now().Add(app.Config.OAuthCodeTTL)
+	if err := app.DB.CreateOAuthAuthorization(&issued); err != nil {
+		return "", err
+	}
+	return clientRedirectURL(issued.RedirectURI, issued.State, url.Values{"code": {code}}), nil
+}
+
+// hasConsent reports whether the user already allowed the client the scope.
+func (app *App) hasConsent(userID int, clientID, scope string) (bool, error) {
+	consent, err := app.DB.GetOAuthConsent(userID, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return scopeCovers(consent.Scope, scope), nil
+}
+
+// HandleAuthorize is the authorization endpoint. A visitor without a
+// session is sent to the login page first. A user who already allowed the
+// client the requested scopes goes straight back to it with a code; anyone
+// else gets the consent screen. prompt=none and prompt=consent are honored.
+func (app *App) HandleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if app.SigningKey == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	authorization, _, oerr := app.parseAuthorizationRequest(r.URL.Query())
+	if oerr != nil {
+		writeAuthorizationError(w, r, authorization, oerr)
+		return
+	}
+	prompt := r.URL.Query().Get("prompt")
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		if prompt == "none" {
+			writeAuthorizationError(w, r, authorization, &oauthError{Code: "login_required", redirect: true})
+			return
+		}
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+	if app.Config.UnverifiedPolicy == VerificationBlock && !app.emailVerified(userID) {
+		writeAuthorizationError(w, r, authorization, &oauthError{Code: "access_denied", Description: "Email address not verified", redirect: true})
+		return
+	}
+	authorization.UserID = userID
+
+	if prompt != "consent" {
+		consented, err := app.hasConsent(userID, authorization.ClientID, authorization.Scope)
+		if err != nil {
+			log.Printf("DEBUG: GetOAuthConsent Error: %v", err)
+			writeAuthorizationError(w, r, authorization, &oauthError{Code: "server_error", redirect: true})
+			return
+		}
+		if consented {
+			location, err := app.issueAuthorizationCode(authorization)
+			if err != nil {
+				log.Printf("DEBUG: CreateOAuthAuthorization Error: %v", err)
+				writeAuthorizationError(w, r, authorization, &oauthError{Code: "server_error", redirect: true})
+				return
+			}
+			http.Redirect(w, r, location, http.StatusFound)
+			return
+		}
+	}
+	if prompt == "none" {
+		writeAuthorizationError(w, r, authorization, &oauthError{Code: "consent_required", redirect: true})
+		return
+	}
+
+	http.ServeFile(w, r, "./web/consent.html")
+}
+
+// HandleAuthorizeDetails is called by the consent screen with the query of
+// the authorization request. It parks the request until the user decides
+// and returns what to show. The returned request ID also keeps other sites
+// from submitting a decision in the user's name: they cannot read it.
+func (app *App) HandleAuthorizeDetails(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	authorization, client, oerr := app.parseAuthorizationRequest(r.URL.Query())
+	if oerr != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(oerr)
+		return
+	}
+
+	handle, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		log.Printf("DEBUG: GenerateSecureToken Error: %v", err)
+		http.Error(w, "Failed to start authorization", http.StatusInternalServerError)
+		return
+	}
+	authorization.Handle = handle
+	authorization.Kind = models.AuthorizationRequest
+	authorization.UserID = userID
+	authorization.ExpiresAt = time.Now().Add(app.Config.OAuthConsentTTL)
+	if err := app.DB.CreateOAuthAuthorization(authorization); err != nil {
+		log.Printf("DEBUG: CreateOAuthAuthorization Error: %v", err)
+		http.Error(w, "Failed to start authorization", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"request_id":  handle,
+		"client_name": client.Name,
+		"scopes":      strings.Fields(authorization.Scope),
+	})
+}
+
+// HandleAuthorizeDecision records the user's answer on the consent screen
+// and tells the page where to send the browser.
+func (app *App) HandleAuthorizeDecision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		RequestID string `json:"request_id"`
+		Approve   bool   `json:"approve"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.RequestID == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	authorization, err := app.DB.ConsumeOAuthAuthorization(models.AuthorizationRequest, input.RequestID)
+	if err != nil || authorization.UserID != userID {
+		http.Error(w, "Authorization request expired, please start again from the application", http.StatusBadRequest)
+		return
+	}
+
+	location := clientRedirectURL(authorization.RedirectURI, authorization.State, url.Values{"error": {"access_denied"}})
+	if input.Approve {
+		scope := authorization.Scope
+		if consent, err := app.DB.GetOAuthConsent(userID, authorization.ClientID); err == nil {
+			scope, _ = parseScope(consent.Scope + " " + scope)
+		}
+		if err := app.DB.SaveOAuthConsent(&models.OAuthConsent{UserID: userID, ClientID: authorization.ClientID, Scope: scope}); err != nil {
+			log.Printf("DEBUG: SaveOAuthConsent Error: %v", err)
+			http.Error(w, "Failed to save consent", http.StatusInternalServerError)
+			return
+		}
+		if location, err = app.issueAuthorizationCode(authorization); err != nil {
+			log.Printf("DEBUG: CreateOAuthAuthorization Error: %v", err)
+			http.Error(w, "Failed to authorize", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"redirect_to": location})
+}
+
+// writeTokenResponse writes a token endpoint reply, which must never be
+// cached.
+func writeTokenResponse(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// authenticateClient identifies the client calling the token endpoint by
+// HTTP Basic credentials, client_secret in the form, or, for public
+// clients, client_id alone.
+func (app *App) authenticateClient(w http.ResponseWriter, r *http.Request) (*models.OAuthClient, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 form-encodes the credentials before Basic encoding.
+		var errID, errSecret error
+		clientID, errID = url.QueryUnescape(clientID)
+		secret, errSecret = url.QueryUnescape(secret)
+		if errID != nil || errSecret != nil || r.PostForm.Has("client_secret") {
+			writeTokenResponse(w, http.StatusBadRequest, oauthError{Code: "invalid_request"})
+			return nil, false
+		}
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	client, err := app.DB.AuthenticateOAuthClient(clientID, secret)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, database.ErrInvalidClientSecret) {
+			log.Printf("DEBUG: AuthenticateOAuthClient Error: %v", err)
+			writeTokenResponse(w, http.StatusInternalServerError, oauthError{Code: "server_error"})
+			return nil, false
+		}
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		writeTokenResponse(w, http.StatusUnauthorized, oauthError{Code: "invalid_client"})
+		return nil, false
+	}
+	return client, true
+}
+
+// HandleToken is the token endpoint. It redeems authorization codes and
+// refresh tokens.
+func (app *App) HandleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if app.SigningKey == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeTokenResponse(w, http.StatusBadRequest, oauthError{Code: "invalid_request"})
+		return
+	}
+
+	client, ok := app.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		app.redeemAuthorizationCode(w, r, client)
+	case "refresh_token":
+		app.redeemRefreshToken(w, r, client)
+	default:
+		writeTokenResponse(w, http.StatusBadRequest, oauthError{Code: "unsupported_grant_type"})
+	}
+}
+
+func (app *App) redeemAuthorizationCode(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	authorization, err := app.DB.ConsumeOAuthAuthorization(models.AuthorizationCode, r.PostForm.Get("code"))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("DEBUG: ConsumeOAuthAuthorization Error: %v", err)
+		}
+		writeTokenResponse(w, http.StatusBadRequest, oauthError{Code: "invalid_grant"})
+		return
+	}
+	if authorization.ClientID != client.ID || authorization.RedirectURI != r.PostForm.Get("redirect_uri") {
+		writeTokenResponse(w, http.StatusBadRequest, oauthError{Code: "invalid_grant"})
+		return
+	}
+	// PKCE: only whoever started the flow knows the verifier, so an
+	// intercepted code is useless on its own.
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(authorization.CodeChallenge)) != 1 {
+		writeTokenResponse(w, http.StatusBadRequest, oauthError{Code: "invalid_grant", Description: "PKCE verification failed"})
+		return
+	}
+
+	app.issueTokens(w, client, authorization.UserID, authorization.Scope, authorization.Nonce)
+}
+
+func (app *App) redeemRefreshToken(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	// Look the token up first: another client presenting it, or a request
+	// for scopes it does not cover, must not use it up for its owner.
+	refreshToken := r.PostForm.Get("refresh_token")
+	token, err := app.DB.GetOAuthToken(models.OAuthRefreshToken, refreshToken)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("DEBUG: GetOAuthToken Error: %v", err)
+		}
+		writeTokenResponse(w, http.StatusBadRequest, oauthError{Code: "invalid_grant"})
+		return
+	}
+	if token.ClientID != client.ID {
+		writeTokenResponse(w, http.StatusBadRequest, oauthError{Code: "invalid_grant"})
+		return
+	}
+
+	// A client may ask for fewer scopes than it was granted, never more.
+	scope := token.Scope
+	if requested := r.PostForm.Get("scope"); requested != "" {
+		parsed, ok := parseScope(requested)
+		if !ok || !scopeCovers(token.Scope, parsed) {
+			writeTokenResponse(w, http.StatusBadRequest, oauthError{Code: "invalid_scope"})
+			return
+		}
+		scope = parsed
+	}
+
+	// Consuming can still lose to a concurrent redeem of the same token.
+	if _, err := app.DB.ConsumeOAuthToken(models.OAuthRefreshToken, refreshToken); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("DEBUG: ConsumeOAuthToken Error: %v", err)
+		}
+		writeTokenResponse(w, http.StatusBadRequest, oauthError{Code: "invalid_grant"})
+		return
+	}
+
+	app.issueTokens(w, client, token.UserID, scope, "")
+}
+
+// issueTokens answers the token endpoint with a new access token, a refresh
+// token for the offline_access scope and an ID token for the openid scope.
+func (app *App) issueTokens(w http.ResponseWriter, client *models.OAuthClient, userID int, scope, nonce string) {
+	user, err := app.DB.GetUserByID(userID)
+	if err != nil {
+		writeTokenResponse(w, http.StatusBadRequest, oauthError{Code: "invalid_grant"})
+		return
+	}
+	if app.Config.UnverifiedPolicy == VerificationBlock && !user.EmailVerified {
+		writeTokenResponse(w, http.StatusBadRequest, oauthError{Code: "invalid_grant", Description: "Email address not verified"})
+		return
+	}
+
+	now := time.Now()
+	response := struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		IDToken      string `json:"id_token,omitempty"`
+		Scope        string `json:"scope"`
+	}{TokenType: "Bearer", ExpiresIn: int(app.Config.OAuthAccessTokenTTL / time.Second), Scope: scope}
+
+	response.AccessToken, err = app.createOAuthToken(models.OAuthAccessToken, client, userID, scope, now.Add(app.Config.OAuthAccessTokenTTL))
+	if err == nil && hasScope(scope, "offline_access") {
+		response.RefreshToken, err = app.createOAuthToken(models.OAuthRefreshToken, client, userID, scope, now.Add(app.Config.OAuthRefreshTokenTTL))
+	}
+	if err != nil {
+		log.Printf("DEBUG: CreateOAuthToken Error: %v", err)
+		writeTokenResponse(w, http.StatusInternalServerError, oauthError{Code: "server_error"})
+		return
+	}
+
+	if hasScope(scope, "openid") {
+		claims := userClaims(user, scope)
+		claims["iss"] = app.Config.BaseURL
+		claims["aud"] = client.ID
+		claims["azp"] = client.ID
+		claims["iat"] = now.Unix()
+		claims["exp"] = now.Add(app.Config.OAuthAccessTokenTTL).Unix()
+		if nonce != "" {
+			claims["nonce"] = nonce
+		}
+		if response.IDToken, err = jose.Sign(claims, app.SigningKey, app.signingKeyID()); err != nil {
+			log.Printf("DEBUG: Sign ID Token Error: %v", err)
+			writeTokenResponse(w, http.StatusInternalServerError, oauthError{Code: "server_error"})
+			return
+		}
+	}
+
+	writeTokenResponse(w, http.StatusOK, response)
+}
+
+func (app *App) createOAuthToken(kind string, client *models.OAuthClient, userID int, scope string, expiresAt time.Time) (string, error) {
+	value, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	token := &models.OAuthToken{Token: value, Kind: kind, ClientID: client.ID, UserID: userID, Scope: scope, ExpiresAt: expiresAt}
+	if err := app.DB.CreateOAuthToken(token); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// userClaims returns what a client may learn about user with scope.
+func userClaims(user *models.User, scope string) map[string]any {
+	claims := map[string]any{"sub": strconv.Itoa(user.ID)}
+	if hasScope(scope, "profile") {
+		claims["name"] = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		claims["given_name"] = user.FirstName
+		claims["family_name"] = user.LastName
+	}
+	if hasScope(scope, "email") {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	return claims
+}
+
+// HandleUserInfo returns the claims of the user an access token was issued
+// for.
+func (app *App) HandleUserInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="oauth"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := app.DB.GetOAuthToken(models.OAuthAccessToken, accessToken)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("DEBUG: GetOAuthToken Error: %v", err)
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="oauth", error="invalid_token"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !hasScope(token.Scope, "openid") {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="oauth", error="insufficient_scope"`)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	user, err := app.DB.GetUserByID(token.UserID)
+	if err != nil {
+		log.Printf("DEBUG: GetUserByID Error: %v", err)
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(userClaims(user, token.Scope))
+}
+
+func (app *App) signingJWK() (jose.JSONWebKey, error) {
+	jwk, err := jose.NewJSONWebKey(app.SigningKey.Public(), "")
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	jwk.Kid = jwk.Thumbprint()
+	return jwk, nil
+}
+
+func (app *App) signingKeyID() string {
+	jwk, err := app.signingJWK()
+	if err != nil {
+		return ""
+	}
+	return jwk.Kid
+}
+
+// HandleJWKS publishes the public key clients verify ID tokens with.
+func (app *App) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	if app.SigningKey == nil {
+		http.NotFound(w, r)
+		return
+	}
+	jwk, err := app.signingJWK()
+	if err != nil {
+		log.Printf("DEBUG: JWKS Error: %v", err)
+		http.Error(w, "Failed to load keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jose.KeySet{Keys: []jose.JSONWebKey{jwk}})
+}
+
+// HandleOpenIDConfiguration serves the discovery document clients configure
+// themselves from.
+func (app *App) HandleOpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	if app.SigningKey == nil {
+		http.NotFound(w, r)
+		return
+	}
+	jwk, err := app.signingJWK()
+	if err != nil {
+		log.Printf("DEBUG: JWKS Error: %v", err)
+		http.Error(w, "Failed to load keys", http.StatusInternalServerError)
+		return
+	}
+
+	issuer := app.Config.BaseURL
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/oauth/userinfo",
+		"jwks_uri":                              issuer + "/oauth/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{jwk.Alg},
+		"scopes_supported":                      oauthScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "name", "given_name", "family_name", "email", "email_verified"},
+		"prompt_values_supported":               []string{"none", "consent"},
+	})
+}
@@ -0,0 +1,381 @@
+package server
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"web-app/internal/database"
+	"web-app/internal/models"
+	"web-app/internal/oidc"
+	"web-app/internal/utils"
+)
+
+const oidcStateCookieName = "oidc_state"
+
+// OIDCProvider is an external OpenID Connect provider users can sign in
+// with. Name appears in URLs and identity links and must not change once
+// users have linked accounts.
+type OIDCProvider struct {
+	Name        string
+	DisplayName string
+	// AllowSignup creates a local account on the first login of an
+	// identity that matches no existing user.
+	AllowSignup bool
+	*oidc.Provider
+}
+
+// OIDCCallbackPath is the redirect URI path registered with a provider.
+func OIDCCallbackPath(name string) string {
+	return "/login/oidc/" + name + "/callback"
+}
+
+// redirectWithError sends the browser to path with a message for the page
+// to show. The OIDC endpoints are navigations, not fetch calls, so they
+// cannot answer with a plain error body.
+func redirectWithError(w http.ResponseWriter, r *http.Request, path, message string) {
+	http.Redirect(w, r, path+"?error="+url.QueryEscape(message), http.StatusFound)
+}
+
+func clearOIDCStateCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    "",
+		Path:     "/login/oidc/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+func (app *App) HandleListOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	providers := make([]map[string]string, 0, len(app.OIDCProviders))
+	for _, p := range app.OIDCProviders {
+		providers = append(providers, map[string]string{"name": p.Name, "display_name": p.DisplayName})
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i]["name"] < providers[j]["name"] })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(providers)
+}
+
+// HandleOIDCLogin starts the authorization code flow at a provider. With
+// ?link=1 a signed-in user links the provider account to their own instead
+// of logging in.
+func (app *App) HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.OIDCProviders[r.PathValue("provider")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	login := &models.OIDCLogin{
+		Provider:   provider.Name,
+		Persistent: r.URL.Query().Get("remember_me") == "1",
+		ExpiresAt:  time.Now().Add(app.Config.OIDCLoginTTL),
+	}
+	failurePage := "/login"
+	if r.URL.Query().Get("link") == "1" {
+		userID, ok := r.Context().Value("userID").(int)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		login.LinkUserID = userID
+		failurePage = "/profile"
+	}
+
+	var err error
+	for _, value := range []*string{&login.State, &login.Nonce, &login.CodeVerifier} {
+		if *value, err = oidc.RandomString(); err != nil {
+			log.Printf("DEBUG: RandomString Error: %v", err)
+			redirectWithError(w, r, failurePage, "Failed to start sign-in")
+			return
+		}
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), login.State, login.Nonce, oidc.CodeChallenge(login.CodeVerifier))
+	if err != nil {
+		log.Printf("DEBUG: OIDC AuthCodeURL Error (%s): %v", provider.Name, err)
+		redirectWithError(w, r, failurePage, provider.DisplayName+" is not reachable right now")
+		return
+	}
+	if err := app.DB.CreateOIDCLogin(login); err != nil {
+		log.Printf("DEBUG: CreateOIDCLogin Error: %v", err)
+		redirectWithError(w, r, failurePage, "Failed to start sign-in")
+		return
+	}
+
+	// The state also lives in a cookie, so a callback URL planted by an
+	// attacker cannot finish a login in the victim's browser. Lax, because
+	// the provider's redirect back is a cross-site navigation.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    login.State,
+		Path:     "/login/oidc/",
+		MaxAge:   int(app.Config.OIDCLoginTTL / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleOIDCCallback finishes the flow: it checks state, exchanges the code
+// with the PKCE verifier, validates the ID token and logs the linked user in.
+func (app *App) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.OIDCProviders[r.PathValue("provider")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+
+	cookie, err := r.Cookie(oidcStateCookieName)
+	clearOIDCStateCookie(w)
+	if err != nil || query.Get("state") == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+		redirectWithError(w, r, "/login", "Sign-in expired, please try again")
+		return
+	}
+	login, err := app.DB.ConsumeOIDCLogin(query.Get("state"))
+	if err != nil || login.Provider != provider.Name {
+		redirectWithError(w, r, "/login", "Sign-in expired, please try again")
+		return
+	}
+	failurePage := "/login"
+	if login.LinkUserID != 0 {
+		failurePage = "/profile"
+	}
+
+	if providerError := query.Get("error"); providerError != "" {
+		log.Printf("DEBUG: OIDC provider %s returned error: %s %s", provider.Name, providerError, query.Get("error_description"))
+		redirectWithError(w, r, failurePage, "Sign-in with "+provider.DisplayName+" was cancelled or failed")
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(r.Context(), query.Get("code"), login.CodeVerifier)
+	if err != nil {
+		log.Printf("DEBUG: OIDC Exchange Error (%s): %v", provider.Name, err)
+		redirectWithError(w, r, failurePage, "Sign-in with "+provider.DisplayName+" failed")
+		return
+	}
+	idToken, err := provider.VerifyIDToken(r.Context(), rawIDToken, login.Nonce)
+	if err != nil {
+		log.Printf("DEBUG: OIDC VerifyIDToken Error (%s): %v", provider.Name, err)
+		redirectWithError(w, r, failurePage, "Sign-in with "+provider.DisplayName+" failed")
+		return
+	}
+
+	if login.LinkUserID != 0 {
+		app.linkIdentity(w, r, provider, login.LinkUserID, idToken)
+		return
+	}
+
+	userID, message := app.resolveIdentity(provider, idToken)
+	if userID == 0 {
+		redirectWithError(w, r, "/login", message)
+		return
+	}
+
+	if app.Config.UnverifiedPolicy == VerificationBlock && !app.emailVerified(userID) {
+		redirectWithError(w, r, "/login", "Email address not verified")
+		return
+	}
+
+	mfaRequired, err := app.twoFactorEnabled(userID)
+	if err != nil {
+		log.Printf("DEBUG: GetTOTP Error: %v", err)
+		redirectWithError(w, r, "/login", "Failed to log in")
+		return
+	}
+	if mfaRequired {
+		if err := app.startMFAChallenge(w, userID, login.Persistent); err != nil {
+			log.Printf("DEBUG: CreateMFAChallenge Error: %v", err)
+			redirectWithError(w, r, "/login", "Failed to log in")
+			return
+		}
+		http.Redirect(w, r, "/login?mfa=1", http.StatusFound)
+		return
+	}
+
+	if err := app.startSession(w, r, userID, login.Persistent); err != nil {
+		log.Printf("DEBUG: CreateSession Error: %v", err)
+		redirectWithError(w, r, "/login", "Failed to create session")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (app *App) linkIdentity(w http.ResponseWriter, r *http.Request, provider *OIDCProvider, userID int, idToken *oidc.IDToken) {
+	err := app.DB.CreateIdentity(&models.Identity{
+		Provider: provider.Name,
+		Subject:  idToken.Subject,
+		UserID:   userID,
+		Email:    idToken.Email,
+	})
+	if errors.Is(err, database.ErrIdentityLinked) {
+		redirectWithError(w, r, "/profile", "This "+provider.DisplayName+" account is already linked")
+		return
+	}
+	if err != nil {
+		log.Printf("DEBUG: CreateIdentity Error: %v", err)
+		redirectWithError(w, r, "/profile", "Failed to link account")
+		return
+	}
+	http.Redirect(w, r, "/profile", http.StatusFound)
+}
+
+// resolveIdentity finds the user an ID token belongs to. An unknown identity
+// is linked to the user with the same email only when the provider vouches
+// for that address; otherwise, if the provider allows it, a new account is
+// created. It returns 0 and a message for the login page when neither works.
+func (app *App) resolveIdentity(provider *OIDCProvider, idToken *oidc.IDToken) (int, string) {
+	identity, err := app.DB.GetIdentity(provider.Name, idToken.Subject)
+	if err == nil {
+		return identity.UserID, ""
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("DEBUG: GetIdentity Error: %v", err)
+		return 0, "Failed to log in"
+	}
+
+	email := strings.TrimSpace(idToken.Email)
+	var userID int
+	if email != "" && bool(idToken.EmailVerified) {
+		if user, err := app.DB.GetUserByEmail(email); err == nil {
+			// Anyone can register an address they do not own with a password
+			// they know; linking such an account would keep that password
+			// working for them.
+			if !user.EmailVerified {
+				return 0, "An account with this email already exists. Sign in with your password and link " + provider.DisplayName + " from your profile"
+			}
+			userID = user.ID
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("DEBUG: GetUserByEmail Error: %v", err)
+			return 0, "Failed to log in"
+		}
+	}
+
+	if userID == 0 {
+		if !provider.AllowSignup {
+			return 0, "No account is linked to this " + provider.DisplayName + " account"
+		}
+		if userID, err = app.createExternalUser(idToken); err != nil {
+			if errors.Is(err, database.ErrEmailAlreadyRegistered) {
+				return 0, "An account with this email already exists. Sign in with your password and link " + provider.DisplayName + " from your profile"
+			}
+			log.Printf("DEBUG: CreateUser Error: %v", err)
+			return 0, "Could not create user"
+		}
+	}
+
+	err = app.DB.CreateIdentity(&models.Identity{Provider: provider.Name, Subject: idToken.Subject, UserID: userID, Email: email})
+	if err != nil {
+		// The user already has another account of this provider linked.
+		log.Printf("DEBUG: CreateIdentity Error: %v", err)
+		return 0, "Another " + provider.DisplayName + " account is already linked to this user"
+	}
+	return userID, ""
+}
+
+// createExternalUser creates the local account for a new external
+// identity. It gets a random password nobody knows; the user can set one
+// through the password reset flow.
+func (app *App) createExternalUser(idToken *oidc.IDToken) (int, error) {
+	email := strings.TrimSpace(idToken.Email)
+	if email == "" {
+		return 0, errors.New("provider returned no email address")
+	}
+	password, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return 0, err
+	}
+
+	user := &models.User{
+		FirstName: externalName(idToken.GivenName, idToken.Name),
+		LastName:  externalName(idToken.FamilyName, ""),
+		Email:     email,
+		Password:  password,
+	}
+	id, err := app.DB.CreateUser(user)
+	if err != nil {
+		return 0, err
+	}
+	user.ID = int(id)
+
+	if idToken.EmailVerified {
+		if err := app.DB.MarkEmailVerified(user.ID); err != nil {
+			log.Printf("DEBUG: MarkEmailVerified Error: %v", err)
+		}
+	} else if err := app.sendEmailVerification(user); err != nil {
+		log.Printf("DEBUG: SendEmailVerification Error: %v", err)
+	}
+	return user.ID, nil
+}
+
+// externalName picks the first non-empty name and fits it into the users
+// table.
+func externalName(names ...string) string {
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			runes := []rune(name)
+			if len(runes) > 50 {
+				runes = runes[:50]
+			}
+			return string(runes)
+		}
+	}
+	return "-"
+}
+
+func (app *App) HandleListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	identities, err := app.DB.ListUserIdentities(userID)
+	if err != nil {
+		log.Printf("DEBUG: ListUserIdentities Error: %v", err)
+		http.Error(w, "Failed to load linked accounts", http.StatusInternalServerError)
+		return
+	}
+	if identities == nil {
+		identities = []models.Identity{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identities)
+}
+
+func (app *App) HandleDeleteIdentity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	deleted, err := app.DB.DeleteUserIdentity(userID, r.PathValue("provider"))
+	if err != nil {
+		log.Printf("DEBUG: DeleteUserIdentity Error: %v", err)
+		http.Error(w, "Failed to unlink account", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Linked account not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account unlinked"})
+}
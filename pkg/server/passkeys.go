@@ -0,0 +1,423 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"web-app/internal/database"
+	"web-app/internal/models"
+	"web-app/internal/webauthn"
+)
+
+const maxPasskeyNameLength = 100
+
+// Binary WebAuthn fields travel as unpadded base64url, the encoding the
+// browser already uses for the challenge inside clientDataJSON.
+var passkeyEncoding = base64.RawURLEncoding
+
+func decodePasskeyField(s string) ([]byte, error) {
+	return passkeyEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func (app *App) relyingParty() webauthn.RelyingParty {
+	return webauthn.RelyingParty{
+		ID:     app.Config.WebAuthnRPID,
+		Name:   app.Config.WebAuthnRPName,
+		Origin: app.Config.WebAuthnOrigin,
+	}
+}
+
+// newPasskeyChallenge stores a fresh challenge for ceremony. userID is zero
+// for logins, where the passkey itself tells who is signing in.
+func (app *App) newPasskeyChallenge(ceremony string, userID int) ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	err := app.DB.CreateWebAuthnChallenge(&models.WebAuthnChallenge{
+		Challenge: challenge,
+		Ceremony:  ceremony,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(app.Config.PasskeyChallengeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// consumePasskeyChallenge finds the challenge a ceremony response answers
+// and spends it, so a captured response cannot be replayed.
+func (app *App) consumePasskeyChallenge(clientDataJSON []byte, ceremony string) (*models.WebAuthnChallenge, error) {
+	_, challenge, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	return app.DB.ConsumeWebAuthnChallenge(challenge, ceremony)
+}
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// HandlePasskeyRegisterBegin returns the options for
+// navigator.credentials.create(). Passkeys the user already has are
+// excluded, so the same authenticator is not registered twice. A passkey
+// is a new way into the account, so a stolen session alone is not enough:
+// the password is asked for again.
+func (app *App) HandlePasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if err := app.DB.VerifyPassword(userID, input.Password); err != nil {
+		http.Error(w, "Incorrect password", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := app.DB.GetUserByID(userID)
+	if err != nil {
+		log.Printf("DEBUG: GetUserByID Error: %v", err)
+		http.Error(w, "Failed to start passkey registration", http.StatusInternalServerError)
+		return
+	}
+	passkeys, err := app.DB.ListUserPasskeys(userID)
+	if err != nil {
+		log.Printf("DEBUG: ListUserPasskeys Error: %v", err)
+		http.Error(w, "Failed to start passkey registration", http.StatusInternalServerError)
+		return
+	}
+
+	challenge, err := app.newPasskeyChallenge(models.CeremonyRegister, userID)
+	if err != nil {
+		log.Printf("DEBUG: CreateWebAuthnChallenge Error: %v", err)
+		http.Error(w, "Failed to start passkey registration", http.StatusInternalServerError)
+		return
+	}
+
+	exclude := make([]credentialDescriptor, 0, len(passkeys))
+	for _, p := range passkeys {
+		exclude = append(exclude, credentialDescriptor{Type: "public-key", ID: passkeyEncoding.EncodeToString(p.CredentialID)})
+	}
+	params := make([]map[string]interface{}, 0, len(webauthn.SupportedAlgorithms))
+	for _, alg := range webauthn.SupportedAlgorithms {
+		params = append(params, map[string]interface{}{"type": "public-key", "alg": alg})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"challenge": passkeyEncoding.EncodeToString(challenge),
+		"rp":        map[string]string{"id": app.Config.WebAuthnRPID, "name": app.Config.WebAuthnRPName},
+		"user": map[string]string{
+			"id":          passkeyEncoding.EncodeToString([]byte(strconv.Itoa(userID))),
+			"name":        user.Email,
+			"displayName": user.FirstName + " " + user.LastName,
+		},
+		"pubKeyCredParams":   params,
+		"timeout":            app.Config.PasskeyChallengeTTL.Milliseconds(),
+		"attestation":        "none",
+		"excludeCredentials": exclude,
+		"authenticatorSelection": map[string]string{
+			"residentKey":      "preferred",
+			"userVerification": "preferred",
+		},
+	})
+}
+
+// HandlePasskeyRegisterFinish verifies the authenticator's response,
+// stores the new passkey and renews the session.
+func (app *App) HandlePasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Name              string `json:"name"`
+		ClientDataJSON    string `json:"client_data_json"`
+		AttestationObject string `json:"attestation_object"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	clientDataJSON, err := decodePasskeyField(input.ClientDataJSON)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	attestationObject, err := decodePasskeyField(input.AttestationObject)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > maxPasskeyNameLength {
+		http.Error(w, "Passkey name is too long", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := app.consumePasskeyChallenge(clientDataJSON, models.CeremonyRegister)
+	if err != nil || challenge.UserID != userID {
+		http.Error(w, "Passkey registration expired, please try again", http.StatusBadRequest)
+		return
+	}
+
+	credential, err := app.relyingParty().VerifyRegistration(challenge.Challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		log.Printf("DEBUG: VerifyRegistration Error: %v", err)
+		http.Error(w, "Passkey could not be verified", http.StatusBadRequest)
+		return
+	}
+
+	passkey := models.Passkey{
+		UserID:       userID,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    credential.SignCount,
+		Name:         name,
+	}
+	if err := app.DB.CreatePasskey(&passkey); err != nil {
+		if errors.Is(err, database.ErrPasskeyExists) {
+			http.Error(w, "Passkey already registered", http.StatusConflict)
+			return
+		}
+		log.Printf("DEBUG: CreatePasskey Error: %v", err)
+		http.Error(w, "Failed to save passkey", http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.renewSession(w, r, userID); err != nil {
+		log.Printf("DEBUG: RenewSession Error: %v", err)
+		http.Error(w, "Failed to secure sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(passkey)
+}
+
+func (app *App) HandleListPasskeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	passkeys, err := app.DB.ListUserPasskeys(userID)
+	if err != nil {
+		log.Printf("DEBUG: ListUserPasskeys Error: %v", err)
+		http.Error(w, "Failed to load passkeys", http.StatusInternalServerError)
+		return
+	}
+	if passkeys == nil {
+		passkeys = []models.Passkey{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(passkeys)
+}
+
+// HandleDeletePasskey removes one of the user's passkeys after asking for
+// the password again, and renews the session.
+func (app *App) HandleDeletePasskey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if err := app.DB.VerifyPassword(userID, input.Password); err != nil {
+		http.Error(w, "Incorrect password", http.StatusUnauthorized)
+		return
+	}
+
+	deleted, err := app.DB.DeleteUserPasskey(userID, r.PathValue("id"))
+	if err != nil {
+		log.Printf("DEBUG: DeleteUserPasskey Error: %v", err)
+		http.Error(w, "Failed to remove passkey", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Passkey not found", http.StatusNotFound)
+		return
+	}
+
+	if err := app.renewSession(w, r, userID); err != nil {
+		log.Printf("DEBUG: RenewSession Error: %v", err)
+		http.Error(w, "Failed to secure sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Passkey removed"})
+}
+
+// HandlePasskeyLoginBegin returns the options for
+// navigator.credentials.get(). No email is asked for: the browser offers
+// whichever passkeys it holds for this site.
+func (app *App) HandlePasskeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	challenge, err := app.newPasskeyChallenge(models.CeremonyLogin, 0)
+	if err != nil {
+		log.Printf("DEBUG: CreateWebAuthnChallenge Error: %v", err)
+		http.Error(w, "Failed to start passkey login", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"challenge":        passkeyEncoding.EncodeToString(challenge),
+		"rpId":             app.Config.WebAuthnRPID,
+		"timeout":          app.Config.PasskeyChallengeTTL.Milliseconds(),
+		"userVerification": "preferred",
+	})
+}
+
+// HandlePasskeyLoginFinish verifies a signed assertion and logs the owner of
+// the passkey in. A passkey that verified the user (PIN or biometrics)
+// counts as two factors; otherwise users with two-factor authentication
+// still have to enter a code.
+func (app *App) HandlePasskeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		CredentialID      string `json:"credential_id"`
+		ClientDataJSON    string `json:"client_data_json"`
+		AuthenticatorData string `json:"authenticator_data"`
+		Signature         string `json:"signature"`
+		RememberMe        bool   `json:"remember_me"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	var fields [4][]byte
+	for i, s := range []string{input.CredentialID, input.ClientDataJSON, input.AuthenticatorData, input.Signature} {
+		b, err := decodePasskeyField(s)
+		if err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		fields[i] = b
+	}
+	credentialID, clientDataJSON, authData, signature := fields[0], fields[1], fields[2], fields[3]
+
+	challenge, err := app.consumePasskeyChallenge(clientDataJSON, models.CeremonyLogin)
+	if err != nil {
+		http.Error(w, "Passkey login expired, please try again", http.StatusUnauthorized)
+		return
+	}
+
+	passkey, err := app.DB.GetPasskeyByCredentialID(credentialID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("DEBUG: GetPasskeyByCredentialID Error: %v", err)
+		}
+		http.Error(w, "Invalid passkey", http.StatusUnauthorized)
+		return
+	}
+
+	assertion, err := app.relyingParty().VerifyAssertion(challenge.Challenge, passkey.PublicKey, passkey.SignCount,
+		clientDataJSON, authData, signature)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCountRegressed) {
+			log.Printf("WARNING: passkey %s of user %d reported a stale signature counter", passkey.ID, passkey.UserID)
+		} else {
+			log.Printf("DEBUG: VerifyAssertion Error: %v", err)
+		}
+		http.Error(w, "Invalid passkey", http.StatusUnauthorized)
+		return
+	}
+	if err := app.DB.UpdatePasskeyUsage(passkey.ID, assertion.SignCount, time.Now()); err != nil {
+		log.Printf("DEBUG: UpdatePasskeyUsage Error: %v", err)
+	}
+
+	userID := passkey.UserID
+	if app.Config.UnverifiedPolicy == VerificationBlock && !app.emailVerified(userID) {
+		http.Error(w, "Email address not verified", http.StatusForbidden)
+		return
+	}
+
+	if !assertion.UserVerified {
+		mfaRequired, err := app.twoFactorEnabled(userID)
+		if err != nil {
+			log.Printf("DEBUG: GetTOTP Error: %v", err)
+			http.Error(w, "Failed to log in", http.StatusInternalServerError)
+			return
+		}
+		if mfaRequired {
+			if err := app.startMFAChallenge(w, userID, input.RememberMe); err != nil {
+				log.Printf("DEBUG: CreateMFAChallenge Error: %v", err)
+				http.Error(w, "Failed to log in", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":      "Two-factor code required",
+				"mfa_required": true,
+			})
+			return
+		}
+	}
+
+	if err := app.startSession(w, r, userID, input.RememberMe); err != nil {
+		log.Printf("DEBUG: CreateSession Error: %v", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "User logged in successfully"})
+}
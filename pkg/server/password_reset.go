@@ -0,0 +1,130 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"web-app/internal/mail"
+	"web-app/internal/models"
+	"web-app/internal/validator"
+)
+
+const forgotPasswordMessage = "If that email is registered, a reset link has been sent"
+
+// HandleForgotPassword mails a password reset link. It answers the same way
+// whether or not the email belongs to an account, so it cannot be used to
+// find out who is registered.
+func (app *App) HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if !validator.IsValidEmail(input.Email) {
+		http.Error(w, "Invalid email format", http.StatusBadRequest)
+		return
+	}
+
+	// The link is issued and mailed in the background, so the answer does
+	// not take longer for registered addresses.
+	user, err := app.DB.GetUserByEmail(input.Email)
+	if err == nil {
+		app.sendInBackground("SendPasswordReset", func() error { return app.sendPasswordReset(user) })
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("DEBUG: GetUserByEmail Error: %v", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": forgotPasswordMessage})
+}
+
+func (app *App) sendPasswordReset(user *models.User) error {
+	link, err := app.issueUserToken(user.ID, models.TokenPasswordReset, "", "/reset-password", app.Config.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return app.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nSomeone asked to reset the password of your account. Open this link to choose a new one:\n\n%s\n\n"+
+			"The link works once and expires in %s. If you did not ask for it, you can ignore this email.\n",
+			user.FirstName, link, app.Config.PasswordResetTTL),
+	})
+}
+
+func (app *App) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if !validator.IsValidPassword(input.NewPassword) {
+		http.Error(w, "Invalid password format", http.StatusBadRequest)
+		return
+	}
+
+	token, err := app.DB.ConsumeUserToken(models.TokenPasswordReset, input.Token, "")
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("DEBUG: ConsumeUserToken Error: %v", err)
+		}
+		http.Error(w, "Invalid or expired reset link", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.DB.UpdatePassword(token.UserID, input.NewPassword); err != nil {
+		log.Printf("DEBUG: UpdatePassword Error: %v", err)
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+
+	// The link arrived by email, which proves the address as well.
+	if err := app.DB.MarkEmailVerified(token.UserID); err != nil {
+		log.Printf("DEBUG: MarkEmailVerified Error: %v", err)
+	}
+
+	if err := app.DB.DeleteUserSessions(token.UserID); err != nil {
+		log.Printf("DEBUG: DeleteUserSessions Error: %v", err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	if err := app.DB.DeleteUserOAuthTokens(token.UserID); err != nil {
+		log.Printf("DEBUG: DeleteUserOAuthTokens Error: %v", err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	// Whoever had the account may have added a passkey of their own.
+	if err := app.DB.DeleteUserPasskeys(token.UserID); err != nil {
+		log.Printf("DEBUG: DeleteUserPasskeys Error: %v", err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	if err := app.DB.DeleteUserTokens(token.UserID, models.TokenPasswordReset); err != nil {
+		log.Printf("DEBUG: DeleteUserTokens Error: %v", err)
+	}
+	clearSessionCookie(w)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password reset successfully"})
+}
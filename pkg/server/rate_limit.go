@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"web-app/internal/ratelimit"
+)
+
+// maxRateLimitBody is how much of a request body LimitByAccount reads to
+// find the email.
+const maxRateLimitBody = 64 << 10
+
+// RateLimitKey picks the key a request is counted under, such as the client
+// IP. An empty key leaves the request out of that limit.
+type RateLimitKey func(r *http.Request) string
+
+// RateLimit is one limit on a route: each key picked by Key gets its own
+// bucket with Rule. Routes with the same Name share buckets. A zero Rule
+// turns the limit off.
+type RateLimit struct {
+	Name string
+	Key  RateLimitKey
+	Rule ratelimit.Rule
+}
+
+// LimitByIP counts requests per client IP.
+func LimitByIP(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// LimitByAccount counts requests per email in a JSON body, normalized like
+// the login failure counter, whether or not the account exists. The body
+// is left for the handler to read again.
+func LimitByAccount(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRateLimitBody))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil {
+		return ""
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(body, &input) != nil || LoginSubject(input.Email) == "" {
+		return ""
+	}
+	return "account:" + LoginSubject(input.Email)
+}
+
+// LimitBySession counts requests per login session. It goes after
+// SessionLoader; requests without a session are not counted.
+func LimitBySession(r *http.Request) string {
+	sessionID, ok := r.Context().Value("sessionID").(string)
+	if !ok || sessionID == "" {
+		return ""
+	}
+	return "session:" + sessionID
+}
+
+// RateLimit wraps a route in limits. A request over any of them gets 429
+// with Retry-After and never reaches the handler. If the limiter fails the
+// request goes ahead, so a storage outage does not lock everyone out.
+func (app *App) RateLimit(limits ...RateLimit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, limit := range limits {
+				if limit.Rule.Limit <= 0 || app.Limiter == nil {
+					continue
+				}
+				key := limit.Key(r)
+				if key == "" {
+					continue
+				}
+
+				wait, err := app.Limiter.Allow(limit.Name+"|"+key, limit.Rule)
+				if err != nil {
+					log.Printf("DEBUG: RateLimit Error: %v", err)
+					continue
+				}
+				if wait > 0 {
+					w.Header().Set("Retry-After", retryAfterSeconds(wait))
+					http.Error(w, "Too many requests. Try again later", http.StatusTooManyRequests)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
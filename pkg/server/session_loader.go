@@ -2,7 +2,9 @@ package server
 
 import (
 	"context"
+	"log"
 	"net/http"
+	"time"
 )
 
 func (app *App) SessionLoader(next http.Handler) http.Handler {
@@ -13,13 +15,34 @@ func (app *App) SessionLoader(next http.Handler) http.Handler {
 			return
 		}
 
-		userID, err := app.DB.GetUserIDByToken(cookie.Value)
+		session, err := app.DB.GetSessionByToken(cookie.Value)
 		if err != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "userID", userID)
+		now := time.Now()
+
+		// Slide the idle timeout, but write at most once per renew interval
+		// so an active browser does not update its row on every request.
+		if now.Sub(session.LastSeenAt) >= app.Config.SessionRenewInterval {
+			if err := app.DB.RenewSession(session.ID, now, app.idleExpiry(session, now)); err != nil {
+				log.Printf("DEBUG: RenewSession Error: %v", err)
+			}
+		}
+
+		token := cookie.Value
+		if session.Persistent && now.Sub(session.TokenIssuedAt) >= app.Config.RememberMeRotationInterval {
+			if rotated, err := app.rotateSessionToken(w, session, true); err != nil {
+				log.Printf("DEBUG: RotateSessionToken Error: %v", err)
+			} else {
+				token = rotated
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), "userID", session.UserID)
+		ctx = context.WithValue(ctx, "sessionID", session.ID)
+		ctx = context.WithValue(ctx, "sessionToken", token)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
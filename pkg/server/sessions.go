@@ -0,0 +1,198 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+	"web-app/internal/models"
+	"web-app/internal/utils"
+)
+
+const maxUserAgentLength = 255
+
+// startSession mints a new session for userID, records which device asked for
+// it and sets the session cookie. Persistent sessions come from "remember me"
+// and use the longer remember-me timeouts.
+func (app *App) startSession(w http.ResponseWriter, r *http.Request, userID int, persistent bool) error {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return err
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	now := time.Now()
+	_, absoluteTimeout := app.sessionTimeouts(persistent)
+	session := &models.Session{
+		Token:             token,
+		UserID:            userID,
+		UserAgent:         userAgent,
+		IPAddress:         clientIP(r),
+		AbsoluteExpiresAt: now.Add(absoluteTimeout),
+		Persistent:        persistent,
+	}
+	session.ExpiresAt = app.idleExpiry(session, now)
+	if err := app.DB.CreateSession(session); err != nil {
+		return err
+	}
+
+	app.setSessionCookie(w, session)
+	return nil
+}
+
+// setSessionCookie writes the cookie for session.Token. Only persistent
+// sessions get Expires; everything else is a browser-session cookie that
+// disappears when the browser closes. The server enforces the timeouts either
+// way.
+func (app *App) setSessionCookie(w http.ResponseWriter, session *models.Session) {
+	cookie := &http.Cookie{
+		Name:     "session_token",
+		Value:    session.Token,
+		Path:     "/",
+		HttpOnly: true,
+	}
+	if session.Persistent {
+		cookie.Expires = session.AbsoluteExpiresAt
+	}
+	http.SetCookie(w, cookie)
+}
+
+func (app *App) sessionTimeouts(persistent bool) (idle, absolute time.Duration) {
+	if persistent {
+		return app.Config.RememberMeIdleTimeout, app.Config.RememberMeAbsoluteTimeout
+	}
+	return app.Config.SessionIdleTimeout, app.Config.SessionAbsoluteTimeout
+}
+
+// idleExpiry is when session, active at now, goes idle, capped at its
+// absolute expiry.
+func (app *App) idleExpiry(session *models.Session, now time.Time) time.Time {
+	idleTimeout, _ := app.sessionTimeouts(session.Persistent)
+	expiresAt := now.Add(idleTimeout)
+	if expiresAt.After(session.AbsoluteExpiresAt) {
+		return session.AbsoluteExpiresAt
+	}
+	return expiresAt
+}
+
+// rotateSessionToken gives session a new token and sends it to the browser.
+// keepPrevious lets the old token work for a short grace period.
+func (app *App) rotateSessionToken(w http.ResponseWriter, session *models.Session, keepPrevious bool) (string, error) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := app.DB.RotateSessionToken(session.ID, token, time.Now(), keepPrevious); err != nil {
+		return "", err
+	}
+
+	session.Token = token
+	app.setSessionCookie(w, session)
+	return token, nil
+}
+
+// renewSession runs after a password or privilege change. It revokes every
+// other session of userID and moves the current one to a fresh token with no
+// grace period, so a cookie stolen before the change stops working at once.
+// Without a current session it revokes them all. Tokens issued to OAuth
+// clients are revoked as well.
+func (app *App) renewSession(w http.ResponseWriter, r *http.Request, userID int) error {
+	if err := app.DB.DeleteUserOAuthTokens(userID); err != nil {
+		return err
+	}
+
+	token, _ := r.Context().Value("sessionToken").(string)
+	if token == "" {
+		return app.DB.DeleteUserSessions(userID)
+	}
+
+	session, err := app.DB.GetSessionByToken(token)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && session.UserID != userID) {
+		return app.DB.DeleteUserSessions(userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := app.DB.DeleteOtherUserSessions(userID, session.ID); err != nil {
+		return err
+	}
+	_, err = app.rotateSessionToken(w, session, false)
+	return err
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type sessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+func (app *App) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	currentID, _ := r.Context().Value("sessionID").(string)
+
+	sessions, err := app.DB.ListUserSessions(userID)
+	if err != nil {
+		log.Printf("DEBUG: ListUserSessions Error: %v", err)
+		http.Error(w, "Failed to load sessions", http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]sessionView, 0, len(sessions))
+	for _, s := range sessions {
+		views = append(views, sessionView{Session: s, Current: s.ID == currentID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+func (app *App) HandleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	deleted, err := app.DB.DeleteUserSession(userID, id)
+	if err != nil {
+		log.Printf("DEBUG: DeleteUserSession Error: %v", err)
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if currentID, _ := r.Context().Value("sessionID").(string); currentID == id {
+		clearSessionCookie(w)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked"})
+}
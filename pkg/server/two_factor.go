@@ -0,0 +1,419 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"web-app/internal/database"
+	"web-app/internal/models"
+	"web-app/internal/totp"
+	"web-app/internal/utils"
+)
+
+const (
+	mfaCookieName     = "mfa_challenge"
+	recoveryCodeCount = 10
+)
+
+// twoFactorEnabled reports whether userID has a confirmed authenticator.
+func (app *App) twoFactorEnabled(userID int) (bool, error) {
+	t, err := app.DB.GetTOTP(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return t.Confirmed, nil
+}
+
+// startMFAChallenge parks a login whose password was correct until the
+// second factor arrives. The challenge token lives in its own cookie that
+// only the second login step can read.
+func (app *App) startMFAChallenge(w http.ResponseWriter, userID int, persistent bool) error {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return err
+	}
+	err = app.DB.CreateMFAChallenge(&models.MFAChallenge{
+		Token:      token,
+		UserID:     userID,
+		Persistent: persistent,
+		ExpiresAt:  time.Now().Add(app.Config.MFAChallengeTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     mfaCookieName,
+		Value:    token,
+		Path:     "/login/mfa",
+		MaxAge:   int(app.Config.MFAChallengeTTL / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+func clearMFACookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     mfaCookieName,
+		Value:    "",
+		Path:     "/login/mfa",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused
+// recovery code. Both are spent on success.
+func (app *App) checkSecondFactor(userID int, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		return app.DB.UseRecoveryCode(userID, recoveryCode)
+	}
+
+	t, err := app.DB.GetTOTP(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil || !t.Confirmed {
+		return false, err
+	}
+	counter, ok := totp.Verify(t.Secret, code, time.Now(), t.LastCounter)
+	if !ok {
+		return false, nil
+	}
+	return app.DB.UseTOTPCounter(userID, counter)
+}
+
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		h := hex.EncodeToString(b)
+		codes[i] = h[0:4] + "-" + h[4:8] + "-" + h[8:12] + "-" + h[12:16]
+	}
+	return codes, nil
+}
+
+// HandleLoginMFA is the second login step for users with two-factor
+// authentication. It expects the cookie set by HandleLogin and either a code
+// from the authenticator app or a recovery code.
+func (app *App) HandleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	cookie, err := r.Cookie(mfaCookieName)
+	if err != nil {
+		http.Error(w, "Login expired, please sign in again", http.StatusUnauthorized)
+		return
+	}
+	challenge, err := app.DB.GetMFAChallenge(cookie.Value)
+	if err != nil {
+		clearMFACookie(w)
+		http.Error(w, "Login expired, please sign in again", http.StatusUnauthorized)
+		return
+	}
+
+	// Wrong codes count against the account like wrong passwords, so
+	// starting a new login after every MFAMaxAttempts misses does not give
+	// unlimited guesses.
+	user, err := app.DB.GetUserByID(challenge.UserID)
+	if err != nil {
+		log.Printf("DEBUG: GetUserByID Error: %v", err)
+		http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	ip := clientIP(r)
+	if wait, _ := app.loginRetryAfter(user.Email, ip); wait > 0 {
+		w.Header().Set("Retry-After", retryAfterSeconds(wait))
+		http.Error(w, "Too many failed login attempts. Try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	ok, err := app.checkSecondFactor(challenge.UserID, input.Code, input.RecoveryCode)
+	if err != nil {
+		log.Printf("DEBUG: CheckSecondFactor Error: %v", err)
+		http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		app.recordLoginFailure(user.Email, ip)
+		attempts, err := app.DB.RecordMFAFailure(cookie.Value)
+		if err != nil || attempts >= app.Config.MFAMaxAttempts {
+			app.DB.DeleteMFAChallenge(cookie.Value)
+			clearMFACookie(w)
+			http.Error(w, "Too many invalid codes, please sign in again", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := app.DB.DeleteMFAChallenge(cookie.Value); err != nil {
+		log.Printf("DEBUG: DeleteMFAChallenge Error: %v", err)
+	}
+	clearMFACookie(w)
+
+	if err := app.startSession(w, r, challenge.UserID, challenge.Persistent); err != nil {
+		log.Printf("DEBUG: CreateSession Error: %v", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	app.clearLoginFailures(user.Email)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "User logged in successfully"})
+}
+
+func (app *App) HandleTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enabled, err := app.twoFactorEnabled(userID)
+	if err != nil {
+		log.Printf("DEBUG: GetTOTP Error: %v", err)
+		http.Error(w, "Failed to load two-factor status", http.StatusInternalServerError)
+		return
+	}
+	remaining := 0
+	if enabled {
+		if remaining, err = app.DB.CountRecoveryCodes(userID); err != nil {
+			log.Printf("DEBUG: CountRecoveryCodes Error: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":                  enabled,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// HandleTwoFactorSetup starts enrollment with a new secret. Nothing changes
+// for logins until HandleTwoFactorConfirm sees a valid code.
+func (app *App) HandleTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := app.DB.GetUserByID(userID)
+	if err != nil {
+		log.Printf("DEBUG: GetUserByID Error: %v", err)
+		http.Error(w, "Failed to start two-factor setup", http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Printf("DEBUG: GenerateSecret Error: %v", err)
+		http.Error(w, "Failed to start two-factor setup", http.StatusInternalServerError)
+		return
+	}
+	if err := app.DB.SetTOTPSecret(userID, secret); err != nil {
+		if errors.Is(err, database.ErrTOTPAlreadyEnabled) {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		log.Printf("DEBUG: SetTOTPSecret Error: %v", err)
+		http.Error(w, "Failed to start two-factor setup", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(app.Config.TOTPIssuer, user.Email, secret),
+	})
+}
+
+// HandleTwoFactorConfirm enables two-factor authentication once the user
+// proves their app produces valid codes, and hands out the recovery codes.
+func (app *App) HandleTwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	t, err := app.DB.GetTOTP(userID)
+	if err != nil || t.Confirmed {
+		http.Error(w, "No pending two-factor setup", http.StatusBadRequest)
+		return
+	}
+	counter, ok := totp.Verify(t.Secret, input.Code, time.Now(), t.LastCounter)
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	if confirmed, err := app.DB.ConfirmTOTP(userID, counter); err != nil || !confirmed {
+		log.Printf("DEBUG: ConfirmTOTP Error: %v", err)
+		http.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := app.replaceRecoveryCodes(userID)
+	if err != nil {
+		log.Printf("DEBUG: ReplaceRecoveryCodes Error: %v", err)
+		http.Error(w, "Failed to create recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.renewSession(w, r, userID); err != nil {
+		log.Printf("DEBUG: RenewSession Error: %v", err)
+		http.Error(w, "Failed to secure sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+func (app *App) replaceRecoveryCodes(userID int) ([]string, error) {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := app.DB.ReplaceRecoveryCodes(userID, codes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// HandleTwoFactorDisable turns two-factor authentication off. A stolen
+// session alone is not enough: it needs the password and a current code or
+// recovery code.
+func (app *App) HandleTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.DB.VerifyPassword(userID, input.Password); err != nil {
+		http.Error(w, "Incorrect password", http.StatusUnauthorized)
+		return
+	}
+	if ok, err := app.checkSecondFactor(userID, input.Code, input.RecoveryCode); err != nil || !ok {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := app.DB.DeleteTOTP(userID); err != nil {
+		log.Printf("DEBUG: DeleteTOTP Error: %v", err)
+		http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.renewSession(w, r, userID); err != nil {
+		log.Printf("DEBUG: RenewSession Error: %v", err)
+		http.Error(w, "Failed to secure sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// HandleRegenerateRecoveryCodes replaces all recovery codes after asking for
+// the password again.
+func (app *App) HandleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.DB.VerifyPassword(userID, input.Password); err != nil {
+		http.Error(w, "Incorrect password", http.StatusUnauthorized)
+		return
+	}
+	if enabled, err := app.twoFactorEnabled(userID); err != nil || !enabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := app.replaceRecoveryCodes(userID)
+	if err != nil {
+		log.Printf("DEBUG: ReplaceRecoveryCodes Error: %v", err)
+		http.Error(w, "Failed to create recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"recovery_codes": codes})
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/url"
+	"time"
+	"web-app/internal/models"
+	"web-app/internal/utils"
+)
+
+// issueUserToken creates a single-use token for userID and returns the link
+// that redeems it at path. A non-empty binding ties the token to the browser
+// holding that secret. Earlier tokens with the same purpose are deleted, so
+// only the newest link works.
+func (app *App) issueUserToken(userID int, purpose, binding, path string, ttl time.Duration) (string, error) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := app.DB.DeleteUserTokens(userID, purpose); err != nil {
+		return "", err
+	}
+	err = app.DB.CreateUserToken(&models.UserToken{
+		Token:     token,
+		Purpose:   purpose,
+		UserID:    userID,
+		Binding:   binding,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return app.Config.BaseURL + path + "?token=" + url.QueryEscape(token), nil
+}
@@ -1,16 +1,31 @@
 package main
 
 import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 	"web-app/internal/api"
+	"web-app/internal/captcha"
 	"web-app/internal/database"
+	"web-app/internal/jose"
+	"web-app/internal/mail"
+	"web-app/internal/oidc"
+	"web-app/internal/passhash"
+	"web-app/internal/ratelimit"
+	"web-app/internal/utils"
 	"web-app/pkg/server"
 
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func main() {
@@ -22,22 +37,142 @@ func main() {
 	dsn := os.Getenv("DB_DSN")
 	port := os.Getenv("PORT")
 
-	db, err := database.InitDB("mysql", dsn)
+	driver := os.Getenv("DB_DRIVER")
+	if driver == "" {
+		driver, dsn = database.DriverFromDSN(dsn)
+	}
+
+	db, err := database.InitDB(driver, dsn)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
-	log.Println("Database connection established")
+	log.Printf("Database connection established (%s)", db.Dialect)
 
 	defer db.Close()
 
-	customDB := &database.DB{DB: db.DB}
-	app := server.NewApp(customDB)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(db, os.Args[2:])
+		return
+	}
+
+	if os.Getenv("DB_AUTO_MIGRATE") != "false" {
+		applied, err := db.MigrateUp()
+		if err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
+		log.Printf("Database schema up to date (%d migration(s) applied)", applied)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "oauth-client" {
+		runOAuthClient(db, os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "unlock" {
+		runUnlock(db, os.Args[2:])
+		return
+	}
+
+	sessionSecret := os.Getenv("SESSION_SECRET")
+	if sessionSecret == "" {
+		sessionSecret, err = utils.GenerateSecureToken(32)
+		if err != nil {
+			log.Fatalf("Failed to generate session secret: %v", err)
+		}
+		log.Println("SESSION_SECRET not set; using a random key, sessions will not survive a restart")
+	}
+	db.TokenKey = []byte(sessionSecret)
+	db.Passwords = passwordHasherFromEnv()
+
+	app := server.NewApp(db)
+	app.Config.SessionIdleTimeout = durationEnv("SESSION_IDLE_TIMEOUT", app.Config.SessionIdleTimeout)
+	app.Config.SessionAbsoluteTimeout = durationEnv("SESSION_ABSOLUTE_TIMEOUT", app.Config.SessionAbsoluteTimeout)
+	app.Config.SessionRenewInterval = durationEnv("SESSION_RENEW_INTERVAL", app.Config.SessionRenewInterval)
+	app.Config.RememberMeIdleTimeout = durationEnv("REMEMBER_ME_IDLE_TIMEOUT", app.Config.RememberMeIdleTimeout)
+	app.Config.RememberMeAbsoluteTimeout = durationEnv("REMEMBER_ME_ABSOLUTE_TIMEOUT", app.Config.RememberMeAbsoluteTimeout)
+	app.Config.RememberMeRotationInterval = durationEnv("REMEMBER_ME_ROTATION_INTERVAL", app.Config.RememberMeRotationInterval)
+	app.Config.PasswordResetTTL = durationEnv("PASSWORD_RESET_TTL", app.Config.PasswordResetTTL)
+	app.Config.MagicLinkTTL = durationEnv("MAGIC_LINK_TTL", app.Config.MagicLinkTTL)
+	app.Config.LoginMaxFailures = intEnv("LOGIN_MAX_FAILURES", app.Config.LoginMaxFailures)
+	app.Config.LoginIPMaxFailures = intEnv("LOGIN_IP_MAX_FAILURES", app.Config.LoginIPMaxFailures)
+	app.Config.LoginFailureWindow = durationEnv("LOGIN_FAILURE_WINDOW", app.Config.LoginFailureWindow)
+	app.Config.LoginLockoutDuration = durationEnv("LOGIN_LOCKOUT_DURATION", app.Config.LoginLockoutDuration)
+	app.Config.LoginDelayBase = durationEnv("LOGIN_DELAY_BASE", app.Config.LoginDelayBase)
+	app.Config.LoginCaptchaAfter = intEnv("LOGIN_CAPTCHA_AFTER", app.Config.LoginCaptchaAfter)
+	app.Config.LoginIPCaptchaAfter = intEnv("LOGIN_IP_CAPTCHA_AFTER", app.Config.LoginIPCaptchaAfter)
+	app.Config.CaptchaMaxFailures = intEnv("CAPTCHA_MAX_FAILURES", app.Config.CaptchaMaxFailures)
+	app.Config.BaseURL = "http://localhost:" + port
+	if baseURL := os.Getenv("APP_BASE_URL"); baseURL != "" {
+		app.Config.BaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+	app.Mailer = mailerFromEnv()
+	app.Config.MFAChallengeTTL = durationEnv("MFA_CHALLENGE_TTL", app.Config.MFAChallengeTTL)
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		app.Config.TOTPIssuer = issuer
+	}
+	app.Config.WebAuthnOrigin = app.Config.BaseURL
+	if origin := os.Getenv("WEBAUTHN_ORIGIN"); origin != "" {
+		app.Config.WebAuthnOrigin = strings.TrimSuffix(origin, "/")
+	}
+	app.Config.WebAuthnRPID = os.Getenv("WEBAUTHN_RP_ID")
+	if app.Config.WebAuthnRPID == "" {
+		originURL, err := url.Parse(app.Config.WebAuthnOrigin)
+		if err != nil || originURL.Hostname() == "" {
+			log.Fatalf("Invalid WEBAUTHN_ORIGIN %q", app.Config.WebAuthnOrigin)
+		}
+		app.Config.WebAuthnRPID = originURL.Hostname()
+	}
+	if name := os.Getenv("WEBAUTHN_RP_NAME"); name != "" {
+		app.Config.WebAuthnRPName = name
+	}
+	app.Config.OIDCLoginTTL = durationEnv("OIDC_LOGIN_TTL", app.Config.OIDCLoginTTL)
+	app.OIDCProviders = oidcProvidersFromEnv(app.Config.BaseURL)
+	app.SigningKey = signingKeyFromEnv()
+	app.Config.OAuthConsentTTL = durationEnv("OAUTH_CONSENT_TTL", app.Config.OAuthConsentTTL)
+	app.Config.OAuthCodeTTL = durationEnv("OAUTH_CODE_TTL", app.Config.OAuthCodeTTL)
+	app.Config.OAuthAccessTokenTTL = durationEnv("OAUTH_ACCESS_TOKEN_TTL", app.Config.OAuthAccessTokenTTL)
+	app.Config.OAuthRefreshTokenTTL = durationEnv("OAUTH_REFRESH_TOKEN_TTL", app.Config.OAuthRefreshTokenTTL)
+	app.Config.EmailVerificationTTL = durationEnv("EMAIL_VERIFICATION_TTL", app.Config.EmailVerificationTTL)
+	if policy := os.Getenv("EMAIL_VERIFICATION_POLICY"); policy != "" {
+		switch p := server.VerificationPolicy(policy); p {
+		case server.VerificationAllow, server.VerificationLimited, server.VerificationBlock:
+			app.Config.UnverifiedPolicy = p
+		default:
+			log.Fatalf("Invalid EMAIL_VERIFICATION_POLICY %q", policy)
+		}
+	}
+	app.Captcha = captchaFromEnv()
+	if widget, ok := app.Captcha.(captcha.Siteverify); ok {
+		app.CaptchaIssuer = widget
+	} else {
+		app.CaptchaIssuer = captchaIssuerFromEnv(db, sessionSecret)
+	}
+	switch limiter := os.Getenv("RATE_LIMIT_STORE"); limiter {
+	case "", "memory":
+	case "database":
+		app.Limiter = ratelimit.StoreLimiter{Store: db}
+	default:
+		log.Fatalf("Invalid RATE_LIMIT_STORE %q", limiter)
+	}
+
+	captchaLimit := app.RateLimit(rateLimitFromEnv("CAPTCHA_IP", "captcha", server.LimitByIP, "30/1m"))
+	registerLimit := app.RateLimit(rateLimitFromEnv("REGISTER_IP", "register", server.LimitByIP, "10/1h"))
+	loginLimit := app.RateLimit(
+		rateLimitFromEnv("LOGIN_IP", "login", server.LimitByIP, "30/1m"),
+		rateLimitFromEnv("LOGIN_ACCOUNT", "login", server.LimitByAccount, "10/1m"),
+	)
+	mailLimit := app.RateLimit(
+		rateLimitFromEnv("MAIL_IP", "mail", server.LimitByIP, "20/1h"),
+		rateLimitFromEnv("MAIL_ACCOUNT", "mail", server.LimitByAccount, "5/1h"),
+	)
+	passwordLimit := app.RateLimit(rateLimitFromEnv("PASSWORD_SESSION", "password", server.LimitBySession, "10/1h"))
+	passkeyLimit := app.RateLimit(rateLimitFromEnv("PASSKEY_IP", "passkey", server.LimitByIP, "30/1m"))
 
 	go func() {
 		log.Println("Started session cleanup goroutine in the background")
 
 		runCleanup := func() {
-			if err := customDB.CleanupExpired(); err != nil {
+			if err := db.CleanupExpired(); err != nil {
 				log.Printf("Error cleaning up expired rows: %v", err)
 				return
 			}
@@ -56,6 +191,8 @@ func main() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /", app.HomeHandler)
 	mux.Handle("GET /api/session", app.SessionLoader(http.HandlerFunc(app.SessionHandler)))
+	mux.Handle("GET /api/sessions", app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleListSessions))))
+	mux.Handle("DELETE /api/sessions/{id}", app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleDeleteSession))))
 
 	mux.Handle("GET /register", app.SessionLoader(app.RedirectIfAuthenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "./web/register.html")
@@ -63,21 +200,339 @@ func main() {
 	mux.Handle("GET /login", app.SessionLoader(app.RedirectIfAuthenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "./web/login.html")
 	}))))
+	mux.HandleFunc("GET /login/magic", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./web/magic-link.html")
+	})
+	mux.HandleFunc("GET /forgot-password", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./web/forgot-password.html")
+	})
+	mux.HandleFunc("GET /reset-password", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./web/reset-password.html")
+	})
+	mux.HandleFunc("GET /verify-email", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./web/verify-email.html")
+	})
+	mux.HandleFunc("GET /unlock-account", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./web/unlock-account.html")
+	})
 
 	fileServer := http.FileServer(http.Dir("./web/static"))
 	mux.Handle("GET /static/", http.StripPrefix("/static/", fileServer))
-	mux.HandleFunc("GET /captcha", api.HandleCaptcha(customDB))
+	mux.Handle("GET /captcha", captchaLimit(api.HandleCaptchaFrom(app.CaptchaIssuer, app.Captcha)))
 
-	mux.HandleFunc("POST /register", app.HandleRegister)
-	mux.HandleFunc("POST /login", app.HandleLogin)
-	mux.HandleFunc("POST /logout", app.HandleLogout)
+	mux.Handle("POST /register", registerLimit(http.HandlerFunc(app.HandleRegister)))
+	mux.Handle("POST /login", loginLimit(http.HandlerFunc(app.HandleLogin)))
+	mux.Handle("POST /login/mfa", loginLimit(http.HandlerFunc(app.HandleLoginMFA)))
+	mux.Handle("POST /login/magic", mailLimit(http.HandlerFunc(app.HandleMagicLinkRequest)))
+	mux.Handle("POST /login/magic/verify", loginLimit(http.HandlerFunc(app.HandleMagicLinkLogin)))
+	mux.HandleFunc("POST /login/unlock", app.HandleUnlockAccount)
+	mux.HandleFunc("GET /api/oidc/providers", app.HandleListOIDCProviders)
+	mux.Handle("GET /login/oidc/{provider}", app.SessionLoader(http.HandlerFunc(app.HandleOIDCLogin)))
+	mux.HandleFunc("GET /login/oidc/{provider}/callback", app.HandleOIDCCallback)
+	mux.Handle("POST /login/passkey/begin", passkeyLimit(http.HandlerFunc(app.HandlePasskeyLoginBegin)))
+	mux.Handle("POST /login/passkey/finish", loginLimit(http.HandlerFunc(app.HandlePasskeyLoginFinish)))
+	mux.HandleFunc("GET /.well-known/openid-configuration", app.HandleOpenIDConfiguration)
+	mux.HandleFunc("GET /oauth/jwks", app.HandleJWKS)
+	mux.Handle("GET /oauth/authorize", app.SessionLoader(http.HandlerFunc(app.HandleAuthorize)))
+	mux.Handle("GET /api/oauth/authorize", app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleAuthorizeDetails))))
+	mux.Handle("POST /api/oauth/authorize", app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleAuthorizeDecision))))
+	mux.HandleFunc("POST /oauth/token", app.HandleToken)
+	mux.HandleFunc("GET /oauth/userinfo", app.HandleUserInfo)
+	mux.HandleFunc("POST /oauth/userinfo", app.HandleUserInfo)
+	mux.Handle("POST /logout", app.SessionLoader(http.HandlerFunc(app.HandleLogout)))
+	mux.Handle("POST /password/forgot", mailLimit(http.HandlerFunc(app.HandleForgotPassword)))
+	mux.HandleFunc("POST /password/reset", app.HandleResetPassword)
+	mux.HandleFunc("POST /email/verify", app.HandleVerifyEmail)
+	mux.Handle("POST /email/verify/resend", app.SessionLoader(mailLimit(http.HandlerFunc(app.HandleResendVerification))))
+	mux.Handle("POST /logout/all", app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleLogoutAll))))
 
 	mux.Handle("GET /profile", app.SessionLoader(app.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "./web/profile.html")
 	}))))
-	mux.Handle("PUT /profile/updateName", app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleUpdateName))))
-	mux.Handle("PUT /profile/updatePassword", app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleUpdatePassword))))
+	mux.Handle("PUT /profile/updateName", app.SessionLoader(app.RequireAuth(app.RequireVerifiedEmail(http.HandlerFunc(app.HandleUpdateName)))))
+	mux.Handle("GET /api/2fa", app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleTwoFactorStatus))))
+	mux.Handle("POST /api/2fa/setup", app.SessionLoader(app.RequireAuth(app.RequireVerifiedEmail(http.HandlerFunc(app.HandleTwoFactorSetup)))))
+	mux.Handle("POST /api/2fa/confirm", app.SessionLoader(app.RequireAuth(app.RequireVerifiedEmail(http.HandlerFunc(app.HandleTwoFactorConfirm)))))
+	mux.Handle("POST /api/2fa/disable", app.SessionLoader(app.RequireAuth(app.RequireVerifiedEmail(passwordLimit(http.HandlerFunc(app.HandleTwoFactorDisable))))))
+	mux.Handle("POST /api/2fa/recovery-codes", app.SessionLoader(app.RequireAuth(app.RequireVerifiedEmail(passwordLimit(http.HandlerFunc(app.HandleRegenerateRecoveryCodes))))))
+	mux.Handle("GET /api/passkeys", app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleListPasskeys))))
+	mux.Handle("POST /api/passkeys/register/begin", app.SessionLoader(app.RequireAuth(app.RequireVerifiedEmail(passwordLimit(http.HandlerFunc(app.HandlePasskeyRegisterBegin))))))
+	mux.Handle("POST /api/passkeys/register/finish", app.SessionLoader(app.RequireAuth(app.RequireVerifiedEmail(http.HandlerFunc(app.HandlePasskeyRegisterFinish)))))
+	mux.Handle("DELETE /api/passkeys/{id}", app.SessionLoader(app.RequireAuth(passwordLimit(http.HandlerFunc(app.HandleDeletePasskey)))))
+	mux.Handle("GET /api/identities", app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleListIdentities))))
+	mux.Handle("DELETE /api/identities/{provider}", app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleDeleteIdentity))))
+	mux.Handle("PUT /profile/updatePassword", app.SessionLoader(app.RequireAuth(app.RequireVerifiedEmail(passwordLimit(http.HandlerFunc(app.HandleUpdatePassword))))))
 
 	log.Printf("Server is running on port %s", port)
 	http.ListenAndServe(":"+port, mux)
 }
+
+// durationEnv reads a time.ParseDuration value such as "30m" or "168h" from
+// the environment, falling back when it is unset.
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", name, value, err)
+	}
+	return d
+}
+
+// intEnv reads a non-negative integer from the environment, falling back
+// when it is unset.
+func intEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatalf("Invalid %s %q: expected a non-negative integer", name, value)
+	}
+	return n
+}
+
+// captchaFromEnv picks the captcha named by CAPTCHA_PROVIDER: "image"
+// (default), "audio", "pow" or "math", or a third-party widget,
+// "turnstile", "hcaptcha" or "recaptcha". CAPTCHA_LENGTH sets the digits of
+// image and audio challenges and CAPTCHA_POW_DIFFICULTY the leading zero
+// bits of a proof of work.
+func captchaFromEnv() captcha.Provider {
+	length := intEnv("CAPTCHA_LENGTH", 0)
+	if length > 10 {
+		// captchas.answer is VARCHAR(10).
+		log.Fatalf("Invalid CAPTCHA_LENGTH %d: at most 10", length)
+	}
+	provider := os.Getenv("CAPTCHA_PROVIDER")
+	if captcha.SupportsSiteverify(provider) {
+		return siteverifyFromEnv(provider)
+	}
+	switch provider {
+	case "", "image":
+		return captcha.Image{Length: length}
+	case "audio":
+		return captcha.Audio{Length: length}
+	case "pow":
+		difficulty := intEnv("CAPTCHA_POW_DIFFICULTY", 0)
+		if difficulty > 32 {
+			log.Fatalf("Invalid CAPTCHA_POW_DIFFICULTY %d: at most 32", difficulty)
+		}
+		return captcha.ProofOfWork{Difficulty: difficulty}
+	case "math":
+		return captcha.Math{}
+	default:
+		log.Fatalf("Invalid CAPTCHA_PROVIDER %q", provider)
+		return nil
+	}
+}
+
+// siteverifyFromEnv configures a third-party widget from
+// CAPTCHA_SITE_KEY and CAPTCHA_SECRET_KEY, both required, and the optional
+// CAPTCHA_SITEVERIFY_URL, CAPTCHA_HOSTNAMES (comma separated) and
+// CAPTCHA_SITEVERIFY_TIMEOUT.
+func siteverifyFromEnv(typ string) captcha.Siteverify {
+	widget := captcha.Siteverify{
+		Type:    typ,
+		SiteKey: os.Getenv("CAPTCHA_SITE_KEY"),
+		Secret:  os.Getenv("CAPTCHA_SECRET_KEY"),
+		URL:     os.Getenv("CAPTCHA_SITEVERIFY_URL"),
+		Timeout: durationEnv("CAPTCHA_SITEVERIFY_TIMEOUT", 5*time.Second),
+	}
+	if widget.SiteKey == "" || widget.Secret == "" {
+		log.Fatalf("CAPTCHA_PROVIDER=%s needs CAPTCHA_SITE_KEY and CAPTCHA_SECRET_KEY", typ)
+	}
+	for _, host := range strings.Split(os.Getenv("CAPTCHA_HOSTNAMES"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			widget.Hostnames = append(widget.Hostnames, host)
+		}
+	}
+	return widget
+}
+
+// captchaIssuerFromEnv picks where captchas are kept. CAPTCHA_STORE
+// "database" (default) stores each issued captcha; "signed" issues HMAC
+// tokens under the session secret and remembers only answered ones, in
+// memory or, with CAPTCHA_REPLAY_STORE=database, in the database shared by
+// all instances.
+func captchaIssuerFromEnv(db *database.DB, secret string) captcha.Issuer {
+	switch mode := os.Getenv("CAPTCHA_STORE"); mode {
+	case "", "database":
+		return captcha.Stored{Store: db}
+	case "signed":
+	default:
+		log.Fatalf("Invalid CAPTCHA_STORE %q", mode)
+	}
+
+	signed := captcha.Signed{Key: []byte(secret)}
+	switch replay := os.Getenv("CAPTCHA_REPLAY_STORE"); replay {
+	case "", "memory":
+		signed.Replay = captcha.NewMemoryReplay()
+	case "database":
+		signed.Replay = db
+	default:
+		log.Fatalf("Invalid CAPTCHA_REPLAY_STORE %q", replay)
+	}
+	return signed
+}
+
+// rateLimitFromEnv builds a rate limit whose rule is read from
+// RATE_LIMIT_<env> as "LIMIT/PERIOD", such as "10/1m"; "off" turns the
+// limit off.
+func rateLimitFromEnv(env, name string, key server.RateLimitKey, fallback string) server.RateLimit {
+	limit := server.RateLimit{Name: name, Key: key}
+	value := os.Getenv("RATE_LIMIT_" + env)
+	if value == "" {
+		value = fallback
+	}
+	if value == "off" {
+		return limit
+	}
+	rule, err := ratelimit.ParseRule(value)
+	if err != nil {
+		log.Fatalf("Invalid RATE_LIMIT_%s: %v", env, err)
+	}
+	limit.Rule = rule
+	return limit
+}
+
+// passwordHasherFromEnv picks the hasher for new passwords named by
+// PASSWORD_HASHER: "argon2id" (default), tuned by ARGON2_MEMORY (KiB),
+// ARGON2_TIME and ARGON2_THREADS, or "bcrypt" with BCRYPT_COST. Hashes made
+// by the other one keep working and are replaced on the next login.
+func passwordHasherFromEnv() passhash.Hasher {
+	switch hasher := os.Getenv("PASSWORD_HASHER"); hasher {
+	case "", "argon2id":
+		params := passhash.DefaultArgon2id()
+		params.Memory = uint32(intEnv("ARGON2_MEMORY", int(params.Memory)))
+		params.Time = uint32(intEnv("ARGON2_TIME", int(params.Time)))
+		threads := intEnv("ARGON2_THREADS", int(params.Threads))
+		if params.Time == 0 || threads == 0 || threads > 255 || params.Memory < 8*uint32(threads) {
+			log.Fatalf("Invalid argon2id parameters: ARGON2_TIME must be positive, ARGON2_THREADS 1 to 255 and ARGON2_MEMORY at least 8 KiB per thread")
+		}
+		params.Threads = uint8(threads)
+		return params
+	case "bcrypt":
+		cost := intEnv("BCRYPT_COST", bcrypt.DefaultCost)
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			log.Fatalf("Invalid BCRYPT_COST %d: expected %d to %d", cost, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return passhash.Bcrypt{Cost: cost}
+	default:
+		log.Fatalf("Invalid PASSWORD_HASHER %q", hasher)
+		return nil
+	}
+}
+
+// mailerFromEnv picks the mailer named by MAIL_DRIVER: "log" (default),
+// "file" (writes .eml files to MAIL_DIR) or "smtp".
+func mailerFromEnv() mail.Mailer {
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "", "log":
+		return mail.LogMailer{}
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./mail"
+		}
+		return mail.FileMailer{Dir: dir}
+	case "smtp":
+		return mail.SMTPMailer{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			From:     os.Getenv("MAIL_FROM"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	default:
+		log.Fatalf("Invalid MAIL_DRIVER %q", driver)
+		return nil
+	}
+}
+
+// oidcProvidersFromEnv reads the providers listed in OIDC_PROVIDERS, a
+// comma-separated list of names. Each name NAME is configured through
+// OIDC_NAME_ISSUER, OIDC_NAME_CLIENT_ID, OIDC_NAME_CLIENT_SECRET and the
+// optional OIDC_NAME_DISPLAY_NAME, OIDC_NAME_SCOPES and
+// OIDC_NAME_ALLOW_SIGNUP.
+func oidcProvidersFromEnv(baseURL string) map[string]*server.OIDCProvider {
+	providers := make(map[string]*server.OIDCProvider)
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if strings.Trim(name, "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+			log.Fatalf("Invalid OIDC provider name %q: use lowercase letters and digits", name)
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		config := oidc.Config{
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  baseURL + server.OIDCCallbackPath(name),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			log.Fatalf("OIDC provider %q needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		displayName := os.Getenv(prefix + "DISPLAY_NAME")
+		if displayName == "" {
+			displayName = name
+		}
+		providers[name] = &server.OIDCProvider{
+			Name:        name,
+			DisplayName: displayName,
+			AllowSignup: os.Getenv(prefix+"ALLOW_SIGNUP") == "true",
+			Provider:    oidc.NewProvider(config),
+		}
+	}
+	return providers
+}
+
+// signingKeyFromEnv loads the key ID tokens are signed with from the PEM file
+// named by OAUTH_SIGNING_KEY_FILE: an RSA or P-256 private key in PKCS #8,
+// PKCS #1 or SEC 1 form. Without it a random RSA key is generated.
+func signingKeyFromEnv() crypto.Signer {
+	path := os.Getenv("OAUTH_SIGNING_KEY_FILE")
+	if path == "" {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			log.Fatalf("Failed to generate signing key: %v", err)
+		}
+		log.Println("OAUTH_SIGNING_KEY_FILE not set; using a random key, ID tokens will not verify after a restart")
+		return key
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read OAUTH_SIGNING_KEY_FILE: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		log.Fatalf("OAUTH_SIGNING_KEY_FILE %q is not PEM encoded", path)
+	}
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		log.Fatalf("Unsupported key type %q in OAUTH_SIGNING_KEY_FILE", block.Type)
+	}
+	if err != nil {
+		log.Fatalf("Invalid OAUTH_SIGNING_KEY_FILE: %v", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		log.Fatalf("Unsupported key in OAUTH_SIGNING_KEY_FILE")
+	}
+	if _, err := jose.NewJSONWebKey(signer.Public(), ""); err != nil {
+		log.Fatalf("Unsupported key in OAUTH_SIGNING_KEY_FILE: %v", err)
+	}
+	return signer
+}
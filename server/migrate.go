@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"web-app/internal/database"
+)
+
+// runMigrate implements "migrate up|down|status". up applies every pending
+// migration, down rolls back the latest one.
+func runMigrate(db *database.DB, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: server migrate up|down|status")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp()
+		if err != nil {
+			log.Fatalf("Migrate up failed: %v", err)
+		}
+		log.Printf("Applied %d migration(s)", applied)
+	case "down":
+		rolledBack, err := db.MigrateDown()
+		if err != nil {
+			log.Fatalf("Migrate down failed: %v", err)
+		}
+		if !rolledBack {
+			log.Println("No migrations to roll back")
+			return
+		}
+		log.Println("Rolled back the latest migration")
+	case "status":
+		status, err := db.MigrationStatus()
+		if err != nil {
+			log.Fatalf("Migrate status failed: %v", err)
+		}
+		for _, s := range status {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, state)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n", args[0])
+		os.Exit(2)
+	}
+}
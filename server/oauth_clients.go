@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"web-app/internal/database"
+	"web-app/internal/models"
+	"web-app/internal/utils"
+)
+
+// stringList collects a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runOAuthClient implements "oauth-client add|list|remove", which manages
+// the applications allowed to log users in through this server.
+func runOAuthClient(db *database.DB, args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "usage: server oauth-client add -name NAME -redirect-uri URI [-redirect-uri URI ...] [-public]")
+		fmt.Fprintln(os.Stderr, "       server oauth-client list")
+		fmt.Fprintln(os.Stderr, "       server oauth-client remove CLIENT_ID")
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+
+	switch args[0] {
+	case "add":
+		flags := flag.NewFlagSet("oauth-client add", flag.ExitOnError)
+		name := flags.String("name", "", "name shown on the consent screen")
+		public := flags.Bool("public", false, "register a public client (no secret, PKCE only)")
+		var redirectURIs stringList
+		flags.Var(&redirectURIs, "redirect-uri", "allowed redirect URI (repeatable)")
+		flags.Parse(args[1:])
+
+		if *name == "" || len(redirectURIs) == 0 {
+			usage()
+		}
+		for _, uri := range redirectURIs {
+			u, err := url.Parse(uri)
+			if err != nil || !u.IsAbs() || u.Fragment != "" || strings.ContainsAny(uri, " \t\n") {
+				log.Fatalf("Invalid redirect URI %q: it must be absolute and have no fragment", uri)
+			}
+		}
+
+		secret := ""
+		if !*public {
+			var err error
+			if secret, err = utils.GenerateSecureToken(32); err != nil {
+				log.Fatalf("Failed to generate client secret: %v", err)
+			}
+		}
+		client := &models.OAuthClient{Name: *name, RedirectURIs: redirectURIs}
+		if err := db.CreateOAuthClient(client, secret); err != nil {
+			log.Fatalf("Failed to create client: %v", err)
+		}
+		fmt.Printf("client_id:     %s\n", client.ID)
+		if secret != "" {
+			fmt.Printf("client_secret: %s\n", secret)
+			fmt.Println("The secret is shown only once; store it now.")
+		}
+	case "list":
+		clients, err := db.ListOAuthClients()
+		if err != nil {
+			log.Fatalf("Failed to list clients: %v", err)
+		}
+		for _, c := range clients {
+			kind := "confidential"
+			if c.SecretHash == "" {
+				kind = "public"
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", c.ID, c.Name, kind, strings.Join(c.RedirectURIs, " "))
+		}
+	case "remove":
+		if len(args) != 2 {
+			usage()
+		}
+		deleted, err := db.DeleteOAuthClient(args[1])
+		if err != nil {
+			log.Fatalf("Failed to remove client: %v", err)
+		}
+		if !deleted {
+			log.Fatalf("No client %q", args[1])
+		}
+		log.Printf("Removed client %s and revoked its tokens", args[1])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown oauth-client command %q\n", args[0])
+		os.Exit(2)
+	}
+}
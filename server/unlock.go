@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"web-app/internal/database"
+	"web-app/internal/models"
+	"web-app/pkg/server"
+)
+
+// runUnlock implements "unlock EMAIL|IP", which lifts a lockout after too
+// many failed logins, or for an IP also after too many wrong captcha
+// answers, before it runs out and forgets the failures counted so far.
+func runUnlock(db *database.DB, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: server unlock EMAIL|IP")
+		os.Exit(2)
+	}
+
+	kinds, subject := []string{models.ThrottleAccount}, server.LoginSubject(args[0])
+	if ip := net.ParseIP(args[0]); ip != nil {
+		kinds, subject = []string{models.ThrottleIP, models.ThrottleCaptcha}, ip.String()
+	}
+	cleared := false
+	for _, kind := range kinds {
+		ok, err := db.ClearLoginThrottle(kind, subject)
+		if err != nil {
+			log.Fatalf("Failed to unlock %s: %v", args[0], err)
+		}
+		cleared = cleared || ok
+	}
+	if !cleared {
+		log.Printf("No failures recorded for %s", subject)
+		return
+	}
+	log.Printf("Unlocked %s", subject)
+}
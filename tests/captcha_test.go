@@ -0,0 +1,252 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"image/png"
+	"math/bits"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"web-app/internal/captcha"
+	"web-app/internal/models"
+)
+
+// dataURL decodes a base64 data: URL with the given media type.
+func dataURL(t *testing.T, url, mediaType string) []byte {
+	t.Helper()
+
+	prefix := "data:" + mediaType + ";base64,"
+	if !strings.HasPrefix(url, prefix) {
+		t.Fatalf("expected a %s data URL, got %.40q", mediaType, url)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(url, prefix))
+	if err != nil {
+		t.Fatalf("invalid base64: %v", err)
+	}
+	return data
+}
+
+func TestMathCaptcha(t *testing.T) {
+	challenge, answer, err := captcha.Math{}.Generate("id")
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if challenge.Type != "math" || !strings.HasPrefix(challenge.Question, "What is ") {
+		t.Fatalf("unexpected challenge %+v", challenge)
+	}
+	if _, err := strconv.Atoi(answer); err != nil {
+		t.Fatalf("expected a numeric answer, got %q", answer)
+	}
+	if !(captcha.Math{}).Check("id", answer, " "+answer+" ") {
+		t.Fatal("expected the answer to be accepted")
+	}
+	if (captcha.Math{}).Check("id", answer, answer+"0") || (captcha.Math{}).Check("id", "", "") {
+		t.Fatal("expected wrong and empty answers to be rejected")
+	}
+}
+
+func TestImageCaptcha(t *testing.T) {
+	provider := captcha.Image{Length: 5}
+	challenge, answer, err := provider.Generate("id")
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if challenge.Type != "image" || len(answer) != 5 || strings.Trim(answer, "0123456789") != "" {
+		t.Fatalf("expected five digits, got %+v, %q", challenge, answer)
+	}
+	if strings.Contains(challenge.Question, answer) {
+		t.Fatal("expected the digits only in the picture")
+	}
+
+	img, err := png.Decode(bytes.NewReader(dataURL(t, challenge.Image, "image/png")))
+	if err != nil {
+		t.Fatalf("expected a PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() < 5*20 || b.Dy() < 40 {
+		t.Fatalf("image too small for five digits: %v", b)
+	}
+
+	if !provider.Check("id", answer, answer) || provider.Check("id", answer, "") {
+		t.Fatal("expected only the digits to be accepted")
+	}
+}
+
+func TestAudioCaptcha(t *testing.T) {
+	challenge, answer, err := captcha.Audio{Length: 3}.Generate("id")
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if challenge.Type != "audio" || len(answer) != 3 || strings.Trim(answer, "123456789") != "" {
+		t.Fatalf("expected three beep counts, got %+v, %q", challenge, answer)
+	}
+
+	wav := dataURL(t, challenge.Audio, "audio/wav")
+	if len(wav) < 44 || string(wav[0:4]) != "RIFF" || string(wav[8:16]) != "WAVEfmt " || string(wav[36:40]) != "data" {
+		t.Fatalf("expected a WAV header, got %q", wav[:min(len(wav), 44)])
+	}
+	if size := binary.LittleEndian.Uint32(wav[4:8]); int(size) != len(wav)-8 {
+		t.Fatalf("RIFF size %d does not match %d bytes", size, len(wav)-8)
+	}
+	if rate := binary.LittleEndian.Uint32(wav[24:28]); rate != 8000 {
+		t.Fatalf("expected 8 kHz audio, got %d", rate)
+	}
+}
+
+// solve finds a proof-of-work counter the way the browser does.
+func solve(nonce string, difficulty int) string {
+	for counter := 0; ; counter++ {
+		sum := sha256.Sum256([]byte(nonce + ":" + strconv.Itoa(counter)))
+		zeros := 0
+		for _, b := range sum {
+			zeros += bits.LeadingZeros8(b)
+			if b != 0 {
+				break
+			}
+		}
+		if zeros >= difficulty {
+			return strconv.Itoa(counter)
+		}
+	}
+}
+
+func TestProofOfWorkCaptcha(t *testing.T) {
+	provider := captcha.ProofOfWork{Difficulty: 10}
+	challenge, answer, err := provider.Generate("captcha-id")
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if challenge.Type != "pow" || challenge.Nonce != "captcha-id" || challenge.Difficulty != 10 {
+		t.Fatalf("unexpected challenge %+v", challenge)
+	}
+
+	counter := solve(challenge.Nonce, challenge.Difficulty)
+	if !provider.Check("captcha-id", answer, counter) {
+		t.Fatalf("expected counter %s to be accepted", counter)
+	}
+	// The work is bound to the captcha it was done for.
+	if provider.Check("other-id", answer, counter) {
+		t.Fatal("expected a solution for another captcha to be rejected")
+	}
+	for _, bad := range []string{"", "-1", "0x10", " " + counter, strings.Repeat("9", 21)} {
+		if provider.Check("captcha-id", answer, bad) {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+	if provider.Check("captcha-id", "not-a-number", counter) {
+		t.Fatal("expected a corrupt stored answer to be rejected")
+	}
+}
+
+// captchaMap is a captcha.Store kept in a map.
+type captchaMap map[string]string
+
+func (m captchaMap) CreateCaptcha(c *models.Captcha) error {
+	m[c.ID] = c.Answer
+	return nil
+}
+
+func (m captchaMap) ConsumeCaptcha(id string) (string, error) {
+	answer, ok := m[id]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	delete(m, id)
+	return answer, nil
+}
+
+func TestVerifyCaptcha(t *testing.T) {
+	store := captchaMap{"right": "42", "wrong": "42"}
+
+	if err := captcha.Verify(store, captcha.Math{}, "right", "42"); err != nil {
+		t.Fatalf("expected the right answer to pass, got %v", err)
+	}
+	if err := captcha.Verify(store, captcha.Math{}, "right", "42"); !errors.Is(err, captcha.ErrInvalid) {
+		t.Fatalf("expected a solved captcha not to pass twice, got %v", err)
+	}
+
+	if err := captcha.Verify(store, captcha.Math{}, "wrong", "41"); !errors.Is(err, captcha.ErrInvalid) {
+		t.Fatalf("expected a wrong answer to fail, got %v", err)
+	}
+	if _, ok := store["wrong"]; ok {
+		t.Fatal("expected a wrong answer to use the captcha up")
+	}
+
+	if err := captcha.Verify(store, captcha.Math{}, "", ""); !errors.Is(err, captcha.ErrInvalid) {
+		t.Fatalf("expected a missing captcha to fail, got %v", err)
+	}
+}
+
+func TestSignedCaptcha(t *testing.T) {
+	signed := captcha.Signed{Key: []byte("test key"), Replay: captcha.NewMemoryReplay()}
+	expires := time.Now().Add(time.Minute)
+
+	id, err := signed.Issue("nonce1", "4711", expires)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	if strings.Contains(id, "4711") {
+		t.Fatal("expected the answer not to appear in the token")
+	}
+	if err := signed.Redeem(captcha.Math{}, id, " 4711 "); err != nil {
+		t.Fatalf("expected the right answer to pass, got %v", err)
+	}
+	if err := signed.Redeem(captcha.Math{}, id, "4711"); !errors.Is(err, captcha.ErrInvalid) {
+		t.Fatalf("expected a token not to pass twice, got %v", err)
+	}
+
+	id, _ = signed.Issue("nonce2", "4711", expires)
+	if err := signed.Redeem(captcha.Math{}, id, "4712"); !errors.Is(err, captcha.ErrInvalid) {
+		t.Fatalf("expected a wrong answer to fail, got %v", err)
+	}
+	if err := signed.Redeem(captcha.Math{}, id, "4711"); !errors.Is(err, captcha.ErrInvalid) {
+		t.Fatal("expected a wrong answer to use the token up")
+	}
+
+	expired, _ := signed.Issue("nonce3", "4711", time.Now().Add(-time.Second))
+	if err := signed.Redeem(captcha.Math{}, expired, "4711"); !errors.Is(err, captcha.ErrInvalid) {
+		t.Fatalf("expected an expired token to fail, got %v", err)
+	}
+
+	// A token with a later expiry, or issued under another key, is forged.
+	id, _ = signed.Issue("nonce4", "4711", expires)
+	parts := strings.Split(id, ".")
+	parts[1] = strconv.FormatInt(expires.Add(time.Hour).Unix(), 10)
+	if err := signed.Redeem(captcha.Math{}, strings.Join(parts, "."), "4711"); !errors.Is(err, captcha.ErrInvalid) {
+		t.Fatalf("expected an altered token to fail, got %v", err)
+	}
+	other := captcha.Signed{Key: []byte("other key"), Replay: captcha.NewMemoryReplay()}
+	forged, _ := other.Issue("nonce5", "4711", expires)
+	if err := signed.Redeem(captcha.Math{}, forged, "4711"); !errors.Is(err, captcha.ErrInvalid) {
+		t.Fatalf("expected a token under another key to fail, got %v", err)
+	}
+	if err := signed.Redeem(captcha.Math{}, id, "4711"); err != nil {
+		t.Fatalf("expected a rejected forgery not to use up the real token, got %v", err)
+	}
+}
+
+func TestSignedProofOfWork(t *testing.T) {
+	signed := captcha.Signed{Key: []byte("test key"), Replay: captcha.NewMemoryReplay()}
+	pow := captcha.ProofOfWork{Difficulty: 8}
+
+	challenge, answer, err := pow.Generate("powNonce")
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	id, _ := signed.Issue("powNonce", answer, time.Now().Add(time.Minute))
+
+	var counter string
+	for n := 0; counter == ""; n++ {
+		if sum := sha256.Sum256([]byte(challenge.Nonce + ":" + strconv.Itoa(n))); sum[0] == 0 {
+			counter = strconv.Itoa(n)
+		}
+	}
+	if err := signed.Redeem(pow, id, counter); err != nil {
+		t.Fatalf("expected the proof of work to pass, got %v", err)
+	}
+}
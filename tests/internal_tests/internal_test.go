@@ -2,13 +2,13 @@ package internal_tests
 
 import (
 	"os"
+	"strings"
 	"testing"
 	"time"
 	"web-app/internal/database"
 	"web-app/internal/models"
+	"web-app/internal/passhash"
 	"web-app/internal/utils"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 func TestDatabaseInternalLogic(t *testing.T) {
@@ -180,7 +180,10 @@ func TestDatabaseInternalLogic(t *testing.T) {
 			t.Fatalf("Could not fetch seeded user: %v", err)
 		}
 
-		err = bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(pass))
+		if !strings.HasPrefix(storedHash, "$argon2id$") {
+			t.Errorf("Expected an argon2id hash, got %q", storedHash)
+		}
+		err = passhash.Default.Verify(storedHash, pass)
 		if err != nil {
 			t.Errorf("Password verification failed for seeded user: %v", err)
 		}
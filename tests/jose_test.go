@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"web-app/internal/jose"
+)
+
+func testSigners(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	return map[string]crypto.Signer{jose.RS256: rsaKey, jose.ES256: ecKey}
+}
+
+func TestJOSESignAndVerify(t *testing.T) {
+	for alg, key := range testSigners(t) {
+		t.Run(alg, func(t *testing.T) {
+			jwk, err := jose.NewJSONWebKey(key.Public(), "kid-"+alg)
+			if err != nil {
+				t.Fatalf("NewJSONWebKey failed: %v", err)
+			}
+			keys := jose.KeySet{Keys: []jose.JSONWebKey{jwk}}
+
+			token, err := jose.Sign(map[string]string{"sub": "alice"}, key, jwk.Kid)
+			if err != nil {
+				t.Fatalf("Sign failed: %v", err)
+			}
+			if header, err := jose.ParseHeader(token); err != nil || header.Alg != alg || header.Kid != jwk.Kid {
+				t.Fatalf("unexpected header %+v, %v", header, err)
+			}
+			payload, err := jose.Verify(token, keys)
+			if err != nil || string(payload) != `{"sub":"alice"}` {
+				t.Fatalf("Verify returned %q, %v", payload, err)
+			}
+
+			// Swap the payload while keeping the signature.
+			parts := strings.Split(token, ".")
+			parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"mallory"}`))
+			if _, err := jose.Verify(strings.Join(parts, "."), keys); !errors.Is(err, jose.ErrBadSignature) {
+				t.Fatalf("expected ErrBadSignature, got %v", err)
+			}
+
+			other, _ := jose.Sign(map[string]string{"sub": "alice"}, key, "unknown")
+			if _, err := jose.Verify(other, keys); !errors.Is(err, jose.ErrUnknownKey) {
+				t.Fatalf("expected ErrUnknownKey, got %v", err)
+			}
+		})
+	}
+}
+
+func TestJOSERejectsUnsignedTokens(t *testing.T) {
+	key := testSigners(t)[jose.RS256]
+	jwk, _ := jose.NewJSONWebKey(key.Public(), "k")
+	keys := jose.KeySet{Keys: []jose.JSONWebKey{jwk}}
+
+	for _, alg := range []string{"none", "HS256", jose.ES256} {
+		header, _ := json.Marshal(jose.Header{Alg: alg, Kid: "k"})
+		token := base64.RawURLEncoding.EncodeToString(header) + "." +
+			base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice"}`)) + "."
+		if _, err := jose.Verify(token, keys); err == nil {
+			t.Fatalf("expected a token with alg %q to be rejected", alg)
+		}
+	}
+	if _, err := jose.Verify("not-a-token", keys); !errors.Is(err, jose.ErrMalformed) {
+		t.Fatalf("expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestJOSEClaims(t *testing.T) {
+	var claims jose.Claims
+	if err := json.Unmarshal([]byte(`{"aud":"client"}`), &claims); err != nil || !claims.Audience.Contains("client") {
+		t.Fatalf("expected a single audience, got %v, %v", claims.Audience, err)
+	}
+	if err := json.Unmarshal([]byte(`{"aud":["a","client"]}`), &claims); err != nil || !claims.Audience.Contains("client") {
+		t.Fatalf("expected an audience list, got %v, %v", claims.Audience, err)
+	}
+
+	now := time.Now()
+	valid := jose.Claims{Issuer: "https://issuer", Audience: jose.Audience{"client"}, Expiry: now.Add(time.Hour).Unix()}
+	if err := valid.Validate("https://issuer", "client", now); err != nil {
+		t.Fatalf("expected valid claims, got %v", err)
+	}
+	if err := valid.Validate("https://other", "client", now); err == nil {
+		t.Fatal("expected another issuer to be rejected")
+	}
+	if err := valid.Validate("https://issuer", "other", now); err == nil {
+		t.Fatal("expected another audience to be rejected")
+	}
+	if err := valid.Validate("https://issuer", "client", now.Add(2*time.Hour)); !errors.Is(err, jose.ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+	// Small clock differences are tolerated.
+	if err := valid.Validate("https://issuer", "client", now.Add(time.Hour+30*time.Second)); err != nil {
+		t.Fatalf("expected the leeway to apply, got %v", err)
+	}
+}
+
+func TestJOSEThumbprint(t *testing.T) {
+	// The example key of RFC 7638, section 3.1.
+	key := jose.JSONWebKey{
+		Kty: "RSA",
+		E:   "AQAB",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		// Optional members do not change the thumbprint.
+		Kid: "2011-04-29",
+		Alg: jose.RS256,
+	}
+	if got := key.Thumbprint(); got != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("unexpected thumbprint %q", got)
+	}
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"web-app/internal/passhash"
+)
+
+// fastArgon2id keeps the tests quick; the parameters are not for production.
+var fastArgon2id = passhash.Argon2id{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func TestArgon2id_HashAndVerify(t *testing.T) {
+	hash, err := fastArgon2id.Hash("Password123!")
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("expected a PHC argon2id string, got %q", hash)
+	}
+	if other, _ := fastArgon2id.Hash("Password123!"); other == hash {
+		t.Fatal("expected a fresh salt for every hash")
+	}
+
+	if err := fastArgon2id.Verify(hash, "Password123!"); err != nil {
+		t.Fatalf("expected the password to verify, got %v", err)
+	}
+	if err := fastArgon2id.Verify(hash, "Password123?"); !errors.Is(err, passhash.ErrMismatch) {
+		t.Fatalf("expected ErrMismatch, got %v", err)
+	}
+	if err := fastArgon2id.Verify("$argon2id$v=19$m=64,t=1,p=1$bm9wZQ", "Password123!"); !errors.Is(err, passhash.ErrUnknownHash) {
+		t.Fatalf("expected a malformed hash to be rejected, got %v", err)
+	}
+}
+
+func TestArgon2id_UsesWholePassword(t *testing.T) {
+	// bcrypt would see these as the same password.
+	prefix := strings.Repeat("a", 72)
+	hash, err := fastArgon2id.Hash(prefix + "1")
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	if err := fastArgon2id.Verify(hash, prefix+"2"); !errors.Is(err, passhash.ErrMismatch) {
+		t.Fatalf("expected bytes past 72 to count, got %v", err)
+	}
+}
+
+func TestHashers_VerifyEachOther(t *testing.T) {
+	bcryptHasher := passhash.Bcrypt{Cost: 4}
+	bcryptHash, err := bcryptHasher.Hash("Password123!")
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	argonHash, _ := fastArgon2id.Hash("Password123!")
+
+	if err := fastArgon2id.Verify(bcryptHash, "Password123!"); err != nil {
+		t.Fatalf("expected argon2id to verify bcrypt hashes, got %v", err)
+	}
+	if err := fastArgon2id.Verify(bcryptHash, "Wrong123!"); !errors.Is(err, passhash.ErrMismatch) {
+		t.Fatalf("expected ErrMismatch, got %v", err)
+	}
+	if err := bcryptHasher.Verify(argonHash, "Password123!"); err != nil {
+		t.Fatalf("expected bcrypt to verify argon2id hashes, got %v", err)
+	}
+	if err := fastArgon2id.Verify("plaintext", "plaintext"); !errors.Is(err, passhash.ErrUnknownHash) {
+		t.Fatalf("expected ErrUnknownHash, got %v", err)
+	}
+	if _, err := bcryptHasher.Hash(strings.Repeat("a", 73)); err == nil {
+		t.Fatal("expected bcrypt to refuse passwords it would truncate")
+	}
+}
+
+func TestHashers_NeedsRehash(t *testing.T) {
+	argonHash, _ := fastArgon2id.Hash("Password123!")
+	bcryptHash, _ := passhash.Bcrypt{Cost: 4}.Hash("Password123!")
+
+	stronger := fastArgon2id
+	stronger.Memory = 128
+	cases := []struct {
+		name   string
+		hasher passhash.Hasher
+		hash   string
+		want   bool
+	}{
+		{"same argon2id parameters", fastArgon2id, argonHash, false},
+		{"other argon2id parameters", stronger, argonHash, true},
+		{"bcrypt hash under argon2id", fastArgon2id, bcryptHash, true},
+		{"same bcrypt cost", passhash.Bcrypt{Cost: 4}, bcryptHash, false},
+		{"other bcrypt cost", passhash.Bcrypt{Cost: 5}, bcryptHash, true},
+		{"argon2id hash under bcrypt", passhash.Bcrypt{Cost: 4}, argonHash, true},
+	}
+	for _, c := range cases {
+		if got := c.hasher.NeedsRehash(c.hash); got != c.want {
+			t.Errorf("%s: expected NeedsRehash %v, got %v", c.name, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"testing"
+	"time"
+	"web-app/internal/ratelimit"
+)
+
+func TestRuleTake_BurstThenRefill(t *testing.T) {
+	rule := ratelimit.Rule{Limit: 3, Period: 3 * time.Second}
+	start := time.Unix(1700000000, 0)
+
+	var full time.Time
+	for i := 0; i < 3; i++ {
+		var wait time.Duration
+		full, wait = rule.Take(full, start)
+		if wait != 0 {
+			t.Fatalf("request %d: expected the burst to fit, waited %v", i+1, wait)
+		}
+	}
+	if _, wait := rule.Take(full, start); wait != time.Second {
+		t.Fatalf("expected to wait one interval, got %v", wait)
+	}
+	// Refused requests do not drain the bucket further.
+	if _, wait := rule.Take(full, start.Add(time.Second)); wait != 0 {
+		t.Fatalf("expected a request to fit after one interval, waited %v", wait)
+	}
+	if _, wait := rule.Take(full, start.Add(time.Hour)); wait != 0 {
+		t.Fatalf("expected a quiet bucket to be full, waited %v", wait)
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := ratelimit.ParseRule("10/1m")
+	if err != nil || rule.Limit != 10 || rule.Period != time.Minute {
+		t.Fatalf("expected 10 per minute, got %+v, %v", rule, err)
+	}
+	if rule.Interval() != 6*time.Second {
+		t.Fatalf("expected an interval of 6s, got %v", rule.Interval())
+	}
+
+	for _, bad := range []string{"", "10", "0/1m", "-1/1m", "ten/1m", "10/soon", "10/0s"} {
+		if _, err := ratelimit.ParseRule(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	limiter := ratelimit.NewMemory()
+	rule := ratelimit.Rule{Limit: 2, Period: time.Hour}
+
+	for i := 0; i < 2; i++ {
+		if wait, err := limiter.Allow("a", rule); err != nil || wait != 0 {
+			t.Fatalf("request %d: expected to be allowed, got %v, %v", i+1, wait, err)
+		}
+	}
+	if wait, _ := limiter.Allow("a", rule); wait <= 0 || wait > 30*time.Minute {
+		t.Fatalf("expected to wait up to half an hour, got %v", wait)
+	}
+	if wait, _ := limiter.Allow("b", rule); wait != 0 {
+		t.Fatalf("expected keys to have their own buckets, waited %v", wait)
+	}
+}
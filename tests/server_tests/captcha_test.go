@@ -0,0 +1,277 @@
+package server_tests
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"web-app/internal/api"
+	"web-app/internal/captcha"
+	"web-app/internal/database"
+	"web-app/internal/models"
+)
+
+func TestHandleCaptcha_MethodNotAllowed(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/captcha", nil)
+	rr := httptest.NewRecorder()
+
+	api.HandleCaptcha(store).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
+
+func TestHandleCaptcha_StoresAnswer(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/captcha", nil)
+	rr := httptest.NewRecorder()
+
+	api.HandleCaptcha(store).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var captcha api.MathCaptcha
+	if err := json.NewDecoder(rr.Body).Decode(&captcha); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	answer, err := store.ConsumeCaptcha(captcha.ID)
+	if err != nil {
+		t.Fatalf("expected captcha %q to be stored: %v", captcha.ID, err)
+	}
+	if answer == "" {
+		t.Fatal("expected stored captcha answer")
+	}
+}
+
+// answerRecorder passes captchas on to the store and remembers their
+// answers, so tests can solve the challenges the server hands out without
+// using them up.
+type answerRecorder struct {
+	database.CaptchaStore
+	answers map[string]string
+}
+
+func (r *answerRecorder) CreateCaptcha(c *models.Captcha) error {
+	r.answers[c.ID] = c.Answer
+	return r.CaptchaStore.CreateCaptcha(c)
+}
+
+// fetchCaptcha gets a challenge from provider and returns it with the answer
+// the server stored.
+func fetchCaptcha(t *testing.T, provider captcha.Provider) (api.Challenge, string) {
+	t.Helper()
+
+	recorder := &answerRecorder{CaptchaStore: store, answers: make(map[string]string)}
+	rr := httptest.NewRecorder()
+	api.HandleCaptchaWith(recorder, provider).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/captcha", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var challenge api.Challenge
+	if err := json.NewDecoder(strings.NewReader(rr.Body.String())).Decode(&challenge); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	answer, ok := recorder.answers[challenge.ID]
+	if !ok {
+		t.Fatalf("expected captcha %q to be stored", challenge.ID)
+	}
+	for _, leak := range []string{"num1", "num2", "operator", "answer"} {
+		if strings.Contains(rr.Body.String(), `"`+leak+`"`) {
+			t.Fatalf("expected no %q field in %s", leak, rr.Body.String())
+		}
+	}
+	return challenge, answer
+}
+
+func registerWithCaptcha(captchaID, response string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"first_name":"Captcha","last_name":"User","email":"%s","password":"Password123!","captcha_id":"%s","captcha_answer":"%s"}`,
+		uniqueEmail("captcha_register"), captchaID, response)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleRegister).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body)))
+	return rr
+}
+
+func withCaptchaProvider(t *testing.T, provider captcha.Provider) {
+	t.Helper()
+
+	saved := app.Captcha
+	app.Captcha = provider
+	t.Cleanup(func() { app.Captcha = saved })
+}
+
+func TestHandleCaptcha_ImageHidesAnswer(t *testing.T) {
+	withCaptchaProvider(t, captcha.Image{})
+	challenge, answer := fetchCaptcha(t, app.Captcha)
+
+	if challenge.Type != "image" || !strings.HasPrefix(challenge.Image, "data:image/png;base64,") {
+		t.Fatalf("expected an image challenge, got type %q", challenge.Type)
+	}
+	if strings.Contains(challenge.Question, answer) {
+		t.Fatal("expected the answer only in the image")
+	}
+
+	if rr := registerWithCaptcha(challenge.ID, answer); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleRegister_ProofOfWorkCaptcha(t *testing.T) {
+	withCaptchaProvider(t, captcha.ProofOfWork{Difficulty: 8})
+	challenge, _ := fetchCaptcha(t, app.Captcha)
+	if challenge.Type != "pow" || challenge.Nonce != challenge.ID || challenge.Difficulty != 8 {
+		t.Fatalf("unexpected challenge %+v", challenge.Challenge)
+	}
+
+	var counter string
+	for n := 0; counter == ""; n++ {
+		sum := sha256.Sum256([]byte(challenge.Nonce + ":" + strconv.Itoa(n)))
+		// Eight zero bits: the first byte is zero.
+		if sum[0] == 0 {
+			counter = strconv.Itoa(n)
+		}
+	}
+
+	if app.Captcha.Check(challenge.ID, "8", "0x"+counter) {
+		t.Fatal("expected a malformed counter to be rejected")
+	}
+	if rr := registerWithCaptcha(challenge.ID, counter); rr.Code != http.StatusCreated {
+		t.Fatalf("expected the proof of work to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func registerFrom(remoteAddr, captchaID, response string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"first_name":"Captcha","last_name":"User","email":"%s","password":"Password123!","captcha_id":"%s","captcha_answer":"%s"}`,
+		uniqueEmail("captcha_register"), captchaID, response)
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleRegister).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandleRegister_CaptchaIsSingleUse(t *testing.T) {
+	withCaptchaProvider(t, captcha.Math{})
+	challenge, answer := fetchCaptcha(t, app.Captcha)
+
+	if rr := registerWithCaptcha(challenge.ID, answer); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if rr := registerWithCaptcha(challenge.ID, answer); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a solved captcha not to be accepted twice, got %d", rr.Code)
+	}
+}
+
+func TestHandleRegister_WrongCaptchaUsesItUp(t *testing.T) {
+	withCaptchaProvider(t, captcha.Math{})
+	challenge, answer := fetchCaptcha(t, app.Captcha)
+
+	if rr := registerWithCaptcha(challenge.ID, "wrong"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong answer to be rejected, got %d", rr.Code)
+	}
+	if _, err := store.ConsumeCaptcha(challenge.ID); err == nil {
+		t.Fatal("expected the captcha to be deleted after a wrong answer")
+	}
+	if rr := registerWithCaptcha(challenge.ID, answer); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected no second try on the same captcha, got %d", rr.Code)
+	}
+}
+
+func TestHandleRegister_WrongCaptchaLockout(t *testing.T) {
+	saved := app.Config.CaptchaMaxFailures
+	app.Config.CaptchaMaxFailures = 3
+	t.Cleanup(func() { app.Config.CaptchaMaxFailures = saved })
+	withCaptchaProvider(t, captcha.Math{})
+
+	const addr = "198.51.100.22:4000"
+	t.Cleanup(func() { store.ClearLoginThrottle(models.ThrottleCaptcha, "198.51.100.22") })
+
+	for i := 0; i < 3; i++ {
+		challenge, _ := fetchCaptcha(t, app.Captcha)
+		if rr := registerFrom(addr, challenge.ID, "wrong"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected status %d, got %d", i+1, http.StatusUnauthorized, rr.Code)
+		}
+	}
+
+	challenge, answer := fetchCaptcha(t, app.Captcha)
+	rr := registerFrom(addr, challenge.ID, answer)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header")
+	}
+
+	if rr := registerFrom("198.51.100.23:4000", challenge.ID, answer); rr.Code != http.StatusCreated {
+		t.Fatalf("expected other clients to register, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleRegister_SignedCaptcha(t *testing.T) {
+	pow := captcha.ProofOfWork{Difficulty: 8}
+	withCaptchaProvider(t, pow)
+	saved := app.CaptchaIssuer
+	app.CaptchaIssuer = captcha.Signed{Key: []byte("test key"), Replay: store}
+	t.Cleanup(func() { app.CaptchaIssuer = saved })
+
+	rr := httptest.NewRecorder()
+	api.HandleCaptchaFrom(app.CaptchaIssuer, pow).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/captcha", nil))
+	var challenge api.Challenge
+	if err := json.NewDecoder(rr.Body).Decode(&challenge); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if _, err := store.ConsumeCaptcha(challenge.ID); err == nil {
+		t.Fatal("expected a signed captcha not to be stored")
+	}
+
+	var counter string
+	for n := 0; counter == ""; n++ {
+		if sum := sha256.Sum256([]byte(challenge.Nonce + ":" + strconv.Itoa(n))); sum[0] == 0 {
+			counter = strconv.Itoa(n)
+		}
+	}
+	if rr := registerWithCaptcha(challenge.ID, counter); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if rr := registerWithCaptcha(challenge.ID, counter); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a signed captcha not to be accepted twice, got %d", rr.Code)
+	}
+}
+
+func TestHandleRegister_SiteverifyCaptcha(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok := r.PostFormValue("secret") == "s3cret" && r.PostFormValue("response") == "widget-token"
+		json.NewEncoder(w).Encode(map[string]any{"success": ok, "hostname": "localhost"})
+	}))
+	defer stub.Close()
+
+	widget := captcha.Siteverify{Type: "turnstile", SiteKey: "site", Secret: "s3cret", URL: stub.URL, Hostnames: []string{"localhost"}}
+	withCaptchaProvider(t, widget)
+	saved := app.CaptchaIssuer
+	app.CaptchaIssuer = widget
+	t.Cleanup(func() { app.CaptchaIssuer = saved })
+
+	rr := httptest.NewRecorder()
+	api.HandleCaptchaFrom(app.CaptchaIssuer, widget).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/captcha", nil))
+	var challenge api.Challenge
+	if err := json.NewDecoder(rr.Body).Decode(&challenge); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if challenge.Type != "turnstile" || challenge.SiteKey != "site" {
+		t.Fatalf("expected the widget settings, got %+v", challenge.Challenge)
+	}
+
+	if rr := registerWithCaptcha(challenge.ID, "forged"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a rejected widget token to fail, got %d", rr.Code)
+	}
+	if rr := registerWithCaptcha(challenge.ID, "widget-token"); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,161 @@
+package server_tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"web-app/internal/models"
+	"web-app/pkg/server"
+)
+
+func registerUser(t *testing.T, a *server.App, email string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	captchaID := fmt.Sprintf("captcha_%d", time.Now().UnixNano())
+	store.SeedCaptcha(t, captchaID, "4242")
+
+	body := fmt.Sprintf(`{"first_name":"Verify","last_name":"Me","email":"%s","password":"Password123!","captcha_id":"%s","captcha_answer":"4242"}`,
+		email, captchaID)
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(a.HandleRegister).ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	return rr
+}
+
+func verifyEmail(a *server.App, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/email/verify", strings.NewReader(fmt.Sprintf(`{"token":"%s"}`, token)))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(a.HandleVerifyEmail).ServeHTTP(rr, req)
+	return rr
+}
+
+func loginAs(a *server.App, email, password string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"email":"%s", "password":"%s"}`, email, password)
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(a.HandleLogin).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestEmailVerification_Flow(t *testing.T) {
+	email := uniqueEmail("verify_flow")
+	registerUser(t, app, email)
+
+	user, err := store.GetUserByEmail(email)
+	if err != nil || user.EmailVerified {
+		t.Fatalf("expected a new unverified user, got %+v, %v", user, err)
+	}
+
+	token := mailedToken(t, email, "/verify-email")
+	if rr := verifyEmail(app, token); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if user, _ := store.GetUserByEmail(email); !user.EmailVerified {
+		t.Fatal("expected user to be verified")
+	}
+
+	if rr := verifyEmail(app, token); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected reused link to be rejected with %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestEmailVerification_Resend(t *testing.T) {
+	email := uniqueEmail("verify_resend")
+	registerUser(t, app, email)
+	first := mailedToken(t, email, "/verify-email")
+
+	req := httptest.NewRequest(http.MethodPost, "/email/verify/resend", strings.NewReader(fmt.Sprintf(`{"email":"%s"}`, email)))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleResendVerification).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	second := mailedToken(t, email, "/verify-email")
+	if second == first {
+		t.Fatal("expected a new verification link")
+	}
+
+	if rr := verifyEmail(app, first); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected superseded link to be rejected, got %d", rr.Code)
+	}
+	if rr := verifyEmail(app, second); rr.Code != http.StatusOK {
+		t.Fatalf("expected newest link to work, got %d", rr.Code)
+	}
+
+	unknown := uniqueEmail("verify_resend_unknown")
+	req = httptest.NewRequest(http.MethodPost, "/email/verify/resend", strings.NewReader(fmt.Sprintf(`{"email":"%s"}`, unknown)))
+	missing := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleResendVerification).ServeHTTP(missing, req)
+	if missing.Code != rr.Code || missing.Body.String() != rr.Body.String() {
+		t.Fatalf("expected identical responses for unknown email, got %d %q", missing.Code, missing.Body)
+	}
+}
+
+func TestEmailVerification_BlockPolicy(t *testing.T) {
+	a := server.NewApp(store)
+	a.Mailer = mailer
+	a.Config.UnverifiedPolicy = server.VerificationBlock
+
+	email := uniqueEmail("verify_block")
+	rr := registerUser(t, a, email)
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == "session_token" {
+			t.Fatal("expected no session for an unverified registration under the block policy")
+		}
+	}
+
+	if rr := loginAs(a, email, "Password123!"); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected unverified login to be refused with %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	user, _ := store.GetUserByEmail(email)
+	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "userID", user.ID))
+	rr = httptest.NewRecorder()
+	a.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected RequireAuth to reject an unverified user with %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	verifyEmail(a, mailedToken(t, email, "/verify-email"))
+	if rr := loginAs(a, email, "Password123!"); rr.Code != http.StatusOK {
+		t.Fatalf("expected verified login to succeed, got %d", rr.Code)
+	}
+}
+
+func TestEmailVerification_LimitedPolicy(t *testing.T) {
+	a := server.NewApp(store)
+	a.Config.UnverifiedPolicy = server.VerificationLimited
+
+	user := &models.User{FirstName: "Limited", LastName: "Access", Email: uniqueEmail("verify_limited"), Password: "Password123!"}
+	userID := int(store.SeedUser(t, user))
+
+	if rr := loginAs(a, user.Email, user.Password); rr.Code != http.StatusOK {
+		t.Fatalf("expected unverified login to succeed under the limited policy, got %d", rr.Code)
+	}
+
+	serve := func() int {
+		req := httptest.NewRequest(http.MethodPut, "/profile/updateName", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "userID", userID))
+		rr := httptest.NewRecorder()
+		a.RequireAuth(a.RequireVerifiedEmail(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))).ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := serve(); code != http.StatusForbidden {
+		t.Fatalf("expected %d for an unverified user, got %d", http.StatusForbidden, code)
+	}
+	if err := store.MarkEmailVerified(userID); err != nil {
+		t.Fatalf("MarkEmailVerified failed: %v", err)
+	}
+	if code := serve(); code != http.StatusOK {
+		t.Fatalf("expected %d for a verified user, got %d", http.StatusOK, code)
+	}
+}
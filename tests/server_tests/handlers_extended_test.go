@@ -46,14 +46,14 @@ func TestHandleLogin_InvalidCredentials(t *testing.T) {
 	}
 }
 
-func TestHandleLogin_ReusesExistingSession(t *testing.T) {
+func TestHandleLogin_CreatesSessionPerLogin(t *testing.T) {
 	user := &models.User{
 		FirstName: "Existing",
 		LastName:  "Session",
 		Email:     uniqueEmail("login_existing"),
 		Password:  "Password123!",
 	}
-	userID := app.DB.SeedUser(t, user)
+	userID := store.SeedUser(t, user)
 
 	token := fmt.Sprintf("existing_session_%d", time.Now().UnixNano())
 	err := app.DB.CreateSession(&models.Session{
@@ -67,6 +67,7 @@ func TestHandleLogin_ReusesExistingSession(t *testing.T) {
 
 	body := fmt.Sprintf(`{"email":"%s", "password":"Password123!"}`, user.Email)
 	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	req.Header.Set("User-Agent", "second-device")
 	rr := httptest.NewRecorder()
 
 	http.HandlerFunc(app.HandleLogin).ServeHTTP(rr, req)
@@ -75,19 +76,29 @@ func TestHandleLogin_ReusesExistingSession(t *testing.T) {
 		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
 	}
 
-	cookies := rr.Result().Cookies()
-	found := false
-	for _, c := range cookies {
+	var newToken string
+	for _, c := range rr.Result().Cookies() {
 		if c.Name == "session_token" {
-			found = true
-			if c.Value != token {
-				t.Fatalf("expected existing token %q, got %q", token, c.Value)
-			}
+			newToken = c.Value
 		}
 	}
-	if !found {
+	if newToken == "" {
 		t.Fatal("expected session_token cookie")
 	}
+	if newToken == token {
+		t.Fatal("expected login to mint a new session instead of reusing the existing one")
+	}
+
+	session, err := app.DB.GetSessionByToken(newToken)
+	if err != nil {
+		t.Fatalf("expected new session to be stored: %v", err)
+	}
+	if session.UserAgent != "second-device" || session.IPAddress == "" {
+		t.Fatalf("expected device metadata on new session, got %+v", session)
+	}
+	if _, err := app.DB.GetSessionByToken(token); err != nil {
+		t.Fatalf("expected existing session to stay valid: %v", err)
+	}
 }
 
 func TestHandleRegister_MethodNotAllowed(t *testing.T) {
@@ -170,10 +181,10 @@ func TestHandleRegister_EmailExists(t *testing.T) {
 		Email:     uniqueEmail("register_exists"),
 		Password:  "Password123!",
 	}
-	app.DB.SeedUser(t, existing)
+	store.SeedUser(t, existing)
 
 	captchaID := fmt.Sprintf("captcha_%d", time.Now().UnixNano())
-	app.DB.SeedCaptcha(t, captchaID, "7777")
+	store.SeedCaptcha(t, captchaID, "7777")
 
 	body := fmt.Sprintf(`{"first_name":"Jane","last_name":"Doe","email":"%s","password":"Password123!","captcha_id":"%s","captcha_answer":"7777"}`,
 		existing.Email, captchaID)
@@ -189,7 +200,7 @@ func TestHandleRegister_EmailExists(t *testing.T) {
 
 func TestHandleRegister_Success(t *testing.T) {
 	captchaID := fmt.Sprintf("captcha_%d", time.Now().UnixNano())
-	app.DB.SeedCaptcha(t, captchaID, "4242")
+	store.SeedCaptcha(t, captchaID, "4242")
 
 	email := uniqueEmail("register_success")
 	body := fmt.Sprintf(`{"first_name":"John","last_name":"Doe","email":"%s","password":"Password123!","captcha_id":"%s","captcha_answer":"4242"}`,
@@ -241,7 +252,7 @@ func TestSessionHandler_Authenticated(t *testing.T) {
 		Email:     uniqueEmail("session_handler"),
 		Password:  "Password123!",
 	}
-	userID := app.DB.SeedUser(t, user)
+	userID := store.SeedUser(t, user)
 
 	req := httptest.NewRequest(http.MethodGet, "/session", nil)
 	req = req.WithContext(context.WithValue(req.Context(), "userID", int(userID)))
@@ -319,7 +330,7 @@ func TestHandleUpdateName_Unauthorized(t *testing.T) {
 
 func TestHandleUpdateName_BadRequest(t *testing.T) {
 	user := &models.User{FirstName: "Bad", LastName: "Req", Email: uniqueEmail("update_name_bad"), Password: "Password123!"}
-	userID := app.DB.SeedUser(t, user)
+	userID := store.SeedUser(t, user)
 
 	req := httptest.NewRequest(http.MethodPut, "/profile/name", strings.NewReader("{bad"))
 	req = req.WithContext(context.WithValue(req.Context(), "userID", int(userID)))
@@ -334,7 +345,7 @@ func TestHandleUpdateName_BadRequest(t *testing.T) {
 
 func TestHandleUpdateName_InvalidName(t *testing.T) {
 	user := &models.User{FirstName: "Bad", LastName: "Name", Email: uniqueEmail("update_name_invalid"), Password: "Password123!"}
-	userID := app.DB.SeedUser(t, user)
+	userID := store.SeedUser(t, user)
 
 	body := `{"first_name":"New123","last_name":"Name"}`
 	req := httptest.NewRequest(http.MethodPut, "/profile/name", strings.NewReader(body))
@@ -355,7 +366,7 @@ func TestHandleUpdateName_Success(t *testing.T) {
 		Email:     uniqueEmail("update_name"),
 		Password:  "Password123!",
 	}
-	userID := app.DB.SeedUser(t, user)
+	userID := store.SeedUser(t, user)
 
 	body := `{"first_name":"New","last_name":"Name"}`
 	req := httptest.NewRequest(http.MethodPut, "/profile/name", strings.NewReader(body))
@@ -376,7 +387,7 @@ func TestHandleUpdatePassword_Success(t *testing.T) {
 		Email:     uniqueEmail("update_password"),
 		Password:  "Password123!",
 	}
-	userID := app.DB.SeedUser(t, user)
+	userID := store.SeedUser(t, user)
 
 	body := `{"current_password":"Password123!","new_password":"NewPass123!"}`
 	req := httptest.NewRequest(http.MethodPut, "/profile/password", strings.NewReader(body))
@@ -415,7 +426,7 @@ func TestHandleUpdatePassword_Unauthorized(t *testing.T) {
 
 func TestHandleUpdatePassword_BadRequest(t *testing.T) {
 	user := &models.User{FirstName: "Bad", LastName: "Req", Email: uniqueEmail("update_pass_bad"), Password: "Password123!"}
-	userID := app.DB.SeedUser(t, user)
+	userID := store.SeedUser(t, user)
 
 	req := httptest.NewRequest(http.MethodPut, "/profile/password", strings.NewReader("{bad"))
 	req = req.WithContext(context.WithValue(req.Context(), "userID", int(userID)))
@@ -430,7 +441,7 @@ func TestHandleUpdatePassword_BadRequest(t *testing.T) {
 
 func TestHandleUpdatePassword_InvalidPassword(t *testing.T) {
 	user := &models.User{FirstName: "Invalid", LastName: "Pass", Email: uniqueEmail("update_pass_invalid"), Password: "Password123!"}
-	userID := app.DB.SeedUser(t, user)
+	userID := store.SeedUser(t, user)
 
 	body := `{"current_password":"Password123!","new_password":"short"}`
 	req := httptest.NewRequest(http.MethodPut, "/profile/password", strings.NewReader(body))
@@ -446,7 +457,7 @@ func TestHandleUpdatePassword_InvalidPassword(t *testing.T) {
 
 func TestHandleUpdatePassword_IncorrectCurrentPassword(t *testing.T) {
 	user := &models.User{FirstName: "Wrong", LastName: "Current", Email: uniqueEmail("update_pass_wrong_current"), Password: "Password123!"}
-	userID := app.DB.SeedUser(t, user)
+	userID := store.SeedUser(t, user)
 
 	body := `{"current_password":"WrongPassword123!","new_password":"NewPass123!"}`
 	req := httptest.NewRequest(http.MethodPut, "/profile/password", strings.NewReader(body))
@@ -470,3 +481,117 @@ func TestHomeHandler(t *testing.T) {
 		t.Fatalf("expected status %d or %d, got %d", http.StatusOK, http.StatusNotFound, rr.Code)
 	}
 }
+
+// loginCookie logs the user in through HandleLogin and returns the
+// session_token cookie value.
+func loginCookie(t *testing.T, email, password string) string {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"email":"%s", "password":"%s"}`, email, password)
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleLogin).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected login status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "session_token" {
+			return cookie.Value
+		}
+	}
+	t.Fatal("expected session_token cookie from login")
+	return ""
+}
+
+func TestHandleLogout_RevokesSession(t *testing.T) {
+	user := &models.User{FirstName: "Logout", LastName: "User", Email: uniqueEmail("logout_revoke"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	token := loginCookie(t, user.Email, user.Password)
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+	rr := httptest.NewRecorder()
+
+	app.SessionLoader(http.HandlerFunc(app.HandleLogout)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if _, err := store.GetSessionByToken(token); err == nil {
+		t.Fatal("expected session to be revoked after logout")
+	}
+}
+
+func TestHandleLogoutAll(t *testing.T) {
+	user := &models.User{FirstName: "Everywhere", LastName: "User", Email: uniqueEmail("logout_all"), Password: "Password123!"}
+	userID := store.SeedUser(t, user)
+
+	other := fmt.Sprintf("other_device_%d", time.Now().UnixNano())
+	if err := store.CreateSession(&models.Session{Token: other, UserID: int(userID), ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("failed to seed session: %v", err)
+	}
+	token := loginCookie(t, user.Email, user.Password)
+
+	req := httptest.NewRequest(http.MethodPost, "/logout/all", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+	rr := httptest.NewRecorder()
+
+	app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleLogoutAll))).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	for _, tok := range []string{token, other} {
+		if _, err := store.GetSessionByToken(tok); err == nil {
+			t.Fatalf("expected session %q to be revoked", tok)
+		}
+	}
+}
+
+func TestHandleLogoutAll_Unauthorized(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/logout/all", nil)
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(app.HandleLogoutAll).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestHandleUpdatePassword_RotatesAndRevokesSessions(t *testing.T) {
+	user := &models.User{FirstName: "Stolen", LastName: "Cookie", Email: uniqueEmail("update_pass_sessions"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	stolen := loginCookie(t, user.Email, user.Password)
+	current := loginCookie(t, user.Email, user.Password)
+
+	body := `{"current_password":"Password123!","new_password":"NewPass123!"}`
+	req := httptest.NewRequest(http.MethodPut, "/profile/updatePassword", strings.NewReader(body))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: current})
+	rr := httptest.NewRecorder()
+
+	app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleUpdatePassword))).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var fresh string
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "session_token" {
+			fresh = cookie.Value
+		}
+	}
+	if fresh == "" || fresh == current {
+		t.Fatal("expected a fresh session token after password change")
+	}
+	if _, err := store.GetSessionByToken(fresh); err != nil {
+		t.Fatalf("expected fresh token to be valid: %v", err)
+	}
+	for _, tok := range []string{stolen, current} {
+		if _, err := store.GetSessionByToken(tok); err == nil {
+			t.Fatalf("expected token %q to be revoked after password change", tok)
+		}
+	}
+}
@@ -47,7 +47,7 @@ func TestHandleLogin_Success(t *testing.T) {
 		Email:     "login_success@test.com",
 		Password:  "Password123!",
 	}
-	app.DB.SeedUser(t, user)
+	store.SeedUser(t, user)
 
 	body := `{"email":"login_success@test.com", "password":"Password123!"}`
 	req, err := http.NewRequest("POST", "/login", strings.NewReader(body))
@@ -0,0 +1,108 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"web-app/internal/captcha"
+	"web-app/internal/models"
+	"web-app/pkg/server"
+)
+
+// withLoginCaptcha asks for a captcha after the given failures and turns
+// delays and lockouts off for one test.
+func withLoginCaptcha(t *testing.T, after, ipAfter int) {
+	t.Helper()
+
+	withLoginLimits(t, 0, 0, 0)
+	app.Config.LoginCaptchaAfter = after
+	app.Config.LoginIPCaptchaAfter = ipAfter
+	withCaptchaProvider(t, captcha.Math{})
+}
+
+// loginWithCaptcha posts a password login with a captcha as the client at
+// remoteAddr.
+func loginWithCaptcha(remoteAddr, email, password, captchaID, answer string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"email":"%s","password":"%s","captcha_id":"%s","captcha_answer":"%s"}`, email, password, captchaID, answer)
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleLogin).ServeHTTP(rr, req)
+	return rr
+}
+
+// captchaRequired reports whether a failed login's JSON body asks for a
+// captcha with the next attempt.
+func captchaRequired(rr *httptest.ResponseRecorder) bool {
+	var body struct {
+		CaptchaRequired bool `json:"captcha_required"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	return body.CaptchaRequired
+}
+
+func TestLoginCaptcha_RequiredAfterAccountFailures(t *testing.T) {
+	withLoginCaptcha(t, 2, 0)
+	user := &models.User{FirstName: "Captcha", LastName: "Login", Email: uniqueEmail("login_captcha"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	const addr = "198.51.100.30:4000"
+
+	rr := loginFrom(addr, user.Email, "Wrong123!")
+	if rr.Code != http.StatusUnauthorized || captchaRequired(rr) {
+		t.Fatalf("expected one failure not to ask for a captcha, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = loginFrom(addr, user.Email, "Wrong123!")
+	if rr.Code != http.StatusUnauthorized || !captchaRequired(rr) || rr.Header().Get(server.CaptchaRequiredHeader) != "true" {
+		t.Fatalf("expected the second failure to announce the captcha, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = loginFrom(addr, user.Email, user.Password)
+	if rr.Code != http.StatusUnauthorized || !captchaRequired(rr) || !strings.Contains(rr.Body.String(), "Captcha required") {
+		t.Fatalf("expected the right password alone to be refused, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	challenge, answer := fetchCaptcha(t, app.Captcha)
+	if rr := loginWithCaptcha(addr, user.Email, user.Password, challenge.ID, "wrong"); rr.Code != http.StatusUnauthorized || !captchaRequired(rr) {
+		t.Fatalf("expected a wrong captcha to be refused and a new one asked for, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := loginWithCaptcha(addr, user.Email, user.Password, challenge.ID, answer); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a used captcha to be refused, got %d", rr.Code)
+	}
+
+	challenge, answer = fetchCaptcha(t, app.Captcha)
+	if rr := loginWithCaptcha(addr, user.Email, user.Password, challenge.ID, answer); rr.Code != http.StatusOK {
+		t.Fatalf("expected a login with password and captcha, got %d: %s", rr.Code, rr.Body.String())
+	}
+	// The successful login reset the account's counter.
+	if rr := loginFrom(addr, user.Email, user.Password); rr.Code != http.StatusOK {
+		t.Fatalf("expected no captcha after a successful login, got %d", rr.Code)
+	}
+}
+
+func TestLoginCaptcha_RequiredAfterIPFailures(t *testing.T) {
+	withLoginCaptcha(t, 0, 3)
+	user := &models.User{FirstName: "Captcha", LastName: "Network", Email: uniqueEmail("login_captcha_ip"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	const addr = "198.51.100.31:4000"
+	t.Cleanup(func() { store.ClearLoginThrottle(models.ThrottleIP, "198.51.100.31") })
+
+	// Credential stuffing: one guess each for many accounts.
+	for i := 0; i < 3; i++ {
+		loginFrom(addr, uniqueEmail(fmt.Sprintf("login_captcha_ip_%d", i)), "Wrong123!")
+	}
+	rr := loginFrom(addr, user.Email, user.Password)
+	if rr.Code != http.StatusUnauthorized || !captchaRequired(rr) {
+		t.Fatalf("expected the client to need a captcha, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := loginFrom("198.51.100.32:4000", user.Email, user.Password); rr.Code != http.StatusOK {
+		t.Fatalf("expected other clients to log in without a captcha, got %d", rr.Code)
+	}
+
+	challenge, answer := fetchCaptcha(t, app.Captcha)
+	if rr := loginWithCaptcha(addr, user.Email, user.Password, challenge.ID, answer); rr.Code != http.StatusOK {
+		t.Fatalf("expected a login with a captcha, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
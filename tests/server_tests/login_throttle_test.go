@@ -0,0 +1,150 @@
+package server_tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"web-app/internal/models"
+)
+
+// loginFrom posts a password login as the client at remoteAddr.
+func loginFrom(remoteAddr, email, password string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"email":"%s","password":"%s"}`, email, password)
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleLogin).ServeHTTP(rr, req)
+	return rr
+}
+
+// withLoginLimits replaces the throttling settings for one test. The login
+// captcha is off, so only the delays and lockouts apply.
+func withLoginLimits(t *testing.T, maxFailures, ipMaxFailures int, delayBase time.Duration) {
+	t.Helper()
+
+	saved := app.Config
+	app.Config.LoginMaxFailures = maxFailures
+	app.Config.LoginIPMaxFailures = ipMaxFailures
+	app.Config.LoginDelayBase = delayBase
+	app.Config.LoginCaptchaAfter = 0
+	app.Config.LoginIPCaptchaAfter = 0
+	t.Cleanup(func() {
+		// Unlock links still being mailed read the config.
+		app.WaitForMail()
+		app.Config = saved
+	})
+}
+
+func expectTooManyAttempts(t *testing.T, rr *httptest.ResponseRecorder) {
+	t.Helper()
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusTooManyRequests, rr.Code, rr.Body.String())
+	}
+	if seconds, err := strconv.Atoi(rr.Header().Get("Retry-After")); err != nil || seconds <= 0 {
+		t.Fatalf("expected a positive Retry-After, got %q", rr.Header().Get("Retry-After"))
+	}
+}
+
+func TestLoginThrottle_ProgressiveDelay(t *testing.T) {
+	withLoginLimits(t, 0, 0, time.Hour)
+	user := &models.User{FirstName: "Slow", LastName: "Down", Email: uniqueEmail("throttle_delay"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	const addr = "198.51.100.1:4000"
+
+	// One typo costs nothing.
+	if rr := loginFrom(addr, user.Email, "Wrong123!"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := loginFrom(addr, user.Email, user.Password); rr.Code != http.StatusOK {
+		t.Fatalf("expected a login after one failure, got %d", rr.Code)
+	}
+
+	// The successful login reset the counter; two new failures impose a
+	// wait, even for the right password and in another letter case.
+	loginFrom(addr, user.Email, "Wrong123!")
+	loginFrom(addr, user.Email, "Wrong123!")
+	expectTooManyAttempts(t, loginFrom(addr, strings.ToUpper(user.Email), user.Password))
+}
+
+func TestLoginThrottle_LocksAccountAndNotifies(t *testing.T) {
+	withLoginLimits(t, 3, 0, 0)
+	var lockedUser *models.User
+	app.OnAccountLocked = func(user *models.User, until time.Time) { lockedUser = user }
+	t.Cleanup(func() { app.OnAccountLocked = nil })
+
+	user := &models.User{FirstName: "Locked", LastName: "Out", Email: uniqueEmail("throttle_lock"), Password: "Password123!"}
+	userID := int(store.SeedUser(t, user))
+	const addr = "198.51.100.2:4000"
+
+	for i := 0; i < 3; i++ {
+		if rr := loginFrom(addr, user.Email, "Wrong123!"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected status %d, got %d", i+1, http.StatusUnauthorized, rr.Code)
+		}
+	}
+	expectTooManyAttempts(t, loginFrom(addr, user.Email, user.Password))
+	// The lock is on the account, not on the client.
+	expectTooManyAttempts(t, loginFrom("198.51.100.3:4000", user.Email, user.Password))
+
+	if lockedUser == nil || lockedUser.ID != userID {
+		t.Fatalf("expected the lock hook to be called for user %d, got %+v", userID, lockedUser)
+	}
+
+	rr := httptest.NewRecorder()
+	body := fmt.Sprintf(`{"token":"%s"}`, mailedToken(t, user.Email, "/unlock-account"))
+	app.HandleUnlockAccount(rr, httptest.NewRequest(http.MethodPost, "/login/unlock", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the unlock link to work, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := loginFrom(addr, user.Email, user.Password); rr.Code != http.StatusOK {
+		t.Fatalf("expected a login after unlocking, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	app.HandleUnlockAccount(rr, httptest.NewRequest(http.MethodPost, "/login/unlock", strings.NewReader(body)))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a used unlock link to be rejected, got %d", rr.Code)
+	}
+}
+
+func TestLoginThrottle_UnknownEmailLooksTheSame(t *testing.T) {
+	withLoginLimits(t, 2, 0, 0)
+	email := uniqueEmail("throttle_unknown")
+	const addr = "198.51.100.4:4000"
+
+	loginFrom(addr, email, "Wrong123!")
+	if rr := loginFrom(addr, email, "Wrong123!"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	expectTooManyAttempts(t, loginFrom(addr, email, "Wrong123!"))
+	if _, ok := mailer.lastTo(email); ok {
+		t.Fatal("expected no email for an unregistered address")
+	}
+}
+
+func TestLoginThrottle_LocksClientIP(t *testing.T) {
+	withLoginLimits(t, 0, 3, 0)
+	user := &models.User{FirstName: "Shared", LastName: "Network", Email: uniqueEmail("throttle_ip"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	const addr = "198.51.100.5:4000"
+
+	// Guesses spread over many accounts still add up for the client.
+	for i := 0; i < 3; i++ {
+		loginFrom(addr, uniqueEmail(fmt.Sprintf("throttle_ip_%d", i)), "Wrong123!")
+	}
+	expectTooManyAttempts(t, loginFrom("198.51.100.5:5000", user.Email, user.Password))
+
+	if rr := loginFrom("198.51.100.6:4000", user.Email, user.Password); rr.Code != http.StatusOK {
+		t.Fatalf("expected other clients to log in, got %d", rr.Code)
+	}
+	if _, err := store.ClearLoginThrottle(models.ThrottleIP, "198.51.100.5"); err != nil {
+		t.Fatalf("ClearLoginThrottle failed: %v", err)
+	}
+	if rr := loginFrom(addr, user.Email, user.Password); rr.Code != http.StatusOK {
+		t.Fatalf("expected the client to log in once unlocked, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,140 @@
+package server_tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"web-app/internal/models"
+	"web-app/pkg/server"
+)
+
+// requestMagicLink asks for a sign-in link and returns the response and the
+// browser binding cookie it set.
+func requestMagicLink(t *testing.T, email string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"email":"%s"}`, email)
+	req := httptest.NewRequest(http.MethodPost, "/login/magic", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleMagicLinkRequest).ServeHTTP(rr, req)
+
+	cookie := responseCookie(rr, "magic_link")
+	if cookie == nil || cookie.Value == "" || !cookie.HttpOnly {
+		t.Fatalf("expected an HttpOnly magic_link cookie, got %+v", cookie)
+	}
+	return rr, cookie.Value
+}
+
+func redeemMagicLink(token, binding string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"token":"%s","remember_me":false}`, token)
+	req := httptest.NewRequest(http.MethodPost, "/login/magic/verify", strings.NewReader(body))
+	if binding != "" {
+		req.AddCookie(&http.Cookie{Name: "magic_link", Value: binding})
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleMagicLinkLogin).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestMagicLink_Flow(t *testing.T) {
+	user := &models.User{FirstName: "Magic", LastName: "Link", Email: uniqueEmail("magic_flow"), Password: "Password123!"}
+	userID := int(store.SeedUser(t, user))
+
+	_, binding := requestMagicLink(t, user.Email)
+	token := mailedToken(t, user.Email, "/login/magic")
+
+	rr := redeemMagicLink(token, binding)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	sessionCookie := responseCookie(rr, "session_token")
+	if sessionCookie == nil {
+		t.Fatal("expected a session cookie")
+	}
+	session, err := store.GetSessionByToken(sessionCookie.Value)
+	if err != nil || session.UserID != userID {
+		t.Fatalf("expected a session for user %d, got %+v, %v", userID, session, err)
+	}
+	cleared := false
+	for _, c := range rr.Result().Cookies() {
+		cleared = cleared || (c.Name == "magic_link" && c.MaxAge < 0)
+	}
+	if !cleared {
+		t.Fatal("expected the binding cookie to be cleared")
+	}
+
+	if rr := redeemMagicLink(token, binding); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a used link to be rejected, got %d", rr.Code)
+	}
+}
+
+func TestMagicLink_BoundToRequestingBrowser(t *testing.T) {
+	user := &models.User{FirstName: "Bound", LastName: "Link", Email: uniqueEmail("magic_bound"), Password: "Password123!"}
+	store.SeedUser(t, user)
+
+	_, binding := requestMagicLink(t, user.Email)
+	token := mailedToken(t, user.Email, "/login/magic")
+
+	if rr := redeemMagicLink(token, ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a browser without the cookie to be rejected, got %d", rr.Code)
+	}
+	if rr := redeemMagicLink(token, "another-browser"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected another browser's cookie to be rejected, got %d", rr.Code)
+	}
+	// Failed attempts elsewhere do not use the link up.
+	if rr := redeemMagicLink(token, binding); rr.Code != http.StatusOK {
+		t.Fatalf("expected the requesting browser to sign in, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestMagicLink_UnknownEmailLooksTheSame(t *testing.T) {
+	user := &models.User{FirstName: "Known", LastName: "Magic", Email: uniqueEmail("magic_known"), Password: "Password123!"}
+	store.SeedUser(t, user)
+
+	known, _ := requestMagicLink(t, user.Email)
+	unknownEmail := uniqueEmail("magic_unknown")
+	unknown, _ := requestMagicLink(t, unknownEmail)
+
+	if known.Code != unknown.Code || known.Body.String() != unknown.Body.String() {
+		t.Fatalf("expected identical responses, got %d %q and %d %q", known.Code, known.Body.String(), unknown.Code, unknown.Body.String())
+	}
+	if _, ok := mailer.lastTo(unknownEmail); ok {
+		t.Fatal("expected no email for an unregistered address")
+	}
+}
+
+func TestMagicLink_RequiresSecondFactor(t *testing.T) {
+	user := &models.User{FirstName: "Magic", LastName: "MFA", Email: uniqueEmail("magic_mfa"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	enableTwoFactor(t, loginCookie(t, user.Email, user.Password))
+
+	_, binding := requestMagicLink(t, user.Email)
+	rr := redeemMagicLink(mailedToken(t, user.Email, "/login/magic"), binding)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"mfa_required":true`) {
+		t.Fatalf("expected a second factor to be required, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if responseCookie(rr, "session_token") != nil {
+		t.Fatal("expected no session before the second factor")
+	}
+	if responseCookie(rr, "mfa_challenge") == nil {
+		t.Fatal("expected an MFA challenge cookie")
+	}
+}
+
+func TestMagicLink_VerifiesEmail(t *testing.T) {
+	app.Config.UnverifiedPolicy = server.VerificationBlock
+	t.Cleanup(func() { app.Config.UnverifiedPolicy = server.VerificationAllow })
+
+	user := &models.User{FirstName: "Unverified", LastName: "Magic", Email: uniqueEmail("magic_unverified"), Password: "Password123!"}
+	userID := store.SeedUser(t, user)
+
+	_, binding := requestMagicLink(t, user.Email)
+	if rr := redeemMagicLink(mailedToken(t, user.Email, "/login/magic"), binding); rr.Code != http.StatusOK {
+		t.Fatalf("expected the link to sign in, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if stored, _ := store.GetUserByID(int(userID)); !stored.EmailVerified {
+		t.Fatal("expected the email to be verified by the link")
+	}
+}
@@ -164,7 +164,7 @@ func TestSessionLoader_ValidCookieSetsContext(t *testing.T) {
 		Email:     uniqueEmail("session_loader"),
 		Password:  "Password123!",
 	}
-	userID := app.DB.SeedUser(t, user)
+	userID := store.SeedUser(t, user)
 
 	loginBody := fmt.Sprintf(`{"email":"%s", "password":"Password123!"}`, user.Email)
 	loginReq := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(loginBody))
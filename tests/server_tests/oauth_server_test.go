@@ -0,0 +1,438 @@
+package server_tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"web-app/internal/models"
+	"web-app/internal/oidc"
+)
+
+var (
+	signingKeyOnce sync.Once
+	signingKey     *rsa.PrivateKey
+)
+
+// startAuthorizationServer serves the app's OAuth endpoints on a local
+// server, which also becomes the issuer, for the duration of the test.
+func startAuthorizationServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	signingKeyOnce.Do(func() {
+		var err error
+		if signingKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			panic(err)
+		}
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", app.HandleOpenIDConfiguration)
+	mux.HandleFunc("GET /oauth/jwks", app.HandleJWKS)
+	mux.Handle("GET /oauth/authorize", app.SessionLoader(http.HandlerFunc(app.HandleAuthorize)))
+	mux.HandleFunc("POST /oauth/token", app.HandleToken)
+	mux.HandleFunc("GET /oauth/userinfo", app.HandleUserInfo)
+	srv := httptest.NewServer(mux)
+
+	baseURL := app.Config.BaseURL
+	app.SigningKey = signingKey
+	app.Config.BaseURL = srv.URL
+	t.Cleanup(func() {
+		srv.Close()
+		app.SigningKey = nil
+		app.Config.BaseURL = baseURL
+	})
+	return srv
+}
+
+func registerOAuthClient(t *testing.T, secret string) *models.OAuthClient {
+	t.Helper()
+
+	client := &models.OAuthClient{Name: "Wiki", RedirectURIs: []string{"https://wiki.example/callback"}}
+	if err := store.CreateOAuthClient(client, secret); err != nil {
+		t.Fatalf("CreateOAuthClient failed: %v", err)
+	}
+	return client
+}
+
+// authorizationQuery builds the query of an authorization request with the
+// PKCE challenge for verifier.
+func authorizationQuery(client *models.OAuthClient, scope, verifier string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ID},
+		"redirect_uri":          {client.RedirectURIs[0]},
+		"scope":                 {scope},
+		"state":                 {"client-state"},
+		"nonce":                 {"client-nonce"},
+		"code_challenge":        {oidc.CodeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func authorize(query url.Values, session string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil)
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+	}
+	rr := httptest.NewRecorder()
+	app.SessionLoader(http.HandlerFunc(app.HandleAuthorize)).ServeHTTP(rr, req)
+	return rr
+}
+
+// consentRequest loads the consent screen for query as the user behind
+// session and returns the request ID it was given.
+func consentRequest(t *testing.T, query url.Values, session string) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/oauth/authorize?"+query.Encode(), nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+	rr := httptest.NewRecorder()
+	app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleAuthorizeDetails))).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected consent details, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var details struct {
+		RequestID  string   `json:"request_id"`
+		ClientName string   `json:"client_name"`
+		Scopes     []string `json:"scopes"`
+	}
+	json.NewDecoder(rr.Body).Decode(&details)
+	if details.RequestID == "" || details.ClientName != "Wiki" || len(details.Scopes) == 0 {
+		t.Fatalf("unexpected consent details %+v", details)
+	}
+	return details.RequestID
+}
+
+func decideConsent(requestID, session string, approve bool) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"request_id":%q,"approve":%t}`, requestID, approve)
+	return serveAuthed(app.HandleAuthorizeDecision, session, body)
+}
+
+// approveAuthorization runs the consent screen for query and returns the
+// authorization code sent back to the client.
+func approveAuthorization(t *testing.T, query url.Values, session string) string {
+	t.Helper()
+
+	rr := decideConsent(consentRequest(t, query, session), session, true)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the decision to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var decision struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+	json.NewDecoder(rr.Body).Decode(&decision)
+	return expectCode(t, decision.RedirectTo, query)
+}
+
+// expectCode checks that location is the client's redirect URI carrying a
+// code and the client's state, and returns the code.
+func expectCode(t *testing.T, location string, query url.Values) string {
+	t.Helper()
+
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme+"://"+u.Host+u.Path != query.Get("redirect_uri") {
+		t.Fatalf("expected a redirect to the client, got %q", location)
+	}
+	if u.Query().Get("state") != query.Get("state") || u.Query().Get("code") == "" {
+		t.Fatalf("expected a code and the client's state, got %q", location)
+	}
+	return u.Query().Get("code")
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	Scope        string `json:"scope"`
+	Error        string `json:"error"`
+}
+
+func requestToken(client *models.OAuthClient, secret string, form url.Values) (int, tokenResponse) {
+	if secret == "" {
+		form.Set("client_id", client.ID)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != "" {
+		req.SetBasicAuth(url.QueryEscape(client.ID), url.QueryEscape(secret))
+	}
+	rr := httptest.NewRecorder()
+	app.HandleToken(rr, req)
+	var response tokenResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	return rr.Code, response
+}
+
+func redeemCode(client *models.OAuthClient, secret, code, verifier string) (int, tokenResponse) {
+	return requestToken(client, secret, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {client.RedirectURIs[0]},
+		"code_verifier": {verifier},
+	})
+}
+
+func userInfo(accessToken string) (int, map[string]any) {
+	req := httptest.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	rr := httptest.NewRecorder()
+	app.HandleUserInfo(rr, req)
+	var claims map[string]any
+	json.NewDecoder(rr.Body).Decode(&claims)
+	return rr.Code, claims
+}
+
+func TestOAuth_AuthorizationCodeFlow(t *testing.T) {
+	srv := startAuthorizationServer(t)
+	secret := "client-secret"
+	client := registerOAuthClient(t, secret)
+	user := &models.User{FirstName: "OAuth", LastName: "User", Email: uniqueEmail("oauth_flow"), Password: "Password123!"}
+	userID := int(store.SeedUser(t, user))
+
+	verifier, _ := oidc.RandomString()
+	query := authorizationQuery(client, "openid email profile", verifier)
+
+	// Without a session the user logs in first and comes back.
+	rr := authorize(query, "")
+	location := rr.Header().Get("Location")
+	if rr.Code != http.StatusFound || !strings.HasPrefix(location, "/login?next=") {
+		t.Fatalf("expected a redirect to the login page, got %d to %q", rr.Code, location)
+	}
+	next, _ := url.Parse(location)
+	if !strings.HasPrefix(next.Query().Get("next"), "/oauth/authorize?") {
+		t.Fatalf("expected the login page to return to the request, got %q", location)
+	}
+
+	session := loginCookie(t, user.Email, user.Password)
+	if rr := authorize(query, session); rr.Code != http.StatusOK && rr.Code != http.StatusNotFound {
+		// The consent page is a static file; 404 only means ./web is not
+		// reachable from the test's working directory.
+		t.Fatalf("expected the consent screen, got %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	code := approveAuthorization(t, query, session)
+
+	// The app's own relying party checks discovery, JWKS and the ID token.
+	rp := oidc.NewProvider(oidc.Config{
+		Issuer:       srv.URL,
+		ClientID:     client.ID,
+		ClientSecret: secret,
+		RedirectURL:  client.RedirectURIs[0],
+	})
+	rawIDToken, err := rp.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	idToken, err := rp.VerifyIDToken(context.Background(), rawIDToken, "client-nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken failed: %v", err)
+	}
+	if idToken.Subject != fmt.Sprint(userID) || idToken.Email != user.Email || idToken.GivenName != "OAuth" {
+		t.Fatalf("unexpected ID token %+v", idToken)
+	}
+
+	// Consent is remembered: the next request goes straight back with a code.
+	verifier, _ = oidc.RandomString()
+	query = authorizationQuery(client, "openid email", verifier)
+	code = expectCode(t, authorize(query, session).Header().Get("Location"), query)
+	if status, tokens := redeemCode(client, secret, code, verifier); status != http.StatusOK || tokens.IDToken == "" {
+		t.Fatalf("expected tokens, got %d %+v", status, tokens)
+	}
+
+	// prompt=consent asks again.
+	query.Set("prompt", "consent")
+	if rr := authorize(query, session); rr.Code == http.StatusFound {
+		t.Fatalf("expected the consent screen, got a redirect to %q", rr.Header().Get("Location"))
+	}
+}
+
+func TestOAuth_UserInfoAndRefreshTokens(t *testing.T) {
+	startAuthorizationServer(t)
+	client := registerOAuthClient(t, "")
+	user := &models.User{FirstName: "Refresh", LastName: "User", Email: uniqueEmail("oauth_refresh"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	session := loginCookie(t, user.Email, user.Password)
+
+	verifier, _ := oidc.RandomString()
+	query := authorizationQuery(client, "openid email offline_access", verifier)
+	status, tokens := redeemCode(client, "", approveAuthorization(t, query, session), verifier)
+	if status != http.StatusOK || tokens.TokenType != "Bearer" || tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("expected access and refresh tokens, got %d %+v", status, tokens)
+	}
+
+	status, claims := userInfo(tokens.AccessToken)
+	if status != http.StatusOK || claims["email"] != user.Email || claims["given_name"] != nil {
+		t.Fatalf("expected the email claims only, got %d %v", status, claims)
+	}
+	if status, _ := userInfo("not-a-token"); status != http.StatusUnauthorized {
+		t.Fatalf("expected an unknown token to be rejected, got %d", status)
+	}
+
+	refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}
+	status, refreshed := requestToken(client, "", refresh)
+	if status != http.StatusOK || refreshed.AccessToken == "" || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("expected a new token pair, got %d %+v", status, refreshed)
+	}
+	if status, response := requestToken(client, "", refresh); status != http.StatusBadRequest || response.Error != "invalid_grant" {
+		t.Fatalf("expected a used refresh token to be rejected, got %d %+v", status, response)
+	}
+
+	wider := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshed.RefreshToken}, "scope": {"openid profile"}}
+	if status, response := requestToken(client, "", wider); status != http.StatusBadRequest || response.Error != "invalid_scope" {
+		t.Fatalf("expected a wider scope to be rejected, got %d %+v", status, response)
+	}
+
+	// Neither a rejected scope nor another client presenting the token uses
+	// it up for its owner.
+	other := registerOAuthClient(t, "")
+	stolen := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshed.RefreshToken}}
+	if status, response := requestToken(other, "", stolen); status != http.StatusBadRequest || response.Error != "invalid_grant" {
+		t.Fatalf("expected another client's refresh token to be rejected, got %d %+v", status, response)
+	}
+	refresh = url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshed.RefreshToken}}
+	if status, response := requestToken(client, "", refresh); status != http.StatusOK || response.AccessToken == "" {
+		t.Fatalf("expected the owner to redeem the refresh token, got %d %+v", status, response)
+	}
+}
+
+func TestOAuth_CodeIsBoundToClientAndVerifier(t *testing.T) {
+	startAuthorizationServer(t)
+	client := registerOAuthClient(t, "secret-a")
+	other := registerOAuthClient(t, "secret-b")
+	user := &models.User{FirstName: "Code", LastName: "User", Email: uniqueEmail("oauth_code"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	session := loginCookie(t, user.Email, user.Password)
+	verifier, _ := oidc.RandomString()
+	query := authorizationQuery(client, "openid", verifier)
+
+	if status, response := redeemCode(client, "wrong-secret", approveAuthorization(t, query, session), verifier); status != http.StatusUnauthorized || response.Error != "invalid_client" {
+		t.Fatalf("expected a wrong secret to be rejected, got %d %+v", status, response)
+	}
+	if status, response := redeemCode(other, "secret-b", approveAuthorization(t, query, session), verifier); status != http.StatusBadRequest || response.Error != "invalid_grant" {
+		t.Fatalf("expected another client's code to be rejected, got %d %+v", status, response)
+	}
+	if status, response := redeemCode(client, "secret-a", approveAuthorization(t, query, session), "wrong-verifier"); status != http.StatusBadRequest || response.Error != "invalid_grant" {
+		t.Fatalf("expected a wrong PKCE verifier to be rejected, got %d %+v", status, response)
+	}
+
+	code := approveAuthorization(t, query, session)
+	if status, _ := redeemCode(client, "secret-a", code, verifier); status != http.StatusOK {
+		t.Fatalf("expected the code to be redeemed, got %d", status)
+	}
+	if status, response := redeemCode(client, "secret-a", code, verifier); status != http.StatusBadRequest || response.Error != "invalid_grant" {
+		t.Fatalf("expected a code to be single use, got %d %+v", status, response)
+	}
+}
+
+func TestOAuth_InvalidAuthorizationRequests(t *testing.T) {
+	startAuthorizationServer(t)
+	client := registerOAuthClient(t, "secret")
+	verifier, _ := oidc.RandomString()
+
+	// An unregistered redirect URI is never redirected to.
+	query := authorizationQuery(client, "openid", verifier)
+	query.Set("redirect_uri", "https://evil.example/callback")
+	if rr := authorize(query, ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	cases := map[string]struct {
+		edit  func(url.Values)
+		error string
+	}{
+		"no PKCE":       {func(q url.Values) { q.Del("code_challenge") }, "invalid_request"},
+		"plain PKCE":    {func(q url.Values) { q.Set("code_challenge_method", "plain") }, "invalid_request"},
+		"implicit flow": {func(q url.Values) { q.Set("response_type", "token") }, "unsupported_response_type"},
+		"unknown scope": {func(q url.Values) { q.Set("scope", "openid admin") }, "invalid_scope"},
+		"prompt=none":   {func(q url.Values) { q.Set("prompt", "none") }, "login_required"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			query := authorizationQuery(client, "openid", verifier)
+			c.edit(query)
+			rr := authorize(query, "")
+			u, _ := url.Parse(rr.Header().Get("Location"))
+			if rr.Code != http.StatusFound || u.Host != "wiki.example" || u.Query().Get("error") != c.error || u.Query().Get("state") != "client-state" {
+				t.Fatalf("expected error %s at the client, got %d to %q", c.error, rr.Code, rr.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestOAuth_ConsentDecision(t *testing.T) {
+	startAuthorizationServer(t)
+	client := registerOAuthClient(t, "secret")
+	user := &models.User{FirstName: "Deny", LastName: "User", Email: uniqueEmail("oauth_deny"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	other := &models.User{FirstName: "Other", LastName: "User", Email: uniqueEmail("oauth_other"), Password: "Password123!"}
+	store.SeedUser(t, other)
+	session := loginCookie(t, user.Email, user.Password)
+	verifier, _ := oidc.RandomString()
+	query := authorizationQuery(client, "openid", verifier)
+
+	// A request ID only works for the user it was shown to.
+	requestID := consentRequest(t, query, session)
+	if rr := decideConsent(requestID, loginCookie(t, other.Email, other.Password), true); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	rr := decideConsent(consentRequest(t, query, session), session, false)
+	var decision struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+	json.NewDecoder(rr.Body).Decode(&decision)
+	u, _ := url.Parse(decision.RedirectTo)
+	if u.Query().Get("error") != "access_denied" || u.Query().Get("code") != "" || u.Query().Get("state") != "client-state" {
+		t.Fatalf("expected access_denied at the client, got %q", decision.RedirectTo)
+	}
+	// Denying does not record consent.
+	if rr := authorize(query, session); rr.Code == http.StatusFound {
+		t.Fatalf("expected the consent screen again, got a redirect to %q", rr.Header().Get("Location"))
+	}
+}
+
+func TestOAuth_PasswordChangeRevokesTokens(t *testing.T) {
+	startAuthorizationServer(t)
+	client := registerOAuthClient(t, "secret")
+	user := &models.User{FirstName: "Revoke", LastName: "User", Email: uniqueEmail("oauth_revoke"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	session := loginCookie(t, user.Email, user.Password)
+	verifier, _ := oidc.RandomString()
+
+	_, tokens := redeemCode(client, "secret", approveAuthorization(t, authorizationQuery(client, "openid offline_access", verifier), session), verifier)
+	if status, _ := userInfo(tokens.AccessToken); status != http.StatusOK {
+		t.Fatalf("expected the access token to work, got %d", status)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/profile/updatePassword", strings.NewReader(`{"current_password":"Password123!","new_password":"NewPassword123!"}`))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+	rr := httptest.NewRecorder()
+	app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleUpdatePassword))).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the password to change, got %d", rr.Code)
+	}
+
+	if status, _ := userInfo(tokens.AccessToken); status != http.StatusUnauthorized {
+		t.Fatalf("expected the access token to be revoked, got %d", status)
+	}
+	refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}
+	if status, _ := requestToken(client, "secret", refresh); status != http.StatusBadRequest {
+		t.Fatalf("expected the refresh token to be revoked, got %d", status)
+	}
+}
+
+func TestOAuth_DisabledWithoutSigningKey(t *testing.T) {
+	// Only startAuthorizationServer installs a key, and only for its test.
+	rr := httptest.NewRecorder()
+	app.HandleOpenIDConfiguration(rr, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
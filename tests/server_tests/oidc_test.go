@@ -0,0 +1,286 @@
+package server_tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"web-app/internal/models"
+	"web-app/internal/oidc"
+	"web-app/internal/oidc/oidctest"
+	"web-app/pkg/server"
+)
+
+// newMockIssuer registers a mock OIDC provider under the name "mock" for
+// the duration of the test.
+func newMockIssuer(t *testing.T, allowSignup bool) *oidctest.Server {
+	t.Helper()
+
+	issuer, err := oidctest.NewServer("web-app-client", "s3cret:with/odd chars")
+	if err != nil {
+		t.Fatalf("failed to start mock issuer: %v", err)
+	}
+	t.Cleanup(issuer.Close)
+
+	app.OIDCProviders = map[string]*server.OIDCProvider{
+		"mock": {
+			Name:        "mock",
+			DisplayName: "Mock IdP",
+			AllowSignup: allowSignup,
+			Provider: oidc.NewProvider(oidc.Config{
+				Issuer:       issuer.URL,
+				ClientID:     issuer.ClientID,
+				ClientSecret: issuer.ClientSecret,
+				RedirectURL:  app.Config.BaseURL + server.OIDCCallbackPath("mock"),
+			}),
+		},
+	}
+	t.Cleanup(func() { app.OIDCProviders = nil })
+	return issuer
+}
+
+// startOIDCLogin hits the login endpoint and lets the mock issuer approve
+// it. It returns the state cookie and the callback URL the issuer redirected
+// to.
+func startOIDCLogin(t *testing.T, query, session string) (*http.Cookie, *url.URL) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/login/oidc/mock"+query, nil)
+	req.SetPathValue("provider", "mock")
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+	}
+	rr := httptest.NewRecorder()
+	app.SessionLoader(http.HandlerFunc(app.HandleOIDCLogin)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected a redirect to the issuer, got %d", rr.Code)
+	}
+	state := responseCookie(rr, "oidc_state")
+	if state == nil || state.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("expected a Lax oidc_state cookie, got %+v", state)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected the issuer to redirect back, got %d", resp.StatusCode)
+	}
+	callback, _ := url.Parse(resp.Header.Get("Location"))
+	if callback.Path != server.OIDCCallbackPath("mock") || callback.Query().Get("state") != state.Value {
+		t.Fatalf("unexpected callback %s", callback)
+	}
+	return state, callback
+}
+
+func finishOIDCLogin(state *http.Cookie, callback *url.URL) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	req.SetPathValue("provider", "mock")
+	if state != nil {
+		req.AddCookie(state)
+	}
+	rr := httptest.NewRecorder()
+	app.HandleOIDCCallback(rr, req)
+	return rr
+}
+
+func oidcLogin(t *testing.T) *httptest.ResponseRecorder {
+	t.Helper()
+	return finishOIDCLogin(startOIDCLogin(t, "", ""))
+}
+
+// expectOIDCSession checks that the callback logged userID in.
+func expectOIDCSession(t *testing.T, rr *httptest.ResponseRecorder, userID int) {
+	t.Helper()
+
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/" {
+		t.Fatalf("expected a redirect home, got %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	cookie := responseCookie(rr, "session_token")
+	if cookie == nil {
+		t.Fatal("expected a session cookie")
+	}
+	s, err := store.GetSessionByToken(cookie.Value)
+	if err != nil || (userID != 0 && s.UserID != userID) {
+		t.Fatalf("expected a session for user %d, got %+v (%v)", userID, s, err)
+	}
+}
+
+func expectOIDCError(t *testing.T, rr *httptest.ResponseRecorder, page string) {
+	t.Helper()
+
+	location := rr.Header().Get("Location")
+	if rr.Code != http.StatusFound || !strings.HasPrefix(location, page+"?error=") {
+		t.Fatalf("expected a redirect to %s with an error, got %d to %q", page, rr.Code, location)
+	}
+	if responseCookie(rr, "session_token") != nil {
+		t.Fatal("expected no session")
+	}
+}
+
+func TestOIDC_SignupCreatesAccount(t *testing.T) {
+	issuer := newMockIssuer(t, true)
+	email := uniqueEmail("oidc_signup")
+	issuer.SetIdentity(oidctest.Identity{Subject: "sub-signup", Email: email, EmailVerified: true, GivenName: "Ext", FamilyName: "User"})
+
+	expectOIDCSession(t, oidcLogin(t), 0)
+	user, err := store.GetUserByEmail(email)
+	if err != nil {
+		t.Fatalf("expected the account to be created: %v", err)
+	}
+	if user.FirstName != "Ext" || user.LastName != "User" || !user.EmailVerified {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	// The next login finds the same account through the identity link.
+	issuer.SetIdentity(oidctest.Identity{Subject: "sub-signup", Email: "changed-" + email, EmailVerified: true})
+	expectOIDCSession(t, oidcLogin(t), user.ID)
+}
+
+func TestOIDC_SignupDisabled(t *testing.T) {
+	issuer := newMockIssuer(t, false)
+	email := uniqueEmail("oidc_nosignup")
+	issuer.SetIdentity(oidctest.Identity{Subject: "sub-nosignup", Email: email, EmailVerified: true})
+
+	expectOIDCError(t, oidcLogin(t), "/login")
+	if _, err := store.GetUserByEmail(email); err == nil {
+		t.Fatal("expected no account to be created")
+	}
+}
+
+func TestOIDC_LinksByVerifiedEmailOnly(t *testing.T) {
+	issuer := newMockIssuer(t, true)
+	user := &models.User{FirstName: "Local", LastName: "User", Email: uniqueEmail("oidc_existing"), Password: "Password123!"}
+	userID := int(store.SeedUser(t, user))
+
+	// Without a verified address the provider could claim anyone's email.
+	issuer.SetIdentity(oidctest.Identity{Subject: "sub-unverified", Email: user.Email, EmailVerified: false})
+	expectOIDCError(t, oidcLogin(t), "/login")
+
+	// Nor is an account whose owner never proved the address: someone else
+	// may have registered it with a password they know.
+	issuer.SetIdentity(oidctest.Identity{Subject: "sub-verified", Email: user.Email, EmailVerified: true})
+	expectOIDCError(t, oidcLogin(t), "/login")
+	if identities, _ := store.ListUserIdentities(userID); len(identities) != 0 {
+		t.Fatalf("expected no identity to be linked, got %+v", identities)
+	}
+
+	if err := store.MarkEmailVerified(userID); err != nil {
+		t.Fatalf("MarkEmailVerified failed: %v", err)
+	}
+	expectOIDCSession(t, oidcLogin(t), userID)
+	if identities, _ := store.ListUserIdentities(userID); len(identities) != 1 || identities[0].Provider != "mock" {
+		t.Fatalf("expected the identity to be linked, got %+v", identities)
+	}
+}
+
+func TestOIDC_RejectsInvalidIDTokens(t *testing.T) {
+	issuer := newMockIssuer(t, true)
+	issuer.SetIdentity(oidctest.Identity{Subject: "sub-forged", Email: uniqueEmail("oidc_forged"), EmailVerified: true})
+
+	forgeries := map[string]func(claims map[string]any){
+		"nonce":    func(c map[string]any) { c["nonce"] = "attacker-nonce" },
+		"audience": func(c map[string]any) { c["aud"] = "another-client" },
+		"issuer":   func(c map[string]any) { c["iss"] = "https://evil.example" },
+		"expired":  func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"subject":  func(c map[string]any) { delete(c, "sub") },
+	}
+	for name, forge := range forgeries {
+		t.Run(name, func(t *testing.T) {
+			issuer.MutateIDToken(forge)
+			defer issuer.MutateIDToken(nil)
+			expectOIDCError(t, oidcLogin(t), "/login")
+		})
+	}
+}
+
+func TestOIDC_IssuerWithTrailingSlash(t *testing.T) {
+	issuer := newMockIssuer(t, true)
+	issuer.SetIdentity(oidctest.Identity{Subject: "sub-slash", Email: uniqueEmail("oidc_slash"), EmailVerified: true})
+
+	// Providers such as Auth0 put "https://tenant.example/" in iss.
+	issuer.MutateIDToken(func(c map[string]any) { c["iss"] = issuer.URL + "/" })
+	defer issuer.MutateIDToken(nil)
+	expectOIDCSession(t, oidcLogin(t), 0)
+}
+
+func TestOIDC_StateIsBoundAndSingleUse(t *testing.T) {
+	issuer := newMockIssuer(t, true)
+	issuer.SetIdentity(oidctest.Identity{Subject: "sub-state", Email: uniqueEmail("oidc_state"), EmailVerified: true})
+
+	// A callback link without the browser's state cookie, as in login CSRF.
+	_, callback := startOIDCLogin(t, "", "")
+	expectOIDCError(t, finishOIDCLogin(nil, callback), "/login")
+
+	state, callback := startOIDCLogin(t, "", "")
+	expectOIDCSession(t, finishOIDCLogin(state, callback), 0)
+	expectOIDCError(t, finishOIDCLogin(state, callback), "/login")
+}
+
+func TestOIDC_RefetchesRotatedKeys(t *testing.T) {
+	issuer := newMockIssuer(t, true)
+	issuer.SetIdentity(oidctest.Identity{Subject: "sub-rotate", Email: uniqueEmail("oidc_rotate"), EmailVerified: true})
+	expectOIDCSession(t, oidcLogin(t), 0)
+
+	if err := issuer.RotateKey(); err != nil {
+		t.Fatalf("RotateKey failed: %v", err)
+	}
+	expectOIDCSession(t, oidcLogin(t), 0)
+}
+
+func TestOIDC_LinkFromProfile(t *testing.T) {
+	issuer := newMockIssuer(t, false)
+	user := &models.User{FirstName: "Link", LastName: "Me", Email: uniqueEmail("oidc_link"), Password: "Password123!"}
+	userID := int(store.SeedUser(t, user))
+	session := loginCookie(t, user.Email, user.Password)
+
+	issuer.SetIdentity(oidctest.Identity{Subject: "sub-link", Email: "corporate-" + user.Email})
+	rr := finishOIDCLogin(startOIDCLogin(t, "?link=1", session))
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/profile" {
+		t.Fatalf("expected a redirect to the profile, got %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	expectOIDCSession(t, oidcLogin(t), userID)
+
+	// The same external account cannot be linked to a second user.
+	other := &models.User{FirstName: "Link", LastName: "Other", Email: uniqueEmail("oidc_link_other"), Password: "Password123!"}
+	store.SeedUser(t, other)
+	rr = finishOIDCLogin(startOIDCLogin(t, "?link=1", loginCookie(t, other.Email, other.Password)))
+	expectOIDCError(t, rr, "/profile")
+}
+
+func TestOIDC_TwoFactorStillRequired(t *testing.T) {
+	issuer := newMockIssuer(t, false)
+	user := &models.User{FirstName: "Ext", LastName: "Mfa", Email: uniqueEmail("oidc_mfa"), Password: "Password123!"}
+	userID := int(store.SeedUser(t, user))
+	if err := store.MarkEmailVerified(userID); err != nil {
+		t.Fatalf("MarkEmailVerified failed: %v", err)
+	}
+	enableTwoFactor(t, loginCookie(t, user.Email, user.Password))
+
+	issuer.SetIdentity(oidctest.Identity{Subject: "sub-mfa", Email: user.Email, EmailVerified: true})
+	rr := oidcLogin(t)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/login?mfa=1" {
+		t.Fatalf("expected a redirect to the second factor, got %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if responseCookie(rr, "session_token") != nil || responseCookie(rr, "mfa_challenge") == nil {
+		t.Fatal("expected a pending MFA challenge instead of a session")
+	}
+}
+
+func TestOIDC_UnknownProvider(t *testing.T) {
+	newMockIssuer(t, true)
+
+	req := httptest.NewRequest(http.MethodGet, "/login/oidc/nope", nil)
+	req.SetPathValue("provider", "nope")
+	rr := httptest.NewRecorder()
+	app.HandleOIDCLogin(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
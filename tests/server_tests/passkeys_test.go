@@ -0,0 +1,318 @@
+package server_tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"web-app/internal/models"
+	"web-app/internal/webauthn/webauthntest"
+)
+
+var b64 = base64.RawURLEncoding
+
+func newAuthenticator(t *testing.T) *webauthntest.Authenticator {
+	t.Helper()
+
+	a, err := webauthntest.New(app.Config.WebAuthnRPID, app.Config.WebAuthnOrigin)
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+	return a
+}
+
+// registerPasskey runs the registration ceremony for the user behind
+// session and returns the finish response with the renewed session token.
+func registerPasskey(t *testing.T, session, password string, a *webauthntest.Authenticator, name string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+
+	rr := serveAuthed(app.HandlePasskeyRegisterBegin, session, fmt.Sprintf(`{"password":%q}`, password))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected begin status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var options struct {
+		Challenge string `json:"challenge"`
+	}
+	json.NewDecoder(rr.Body).Decode(&options)
+	challenge, err := b64.DecodeString(options.Challenge)
+	if err != nil || len(challenge) == 0 {
+		t.Fatalf("invalid challenge %q", options.Challenge)
+	}
+
+	clientData, attestation := a.Create(challenge)
+	body := fmt.Sprintf(`{"name":%q,"client_data_json":"%s","attestation_object":"%s"}`,
+		name, b64.EncodeToString(clientData), b64.EncodeToString(attestation))
+	rr = serveAuthed(app.HandlePasskeyRegisterFinish, session, body)
+	if renewed := responseCookie(rr, "session_token"); renewed != nil {
+		session = renewed.Value
+	}
+	return rr, session
+}
+
+// signPasskeyLogin asks the server for a login challenge, signs it and
+// returns the finish request body.
+func signPasskeyLogin(t *testing.T, a *webauthntest.Authenticator) string {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	app.HandlePasskeyLoginBegin(rr, httptest.NewRequest(http.MethodPost, "/login/passkey/begin", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected begin status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var options struct {
+		Challenge string `json:"challenge"`
+		RPID      string `json:"rpId"`
+	}
+	json.NewDecoder(rr.Body).Decode(&options)
+	if options.RPID != app.Config.WebAuthnRPID {
+		t.Fatalf("expected rpId %q, got %q", app.Config.WebAuthnRPID, options.RPID)
+	}
+	challenge, _ := b64.DecodeString(options.Challenge)
+
+	clientData, authData, signature := a.Get(challenge)
+	return fmt.Sprintf(`{"credential_id":"%s","client_data_json":"%s","authenticator_data":"%s","signature":"%s"}`,
+		b64.EncodeToString(a.CredentialID()), b64.EncodeToString(clientData), b64.EncodeToString(authData), b64.EncodeToString(signature))
+}
+
+func finishPasskeyLogin(body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/login/passkey/finish", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	app.HandlePasskeyLoginFinish(rr, req)
+	return rr
+}
+
+func listPasskeys(t *testing.T, session string) []models.Passkey {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/passkeys", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+	rr := httptest.NewRecorder()
+	app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleListPasskeys))).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected list status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var passkeys []models.Passkey
+	json.NewDecoder(rr.Body).Decode(&passkeys)
+	return passkeys
+}
+
+func deletePasskey(session, password, id string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodDelete, "/api/passkeys/"+id, strings.NewReader(fmt.Sprintf(`{"password":%q}`, password)))
+	req.SetPathValue("id", id)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+	rr := httptest.NewRecorder()
+	app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleDeletePasskey))).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPasskeys_RegisterAndLogin(t *testing.T) {
+	user := &models.User{FirstName: "Pass", LastName: "Key", Email: uniqueEmail("passkey_login"), Password: "Password123!"}
+	userID := store.SeedUser(t, user)
+	session := loginCookie(t, user.Email, user.Password)
+	a := newAuthenticator(t)
+
+	registered, session := registerPasskey(t, session, user.Password, a, "Laptop")
+	if registered.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, registered.Code, registered.Body.String())
+	}
+	passkeys := listPasskeys(t, session)
+	if len(passkeys) != 1 || passkeys[0].Name != "Laptop" || passkeys[0].LastUsedAt != nil {
+		t.Fatalf("unexpected passkeys %+v", passkeys)
+	}
+
+	assertion := signPasskeyLogin(t, a)
+	rr := finishPasskeyLogin(assertion)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	cookie := responseCookie(rr, "session_token")
+	if cookie == nil {
+		t.Fatal("expected a session cookie after passkey login")
+	}
+	s, err := store.GetSessionByToken(cookie.Value)
+	if err != nil || s.UserID != int(userID) {
+		t.Fatalf("expected a session for user %d, got %+v (%v)", userID, s, err)
+	}
+
+	if rr := finishPasskeyLogin(assertion); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a replayed assertion to be rejected, got %d", rr.Code)
+	}
+
+	passkeys = listPasskeys(t, session)
+	if passkeys[0].LastUsedAt == nil {
+		t.Fatal("expected the login to be recorded on the passkey")
+	}
+}
+
+func TestPasskeys_RegisterTwiceConflicts(t *testing.T) {
+	user := &models.User{FirstName: "Pass", LastName: "Twice", Email: uniqueEmail("passkey_twice"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	session := loginCookie(t, user.Email, user.Password)
+	a := newAuthenticator(t)
+
+	rr, session := registerPasskey(t, session, user.Password, a, "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+	if rr, _ := registerPasskey(t, session, user.Password, a, ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, rr.Code)
+	}
+}
+
+func TestPasskeys_RejectsForeignOriginAndRPID(t *testing.T) {
+	user := &models.User{FirstName: "Pass", LastName: "Phish", Email: uniqueEmail("passkey_phish"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	session := loginCookie(t, user.Email, user.Password)
+	a := newAuthenticator(t)
+	if rr, _ := registerPasskey(t, session, user.Password, a, ""); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	a.Origin = "https://evil.example"
+	if rr := finishPasskeyLogin(signPasskeyLogin(t, a)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a foreign origin to be rejected, got %d", rr.Code)
+	}
+
+	a.Origin = app.Config.WebAuthnOrigin
+	a.RPID = "evil.example"
+	if rr := finishPasskeyLogin(signPasskeyLogin(t, a)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a foreign RP ID to be rejected, got %d", rr.Code)
+	}
+}
+
+func TestPasskeys_RejectsStaleSignCount(t *testing.T) {
+	user := &models.User{FirstName: "Pass", LastName: "Clone", Email: uniqueEmail("passkey_clone"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	session := loginCookie(t, user.Email, user.Password)
+	a := newAuthenticator(t)
+	if rr, _ := registerPasskey(t, session, user.Password, a, ""); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	a.SetSignCount(10)
+	if rr := finishPasskeyLogin(signPasskeyLogin(t, a)); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	// A cloned authenticator still counting from an older value.
+	a.SetSignCount(5)
+	if rr := finishPasskeyLogin(signPasskeyLogin(t, a)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a regressed counter to be rejected, got %d", rr.Code)
+	}
+}
+
+func TestPasskeys_UnknownCredential(t *testing.T) {
+	a := newAuthenticator(t)
+	if rr := finishPasskeyLogin(signPasskeyLogin(t, a)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestPasskeys_WithoutUserVerificationRequiresSecondFactor(t *testing.T) {
+	user := &models.User{FirstName: "Pass", LastName: "Presence", Email: uniqueEmail("passkey_up"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	session := loginCookie(t, user.Email, user.Password)
+	_, _, session = enableTwoFactor(t, session)
+
+	a := newAuthenticator(t)
+	if rr, _ := registerPasskey(t, session, user.Password, a, ""); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	a.UserVerified = false
+	rr := finishPasskeyLogin(signPasskeyLogin(t, a))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"mfa_required":true`) {
+		t.Fatalf("expected a second factor to be required, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if responseCookie(rr, "session_token") != nil || responseCookie(rr, "mfa_challenge") == nil {
+		t.Fatal("expected a pending MFA challenge instead of a session")
+	}
+
+	a.UserVerified = true
+	rr = finishPasskeyLogin(signPasskeyLogin(t, a))
+	if rr.Code != http.StatusOK || responseCookie(rr, "session_token") == nil {
+		t.Fatalf("expected a user-verified passkey to log in directly, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestPasskeys_Delete(t *testing.T) {
+	owner := &models.User{FirstName: "Pass", LastName: "Owner", Email: uniqueEmail("passkey_owner"), Password: "Password123!"}
+	other := &models.User{FirstName: "Pass", LastName: "Other", Email: uniqueEmail("passkey_other"), Password: "Password123!"}
+	store.SeedUser(t, owner)
+	store.SeedUser(t, other)
+	ownerSession := loginCookie(t, owner.Email, owner.Password)
+	otherSession := loginCookie(t, other.Email, other.Password)
+
+	a := newAuthenticator(t)
+	rr, ownerSession := registerPasskey(t, ownerSession, owner.Password, a, "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+	id := listPasskeys(t, ownerSession)[0].ID
+
+	if rr := deletePasskey(otherSession, other.Password, id); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected another user's passkey to be hidden, got %d", rr.Code)
+	}
+	if rr := deletePasskey(ownerSession, "WrongPass123!", id); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong password to be rejected, got %d", rr.Code)
+	}
+	rr = deletePasskey(ownerSession, owner.Password, id)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	renewed := responseCookie(rr, "session_token")
+	if renewed == nil || renewed.Value == ownerSession {
+		t.Fatal("expected the session to be renewed")
+	}
+	if len(listPasskeys(t, renewed.Value)) != 0 {
+		t.Fatal("expected the passkey to be gone")
+	}
+	if rr := finishPasskeyLogin(signPasskeyLogin(t, a)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a removed passkey to stop working, got %d", rr.Code)
+	}
+}
+
+func TestPasskeys_RegisterNeedsPasswordAndRenewsSession(t *testing.T) {
+	user := &models.User{FirstName: "Pass", LastName: "Stolen", Email: uniqueEmail("passkey_reauth"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	session := loginCookie(t, user.Email, user.Password)
+	elsewhere := loginCookie(t, user.Email, user.Password)
+
+	// A stolen cookie alone cannot add a way into the account.
+	if rr := serveAuthed(app.HandlePasskeyRegisterBegin, session, `{"password":"WrongPass123!"}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong password to be rejected, got %d", rr.Code)
+	}
+
+	rr, renewed := registerPasskey(t, session, user.Password, newAuthenticator(t), "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+	if renewed == session {
+		t.Fatal("expected the session to be renewed")
+	}
+	for _, old := range []string{session, elsewhere} {
+		if _, err := store.GetSessionByToken(old); err == nil {
+			t.Fatal("expected the other session tokens to stop working")
+		}
+	}
+}
+
+func TestPasskeys_RemovedByPasswordReset(t *testing.T) {
+	user := &models.User{FirstName: "Pass", LastName: "Reset", Email: uniqueEmail("passkey_reset"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	a := newAuthenticator(t)
+	if rr, _ := registerPasskey(t, loginCookie(t, user.Email, user.Password), user.Password, a, ""); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	requestPasswordReset(t, user.Email)
+	if rr := resetPassword(resetTokenFor(t, user.Email), "NewPass123!"); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := finishPasskeyLogin(signPasskeyLogin(t, a)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the passkey to stop working after a reset, got %d", rr.Code)
+	}
+}
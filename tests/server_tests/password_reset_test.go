@@ -0,0 +1,108 @@
+package server_tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"web-app/internal/models"
+)
+
+func requestPasswordReset(t *testing.T, email string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"email":"%s"}`, email)
+	req := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleForgotPassword).ServeHTTP(rr, req)
+	return rr
+}
+
+func resetTokenFor(t *testing.T, email string) string {
+	t.Helper()
+	return mailedToken(t, email, "/reset-password")
+}
+
+func resetPassword(token, password string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"token":"%s","new_password":"%s"}`, token, password)
+	req := httptest.NewRequest(http.MethodPost, "/password/reset", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleResetPassword).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPasswordReset_Flow(t *testing.T) {
+	user := &models.User{FirstName: "Forgot", LastName: "Ful", Email: uniqueEmail("reset_flow"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	session := loginCookie(t, user.Email, user.Password)
+
+	if rr := requestPasswordReset(t, user.Email); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	token := resetTokenFor(t, user.Email)
+
+	if rr := resetPassword(token, "NewPass123!"); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	if _, err := store.Authenticate(user.Email, "NewPass123!"); err != nil {
+		t.Fatalf("expected new password to work: %v", err)
+	}
+	if _, err := store.GetSessionByToken(session); err == nil {
+		t.Fatal("expected existing sessions to be revoked after reset")
+	}
+
+	if rr := resetPassword(token, "Another123!"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected reused token to be rejected with %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestPasswordReset_OnlyNewestLinkWorks(t *testing.T) {
+	user := &models.User{FirstName: "Twice", LastName: "Asked", Email: uniqueEmail("reset_newest"), Password: "Password123!"}
+	store.SeedUser(t, user)
+
+	requestPasswordReset(t, user.Email)
+	first := resetTokenFor(t, user.Email)
+	requestPasswordReset(t, user.Email)
+	second := resetTokenFor(t, user.Email)
+
+	if rr := resetPassword(first, "NewPass123!"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected superseded token to be rejected, got %d", rr.Code)
+	}
+	if rr := resetPassword(second, "NewPass123!"); rr.Code != http.StatusOK {
+		t.Fatalf("expected newest token to work, got %d", rr.Code)
+	}
+}
+
+func TestPasswordReset_UnknownEmailLooksTheSame(t *testing.T) {
+	user := &models.User{FirstName: "Known", LastName: "User", Email: uniqueEmail("reset_known"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	unknown := uniqueEmail("reset_unknown")
+
+	known := requestPasswordReset(t, user.Email)
+	missing := requestPasswordReset(t, unknown)
+
+	if known.Code != missing.Code || known.Body.String() != missing.Body.String() {
+		t.Fatalf("expected identical responses, got %d %q and %d %q", known.Code, known.Body, missing.Code, missing.Body)
+	}
+	if _, sent := mailer.lastTo(unknown); sent {
+		t.Fatal("expected no email for an unknown address")
+	}
+}
+
+func TestPasswordReset_InvalidInput(t *testing.T) {
+	if rr := resetPassword("does-not-exist", "NewPass123!"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for unknown token, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr := resetPassword("whatever", "short"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for weak password, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/password/forgot", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleForgotPassword).ServeHTTP(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
@@ -0,0 +1,164 @@
+package server_tests
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"web-app/internal/models"
+	"web-app/internal/ratelimit"
+	"web-app/pkg/server"
+)
+
+// withLimiter gives one test its own buckets.
+func withLimiter(t *testing.T, limiter ratelimit.Limiter) {
+	t.Helper()
+
+	saved := app.Limiter
+	app.Limiter = limiter
+	t.Cleanup(func() { app.Limiter = saved })
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(string, ratelimit.Rule) (time.Duration, error) {
+	return 0, errors.New("limiter unavailable")
+}
+
+// limitedRequest sends a POST with body from remoteAddr through handler and
+// returns the response.
+func limitedRequest(handler http.Handler, remoteAddr, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/limited", strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestRateLimit_ByIP(t *testing.T) {
+	withLimiter(t, ratelimit.NewMemory())
+	handler := app.RateLimit(server.RateLimit{Name: "test", Key: server.LimitByIP, Rule: ratelimit.Rule{Limit: 2, Period: time.Minute}})(okHandler())
+
+	for i := 0; i < 2; i++ {
+		if rr := limitedRequest(handler, "203.0.113.1:1000", ""); rr.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status %d, got %d", i+1, http.StatusOK, rr.Code)
+		}
+	}
+	rr := limitedRequest(handler, "203.0.113.1:2000", "")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if retryAfter := rr.Header().Get("Retry-After"); retryAfter != "30" {
+		t.Fatalf("expected Retry-After 30, got %q", retryAfter)
+	}
+
+	if rr := limitedRequest(handler, "203.0.113.2:1000", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected other clients to be allowed, got %d", rr.Code)
+	}
+}
+
+func TestRateLimit_ByAccountKeepsBody(t *testing.T) {
+	withLimiter(t, ratelimit.NewMemory())
+	var seen []string
+	handler := app.RateLimit(server.RateLimit{Name: "test", Key: server.LimitByAccount, Rule: ratelimit.Rule{Limit: 1, Period: time.Minute}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			seen = append(seen, string(body))
+		}))
+
+	body := `{"email":"limited@test.com","password":"Password123!"}`
+	if rr := limitedRequest(handler, "203.0.113.3:1000", body); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if len(seen) != 1 || seen[0] != body {
+		t.Fatalf("expected the handler to read the whole body, got %q", seen)
+	}
+
+	// The account is limited from any client and in any letter case.
+	if rr := limitedRequest(handler, "203.0.113.4:1000", `{"email":" LIMITED@test.com"}`); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if rr := limitedRequest(handler, "203.0.113.3:1000", `{"email":"other@test.com"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected other accounts to be allowed, got %d", rr.Code)
+	}
+	// Requests without an email are not counted.
+	for i := 0; i < 2; i++ {
+		if rr := limitedRequest(handler, "203.0.113.3:1000", `not json`); rr.Code != http.StatusOK {
+			t.Fatalf("expected a request without an email to pass, got %d", rr.Code)
+		}
+	}
+}
+
+func TestRateLimit_BySession(t *testing.T) {
+	withLimiter(t, ratelimit.NewMemory())
+	limit := app.RateLimit(server.RateLimit{Name: "test", Key: server.LimitBySession, Rule: ratelimit.Rule{Limit: 1, Period: time.Minute}})
+	handler := app.SessionLoader(limit(okHandler()))
+
+	user := &models.User{FirstName: "Rate", LastName: "Session", Email: uniqueEmail("ratelimit_session"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	first := loginCookie(t, user.Email, user.Password)
+	second := loginCookie(t, user.Email, user.Password)
+
+	withSession := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/limited", nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := withSession(first); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr := withSession(first); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if rr := withSession(second); rr.Code != http.StatusOK {
+		t.Fatalf("expected other sessions to be allowed, got %d", rr.Code)
+	}
+}
+
+func TestRateLimit_SharedStoreAndSeparateNames(t *testing.T) {
+	withLimiter(t, ratelimit.StoreLimiter{Store: store})
+	rule := ratelimit.Rule{Limit: 1, Period: time.Minute}
+	login := app.RateLimit(server.RateLimit{Name: "test-login", Key: server.LimitByIP, Rule: rule})(okHandler())
+	captcha := app.RateLimit(server.RateLimit{Name: "test-captcha", Key: server.LimitByIP, Rule: rule})(okHandler())
+	// Another instance with the same database sees the same buckets.
+	other := server.NewApp(store)
+	other.Limiter = ratelimit.StoreLimiter{Store: store}
+	otherLogin := other.RateLimit(server.RateLimit{Name: "test-login", Key: server.LimitByIP, Rule: rule})(okHandler())
+
+	if rr := limitedRequest(login, "203.0.113.5:1000", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr := limitedRequest(otherLogin, "203.0.113.5:1000", ""); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the other instance to share the limit, got %d", rr.Code)
+	}
+	if rr := limitedRequest(captcha, "203.0.113.5:1000", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected routes with other names to count separately, got %d", rr.Code)
+	}
+}
+
+func TestRateLimit_OffAndFailingLimiter(t *testing.T) {
+	withLimiter(t, failingLimiter{})
+	failing := app.RateLimit(server.RateLimit{Name: "test", Key: server.LimitByIP, Rule: ratelimit.Rule{Limit: 1, Period: time.Minute}})(okHandler())
+	off := app.RateLimit(server.RateLimit{Name: "test", Key: server.LimitByIP})(okHandler())
+
+	for i := 0; i < 3; i++ {
+		if rr := limitedRequest(failing, "203.0.113.6:1000", ""); rr.Code != http.StatusOK {
+			t.Fatalf("expected a failing limiter to let requests through, got %d", rr.Code)
+		}
+		if rr := limitedRequest(off, "203.0.113.6:1000", ""); rr.Code != http.StatusOK {
+			t.Fatalf("expected a zero rule to be off, got %d", rr.Code)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package server_tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"web-app/internal/models"
+	"web-app/pkg/server"
+)
+
+func loginResponse(t *testing.T, body string) *http.Cookie {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleLogin).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected login status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "session_token" {
+			return cookie
+		}
+	}
+	t.Fatal("expected session_token cookie from login")
+	return nil
+}
+
+func TestHandleLogin_BrowserSessionCookie(t *testing.T) {
+	user := &models.User{FirstName: "Shared", LastName: "Computer", Email: uniqueEmail("login_browser_session"), Password: "Password123!"}
+	store.SeedUser(t, user)
+
+	cookie := loginResponse(t, fmt.Sprintf(`{"email":"%s", "password":"Password123!"}`, user.Email))
+
+	if !cookie.Expires.IsZero() || cookie.MaxAge != 0 {
+		t.Fatalf("expected a browser-session cookie without Expires, got Expires=%v MaxAge=%d", cookie.Expires, cookie.MaxAge)
+	}
+	session, err := store.GetSessionByToken(cookie.Value)
+	if err != nil || session.Persistent {
+		t.Fatalf("expected non-persistent session, got %+v, %v", session, err)
+	}
+}
+
+func TestHandleLogin_RememberMe(t *testing.T) {
+	user := &models.User{FirstName: "Remember", LastName: "Me", Email: uniqueEmail("login_remember_me"), Password: "Password123!"}
+	store.SeedUser(t, user)
+
+	cookie := loginResponse(t, fmt.Sprintf(`{"email":"%s", "password":"Password123!", "remember_me": true}`, user.Email))
+
+	if cookie.Expires.Before(time.Now().Add(app.Config.SessionAbsoluteTimeout)) {
+		t.Fatalf("expected a long-lived cookie, got Expires=%v", cookie.Expires)
+	}
+	session, err := store.GetSessionByToken(cookie.Value)
+	if err != nil || !session.Persistent {
+		t.Fatalf("expected persistent session, got %+v, %v", session, err)
+	}
+	if session.AbsoluteExpiresAt.Before(time.Now().Add(app.Config.RememberMeAbsoluteTimeout - time.Minute)) {
+		t.Fatalf("expected remember-me absolute lifetime, got %v", session.AbsoluteExpiresAt)
+	}
+}
+
+func TestSessionLoader_RotatesRememberedToken(t *testing.T) {
+	user := &models.User{FirstName: "Rotate", LastName: "Token", Email: uniqueEmail("remember_rotate"), Password: "Password123!"}
+	userID := store.SeedUser(t, user)
+
+	now := time.Now()
+	token := seedSession(t, &models.Session{
+		UserID:            int(userID),
+		Persistent:        true,
+		LastSeenAt:        now,
+		TokenIssuedAt:     now.Add(-48 * time.Hour),
+		ExpiresAt:         now.Add(time.Hour),
+		AbsoluteExpiresAt: now.Add(24 * time.Hour),
+	})
+
+	a := server.NewApp(store)
+	a.Config.RememberMeRotationInterval = 24 * time.Hour
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+	rr := httptest.NewRecorder()
+	a.SessionLoader(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+
+	var rotated *http.Cookie
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "session_token" {
+			rotated = cookie
+		}
+	}
+	if rotated == nil || rotated.Value == token {
+		t.Fatal("expected a rotated session_token cookie")
+	}
+	if rotated.Expires.IsZero() {
+		t.Fatal("expected rotated remember-me cookie to stay persistent")
+	}
+	if _, err := store.GetSessionByToken(rotated.Value); err != nil {
+		t.Fatalf("expected rotated token to be valid: %v", err)
+	}
+	if _, err := store.GetSessionByToken(token); err != nil {
+		t.Fatalf("expected old token to work during the grace period: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package server_tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"web-app/internal/models"
+	"web-app/pkg/server"
+)
+
+func seedSession(t *testing.T, session *models.Session) string {
+	t.Helper()
+
+	session.Token = fmt.Sprintf("timeout_session_%d", time.Now().UnixNano())
+	if err := store.CreateSession(session); err != nil {
+		t.Fatalf("failed to seed session: %v", err)
+	}
+	return session.Token
+}
+
+func serveWithSession(a *server.App, token string) (userID int, ok bool) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok = r.Context().Value("userID").(int)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+	a.SessionLoader(next).ServeHTTP(httptest.NewRecorder(), req)
+	return userID, ok
+}
+
+func TestSessionLoader_SlidesIdleTimeout(t *testing.T) {
+	user := &models.User{FirstName: "Idle", LastName: "Slide", Email: uniqueEmail("idle_slide"), Password: "Password123!"}
+	userID := store.SeedUser(t, user)
+
+	now := time.Now()
+	token := seedSession(t, &models.Session{
+		UserID:            int(userID),
+		LastSeenAt:        now.Add(-10 * time.Minute),
+		ExpiresAt:         now.Add(time.Minute),
+		AbsoluteExpiresAt: now.Add(90 * time.Minute),
+	})
+
+	a := server.NewApp(store)
+	a.Config.SessionIdleTimeout = time.Hour
+	a.Config.SessionRenewInterval = 5 * time.Minute
+
+	if _, ok := serveWithSession(a, token); !ok {
+		t.Fatal("expected active session to authenticate")
+	}
+
+	session, err := store.GetSessionByToken(token)
+	if err != nil {
+		t.Fatalf("expected session to stay valid: %v", err)
+	}
+	if session.ExpiresAt.Before(now.Add(59 * time.Minute)) {
+		t.Fatalf("expected idle expiry to slide to ~1h, got %v", session.ExpiresAt.Sub(now))
+	}
+	if session.ExpiresAt.After(session.AbsoluteExpiresAt) {
+		t.Fatal("idle expiry must not pass the absolute expiry")
+	}
+}
+
+func TestSessionLoader_ThrottlesRenewal(t *testing.T) {
+	user := &models.User{FirstName: "Idle", LastName: "Throttle", Email: uniqueEmail("idle_throttle"), Password: "Password123!"}
+	userID := store.SeedUser(t, user)
+
+	now := time.Now()
+	expiresAt := now.Add(10 * time.Minute)
+	token := seedSession(t, &models.Session{
+		UserID:            int(userID),
+		LastSeenAt:        now.Add(-time.Minute),
+		ExpiresAt:         expiresAt,
+		AbsoluteExpiresAt: now.Add(time.Hour),
+	})
+
+	a := server.NewApp(store)
+	a.Config.SessionRenewInterval = 5 * time.Minute
+
+	serveWithSession(a, token)
+
+	session, _ := store.GetSessionByToken(token)
+	if !session.ExpiresAt.Equal(expiresAt) {
+		t.Fatal("expected no renewal write within the renew interval")
+	}
+}
+
+func TestSessionLoader_AbsoluteTimeoutForcesLogin(t *testing.T) {
+	user := &models.User{FirstName: "Absolute", LastName: "Timeout", Email: uniqueEmail("absolute_timeout"), Password: "Password123!"}
+	userID := store.SeedUser(t, user)
+
+	now := time.Now()
+	token := seedSession(t, &models.Session{
+		UserID:            int(userID),
+		LastSeenAt:        now,
+		ExpiresAt:         now.Add(time.Hour),
+		AbsoluteExpiresAt: now.Add(-time.Second),
+	})
+
+	if _, ok := serveWithSession(app, token); ok {
+		t.Fatal("expected session past its absolute lifetime to be rejected")
+	}
+}
@@ -0,0 +1,99 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"web-app/internal/models"
+)
+
+func listSessions(t *testing.T, token string) []map[string]any {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+	rr := httptest.NewRecorder()
+
+	app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleListSessions))).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var sessions []map[string]any
+	if err := json.NewDecoder(rr.Body).Decode(&sessions); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return sessions
+}
+
+func TestHandleListSessions(t *testing.T) {
+	user := &models.User{FirstName: "Device", LastName: "List", Email: uniqueEmail("sessions_list"), Password: "Password123!"}
+	store.SeedUser(t, user)
+
+	first := loginCookie(t, user.Email, user.Password)
+	second := loginCookie(t, user.Email, user.Password)
+	if first == second {
+		t.Fatal("expected each login to get its own token")
+	}
+
+	sessions := listSessions(t, second)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	current := 0
+	for _, s := range sessions {
+		if _, ok := s["token"]; ok {
+			t.Fatal("session list must not expose tokens")
+		}
+		if s["current"] == true {
+			current++
+		}
+	}
+	if current != 1 {
+		t.Fatalf("expected exactly one current session, got %d", current)
+	}
+}
+
+func TestHandleDeleteSession(t *testing.T) {
+	user := &models.User{FirstName: "Device", LastName: "Revoke", Email: uniqueEmail("sessions_revoke"), Password: "Password123!"}
+	store.SeedUser(t, user)
+
+	other := loginCookie(t, user.Email, user.Password)
+	current := loginCookie(t, user.Email, user.Password)
+
+	otherSession, err := store.GetSessionByToken(other)
+	if err != nil {
+		t.Fatalf("expected other session: %v", err)
+	}
+
+	handler := app.SessionLoader(app.RequireAuth(http.HandlerFunc(app.HandleDeleteSession)))
+	mux := http.NewServeMux()
+	mux.Handle("DELETE /api/sessions/{id}", handler)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/sessions/"+otherSession.ID, nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: current})
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if _, err := store.GetSessionByToken(other); err == nil {
+		t.Fatal("expected revoked session to be gone")
+	}
+	if _, err := store.GetSessionByToken(current); err != nil {
+		t.Fatalf("expected current session to stay valid: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/sessions/"+otherSession.ID, nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: current})
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
@@ -1,52 +1,79 @@
 package server_tests
 
 import (
-	"log"
+	"net/url"
 	"os"
-	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"web-app/internal/database"
+	"web-app/internal/mail"
 	"web-app/pkg/server"
+)
 
-	"database/sql"
-
-	"github.com/joho/godotenv"
+var (
+	app    *server.App
+	store  *database.MemoryStore
+	mailer *testMailer
 )
 
-var app *server.App
+// testMailer records sent messages instead of delivering them.
+type testMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
 
-func TestMain(m *testing.M) {
-	err := godotenv.Load("../../.env")
-	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
-	}
+func (m *testMailer) Send(msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
 
-	serverDSN := os.Getenv("MYSQLSERVER")
-	if serverDSN == "" {
-		absPath, err := filepath.Abs("../../.env")
-		if err != nil {
-			log.Fatalf("MYSQLSERVER not set and failed to resolve absolute path for .env file: %v", err)
+// lastTo returns the newest message sent to the given address, once the
+// emails the app sends in the background are out.
+func (m *testMailer) lastTo(to string) (mail.Message, bool) {
+	app.WaitForMail()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			return m.messages[i], true
 		}
-		log.Fatalf("MYSQLSERVER not set in .env file %s", absPath)
 	}
+	return mail.Message{}, false
+}
 
-	tmpDB, err := sql.Open("mysql", serverDSN)
-	if err != nil {
-		log.Fatalf("Could not connect to MySQL for setup: %v", err)
-	}
+// mailedToken extracts the token from the newest link to path mailed to the
+// given address.
+func mailedToken(t *testing.T, to, path string) string {
+	t.Helper()
 
-	_, err = tmpDB.Exec("CREATE DATABASE IF NOT EXISTS simple_web_app_test")
+	msg, ok := mailer.lastTo(to)
+	if !ok {
+		t.Fatalf("expected an email to %s", to)
+	}
+	start := strings.Index(msg.Body, path+"?token=")
+	if start < 0 {
+		t.Fatalf("expected a %s link in %q", path, msg.Body)
+	}
+	link := strings.Fields(msg.Body[start:])[0]
+	u, err := url.Parse(link)
 	if err != nil {
-		log.Fatalf("Could not create test database: %v", err)
+		t.Fatalf("invalid link %q: %v", link, err)
 	}
-	tmpDB.Close()
+	return u.Query().Get("token")
+}
 
-	db := database.NewTestDB(&testing.T{})
-	app = server.NewApp(db)
+func TestMain(m *testing.M) {
+	store = database.NewMemoryStore()
+	app = server.NewApp(store)
+	mailer = &testMailer{}
+	app.Mailer = mailer
 
 	exitCode := m.Run()
 
-	db.Close()
+	store.Close()
 	os.Exit(exitCode)
 }
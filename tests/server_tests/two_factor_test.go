@@ -0,0 +1,231 @@
+package server_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"web-app/internal/models"
+	"web-app/internal/totp"
+	"web-app/pkg/server"
+)
+
+func serveAuthed(h http.HandlerFunc, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/2fa", strings.NewReader(body))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+	rr := httptest.NewRecorder()
+	app.SessionLoader(app.RequireAuth(h)).ServeHTTP(rr, req)
+	return rr
+}
+
+func responseCookie(rr *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == name && c.MaxAge >= 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+// enableTwoFactor enrolls the user behind session and returns the secret,
+// the recovery codes and the rotated session token.
+func enableTwoFactor(t *testing.T, session string) (string, []string, string) {
+	t.Helper()
+
+	rr := serveAuthed(app.HandleTwoFactorSetup, session, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected setup status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var setup struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+	json.NewDecoder(rr.Body).Decode(&setup)
+	if setup.Secret == "" || !strings.HasPrefix(setup.OTPAuthURI, "otpauth://totp/") {
+		t.Fatalf("unexpected setup response %+v", setup)
+	}
+
+	code, _ := totp.Code(setup.Secret, totp.Counter(time.Now()))
+	rr = serveAuthed(app.HandleTwoFactorConfirm, session, fmt.Sprintf(`{"code":"%s"}`, code))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected confirm status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var confirm struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.NewDecoder(rr.Body).Decode(&confirm)
+	if len(confirm.RecoveryCodes) != 10 {
+		t.Fatalf("expected 10 recovery codes, got %d", len(confirm.RecoveryCodes))
+	}
+
+	rotated := responseCookie(rr, "session_token")
+	if rotated == nil || rotated.Value == session {
+		t.Fatal("expected enabling two-factor authentication to rotate the session token")
+	}
+	return setup.Secret, confirm.RecoveryCodes, rotated.Value
+}
+
+// startPasswordStep logs in with the password and returns the pending MFA
+// cookie.
+func startPasswordStep(t *testing.T, email, password string) *http.Cookie {
+	t.Helper()
+
+	rr := loginAs(app, email, password)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"mfa_required":true`) {
+		t.Fatalf("expected the login to ask for a second factor, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if responseCookie(rr, "session_token") != nil {
+		t.Fatal("expected no session before the second factor")
+	}
+	challenge := responseCookie(rr, "mfa_challenge")
+	if challenge == nil {
+		t.Fatal("expected an mfa_challenge cookie")
+	}
+	return challenge
+}
+
+func finishMFA(challenge *http.Cookie, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/login/mfa", strings.NewReader(body))
+	req.AddCookie(challenge)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.HandleLoginMFA).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTwoFactor_EnrollAndLogin(t *testing.T) {
+	user := &models.User{FirstName: "Two", LastName: "Factor", Email: uniqueEmail("2fa_login"), Password: "Password123!"}
+	userID := store.SeedUser(t, user)
+	secret, recoveryCodes, _ := enableTwoFactor(t, loginCookie(t, user.Email, user.Password))
+	enrollment, _ := store.GetTOTP(int(userID))
+
+	challenge := startPasswordStep(t, user.Email, user.Password)
+
+	// The code used for confirmation belongs to an already used time step.
+	used, _ := totp.Code(secret, enrollment.LastCounter)
+	if rr := finishMFA(challenge, fmt.Sprintf(`{"code":"%s"}`, used)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a replayed code to be rejected, got %d", rr.Code)
+	}
+
+	next, _ := totp.Code(secret, enrollment.LastCounter+1)
+	rr := finishMFA(challenge, fmt.Sprintf(`{"code":"%s"}`, next))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	session := responseCookie(rr, "session_token")
+	if session == nil {
+		t.Fatal("expected a session after the second factor")
+	}
+	if _, err := store.GetSessionByToken(session.Value); err != nil {
+		t.Fatalf("expected a valid session: %v", err)
+	}
+	if rr := finishMFA(challenge, fmt.Sprintf(`{"code":"%s"}`, next)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a finished challenge to be unusable, got %d", rr.Code)
+	}
+
+	challenge = startPasswordStep(t, user.Email, user.Password)
+	if rr := finishMFA(challenge, fmt.Sprintf(`{"recovery_code":"%s"}`, recoveryCodes[0])); rr.Code != http.StatusOK {
+		t.Fatalf("expected a recovery code to work, got %d", rr.Code)
+	}
+	challenge = startPasswordStep(t, user.Email, user.Password)
+	if rr := finishMFA(challenge, fmt.Sprintf(`{"recovery_code":"%s"}`, recoveryCodes[0])); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a used recovery code to be rejected, got %d", rr.Code)
+	}
+}
+
+// forgetIPFailures drops the failed logins counted against the default
+// test client, so wrong codes in one test do not throttle the others.
+func forgetIPFailures(t *testing.T) {
+	t.Cleanup(func() { store.ClearLoginThrottle(models.ThrottleIP, "192.0.2.1") })
+}
+
+func TestTwoFactor_TooManyAttempts(t *testing.T) {
+	// Only the per-challenge limit here; the account throttle has its own
+	// test below.
+	withLoginLimits(t, 0, 0, 0)
+	forgetIPFailures(t)
+	user := &models.User{FirstName: "Brute", LastName: "Force", Email: uniqueEmail("2fa_attempts"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	secret, _, _ := enableTwoFactor(t, loginCookie(t, user.Email, user.Password))
+
+	challenge := startPasswordStep(t, user.Email, user.Password)
+	for i := 0; i < app.Config.MFAMaxAttempts; i++ {
+		if rr := finishMFA(challenge, `{"code":"000000"}`); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("expected wrong code to be rejected, got %d", rr.Code)
+		}
+	}
+
+	next, _ := totp.Code(secret, totp.Counter(time.Now())+1)
+	if rr := finishMFA(challenge, fmt.Sprintf(`{"code":"%s"}`, next)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the challenge to be gone after too many attempts, got %d", rr.Code)
+	}
+}
+
+func TestTwoFactor_WrongCodesLockAccount(t *testing.T) {
+	withLoginLimits(t, 3, 0, 0)
+	forgetIPFailures(t)
+	user := &models.User{FirstName: "Code", LastName: "Guesser", Email: uniqueEmail("2fa_lock"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	secret, _, _ := enableTwoFactor(t, loginCookie(t, user.Email, user.Password))
+
+	// A fresh login with the right password does not forget the misses.
+	for _, misses := range []int{2, 1} {
+		challenge := startPasswordStep(t, user.Email, user.Password)
+		for i := 0; i < misses; i++ {
+			if rr := finishMFA(challenge, `{"code":"000000"}`); rr.Code != http.StatusUnauthorized {
+				t.Fatalf("expected wrong code to be rejected, got %d", rr.Code)
+			}
+		}
+	}
+
+	expectTooManyAttempts(t, loginAs(app, user.Email, user.Password))
+	if _, ok := mailer.lastTo(user.Email); !ok {
+		t.Fatal("expected the owner to be told about the lock")
+	}
+
+	// A challenge started before the lock cannot be finished either.
+	store.ClearLoginThrottle(models.ThrottleAccount, server.LoginSubject(user.Email))
+	challenge := startPasswordStep(t, user.Email, user.Password)
+	for i := 0; i < 3; i++ {
+		finishMFA(challenge, `{"code":"000000"}`)
+	}
+	next, _ := totp.Code(secret, totp.Counter(time.Now())+1)
+	expectTooManyAttempts(t, finishMFA(challenge, fmt.Sprintf(`{"code":"%s"}`, next)))
+}
+
+func TestTwoFactor_Disable(t *testing.T) {
+	user := &models.User{FirstName: "Turn", LastName: "Off", Email: uniqueEmail("2fa_disable"), Password: "Password123!"}
+	userID := store.SeedUser(t, user)
+	_, recoveryCodes, session := enableTwoFactor(t, loginCookie(t, user.Email, user.Password))
+
+	body := fmt.Sprintf(`{"password":"WrongPass123!","recovery_code":"%s"}`, recoveryCodes[1])
+	if rr := serveAuthed(app.HandleTwoFactorDisable, session, body); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong password to be rejected, got %d", rr.Code)
+	}
+	if rr := serveAuthed(app.HandleTwoFactorDisable, session, `{"password":"Password123!","code":"000000"}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong code to be rejected, got %d", rr.Code)
+	}
+
+	body = fmt.Sprintf(`{"password":"Password123!","recovery_code":"%s"}`, recoveryCodes[1])
+	if rr := serveAuthed(app.HandleTwoFactorDisable, session, body); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if _, err := store.GetTOTP(int(userID)); err == nil {
+		t.Fatal("expected the enrollment to be removed")
+	}
+	if rr := loginAs(app, user.Email, user.Password); responseCookie(rr, "session_token") == nil {
+		t.Fatal("expected a direct login once two-factor authentication is off")
+	}
+}
+
+func TestTwoFactor_SetupWhileEnabled(t *testing.T) {
+	user := &models.User{FirstName: "Already", LastName: "On", Email: uniqueEmail("2fa_conflict"), Password: "Password123!"}
+	store.SeedUser(t, user)
+	_, _, session := enableTwoFactor(t, loginCookie(t, user.Email, user.Password))
+
+	if rr := serveAuthed(app.HandleTwoFactorSetup, session, ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, rr.Code)
+	}
+}
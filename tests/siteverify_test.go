@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"web-app/internal/captcha"
+)
+
+// siteverifyStub answers like a vendor's siteverify endpoint: the token
+// "good" passes for hostname, anything else fails.
+func siteverifyStub(t *testing.T, secret, hostname string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.PostFormValue("secret") != secret:
+			json.NewEncoder(w).Encode(map[string]any{"success": false, "error-codes": []string{"invalid-input-secret"}})
+		case r.PostFormValue("response") == "good":
+			json.NewEncoder(w).Encode(map[string]any{"success": true, "hostname": hostname})
+		default:
+			json.NewEncoder(w).Encode(map[string]any{"success": false, "error-codes": []string{"invalid-input-response"}})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSiteverify(t *testing.T) {
+	srv := siteverifyStub(t, "s3cret", "example.com")
+	widget := captcha.Siteverify{Type: "turnstile", SiteKey: "site", Secret: "s3cret", URL: srv.URL}
+
+	challenge, _, err := widget.Generate("id")
+	if err != nil || challenge.Type != "turnstile" || challenge.SiteKey != "site" {
+		t.Fatalf("unexpected challenge %+v, %v", challenge, err)
+	}
+
+	if err := widget.Redeem(widget, "id", "good"); err != nil {
+		t.Fatalf("expected a good token to pass, got %v", err)
+	}
+	for _, token := range []string{"bad", ""} {
+		if err := widget.Redeem(widget, "id", token); !errors.Is(err, captcha.ErrInvalid) {
+			t.Fatalf("expected token %q to be rejected, got %v", token, err)
+		}
+	}
+	if !widget.Check("id", "", "good") || widget.Check("id", "", "bad") {
+		t.Fatal("expected Check to agree with Redeem")
+	}
+}
+
+func TestSiteverifyHostnames(t *testing.T) {
+	srv := siteverifyStub(t, "s3cret", "evil.example")
+	widget := captcha.Siteverify{Type: "hcaptcha", Secret: "s3cret", URL: srv.URL, Hostnames: []string{"example.com"}}
+
+	if err := widget.Redeem(widget, "id", "good"); !errors.Is(err, captcha.ErrInvalid) {
+		t.Fatalf("expected a token from another site to be rejected, got %v", err)
+	}
+	widget.Hostnames = append(widget.Hostnames, "evil.example")
+	if err := widget.Redeem(widget, "id", "good"); err != nil {
+		t.Fatalf("expected a listed hostname to pass, got %v", err)
+	}
+}
+
+func TestSiteverifyFailures(t *testing.T) {
+	srv := siteverifyStub(t, "s3cret", "example.com")
+	wrongSecret := captcha.Siteverify{Type: "recaptcha", Secret: "wrong", URL: srv.URL}
+	if err := wrongSecret.Redeem(wrongSecret, "id", "good"); err == nil || errors.Is(err, captcha.ErrInvalid) {
+		t.Fatalf("expected a wrong secret to be a configuration error, got %v", err)
+	}
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	widget := captcha.Siteverify{Type: "turnstile", Secret: "s3cret", URL: down.URL}
+	if err := widget.Redeem(widget, "id", "good"); err == nil || errors.Is(err, captcha.ErrInvalid) {
+		t.Fatalf("expected an unavailable endpoint to be an error, got %v", err)
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+	widget = captcha.Siteverify{Type: "turnstile", Secret: "s3cret", URL: slow.URL, Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	if err := widget.Redeem(widget, "id", "good"); err == nil || errors.Is(err, captcha.ErrInvalid) {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected the timeout to apply, took %v", elapsed)
+	}
+}
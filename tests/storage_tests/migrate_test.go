@@ -0,0 +1,103 @@
+package storage_tests
+
+import (
+	"strings"
+	"testing"
+	"web-app/internal/database"
+)
+
+func TestMigrations(t *testing.T) {
+	db, err := database.InitDB("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	defer db.Close()
+
+	migrations, err := db.Migrations()
+	if err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+
+	applied, err := db.MigrateUp()
+	if err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+	if applied != len(migrations) {
+		t.Fatalf("expected %d migrations applied, got %d", len(migrations), applied)
+	}
+
+	applied, err = db.MigrateUp()
+	if err != nil || applied != 0 {
+		t.Fatalf("expected second MigrateUp to be a no-op, got %d, %v", applied, err)
+	}
+
+	status, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus failed: %v", err)
+	}
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			t.Errorf("expected migration %04d_%s to be applied", s.Version, s.Name)
+		}
+	}
+
+	for range migrations {
+		rolledBack, err := db.MigrateDown()
+		if err != nil || !rolledBack {
+			t.Fatalf("MigrateDown failed: %v, %v", rolledBack, err)
+		}
+	}
+	rolledBack, err := db.MigrateDown()
+	if err != nil || rolledBack {
+		t.Fatalf("expected nothing left to roll back, got %v, %v", rolledBack, err)
+	}
+
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('users', 'sessions', 'captchas')").Scan(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Fatalf("expected all tables dropped, found %d", tables)
+	}
+
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp after full rollback failed: %v", err)
+	}
+}
+
+// MySQL scripts are split on every ";" before they run, so a semicolon in a
+// comment cuts a statement in two and a chunk of only comments is rejected
+// as an empty query.
+func TestMySQLMigrationsSplitIntoStatements(t *testing.T) {
+	migrations, err := (&database.DB{Dialect: database.MySQL}).Migrations()
+	if err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	for _, m := range migrations {
+		for direction, script := range map[string]string{"up": m.Up, "down": m.Down} {
+			for _, line := range strings.Split(script, "\n") {
+				if _, comment, ok := strings.Cut(line, "--"); ok && strings.Contains(comment, ";") {
+					t.Errorf("%04d_%s.%s.sql: semicolon in comment %q", m.Version, m.Name, direction, line)
+				}
+			}
+			for _, stmt := range strings.Split(script, ";") {
+				if strings.TrimSpace(stmt) != "" && !hasSQL(stmt) {
+					t.Errorf("%04d_%s.%s.sql: statement with only comments %q", m.Version, m.Name, direction, stmt)
+				}
+			}
+		}
+	}
+}
+
+func hasSQL(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return true
+		}
+	}
+	return false
+}
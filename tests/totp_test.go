@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"web-app/internal/totp"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890", in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit codes; 6-digit codes are their last six digits.
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, v := range vectors {
+		code, err := totp.Code(rfc6238Secret, totp.Counter(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d) failed: %v", v.unix, err)
+		}
+		if code != v.code {
+			t.Errorf("Code(%d) = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := totp.Counter(now)
+	code, _ := totp.Code(rfc6238Secret, current)
+
+	counter, ok := totp.Verify(rfc6238Secret, code, now, 0)
+	if !ok || counter != current {
+		t.Fatalf("expected current code to verify at step %d, got %d, %v", current, counter, ok)
+	}
+	if _, ok := totp.Verify(rfc6238Secret, code, now, current); ok {
+		t.Fatal("expected a code from an already used step to be rejected")
+	}
+	if _, ok := totp.Verify(rfc6238Secret, code, now.Add(totp.Period), 0); !ok {
+		t.Fatal("expected the previous step to be accepted for clock skew")
+	}
+	if _, ok := totp.Verify(rfc6238Secret, code, now.Add(3*totp.Period), 0); ok {
+		t.Fatal("expected a code three steps old to be rejected")
+	}
+	if _, ok := totp.Verify(rfc6238Secret, "12345", now, 0); ok {
+		t.Fatal("expected a short code to be rejected")
+	}
+}
+
+func TestTOTPSecretAndURI(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret failed: %v", err)
+	}
+	if len(secret) != 32 {
+		t.Fatalf("expected a 32-character base32 secret, got %q", secret)
+	}
+	if _, err := totp.Code(secret, 1); err != nil {
+		t.Fatalf("generated secret does not decode: %v", err)
+	}
+
+	uri := totp.URI("web-app", "user@example.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/web-app:user@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("unexpected otpauth URI %q", uri)
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"web-app/internal/webauthn"
+	"web-app/internal/webauthn/webauthntest"
+)
+
+var testRP = webauthn.RelyingParty{ID: "example.com", Name: "Example", Origin: "https://example.com"}
+
+func registerTestCredential(t *testing.T) (*webauthntest.Authenticator, *webauthn.Credential) {
+	t.Helper()
+
+	a, err := webauthntest.New(testRP.ID, testRP.Origin)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	challenge := []byte("registration-challenge")
+	clientData, attestation := a.Create(challenge)
+	credential, err := testRP.VerifyRegistration(challenge, clientData, attestation)
+	if err != nil {
+		t.Fatalf("VerifyRegistration failed: %v", err)
+	}
+	return a, credential
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	a, credential := registerTestCredential(t)
+	if string(credential.ID) != string(a.CredentialID()) || len(credential.PublicKey) == 0 || !credential.UserVerified {
+		t.Fatalf("unexpected credential %+v", credential)
+	}
+
+	clientData, attestation := a.Create([]byte("issued"))
+	if _, err := testRP.VerifyRegistration([]byte("other"), clientData, attestation); err == nil {
+		t.Fatal("expected a response to another challenge to be rejected")
+	}
+	// A login response must not be accepted as a registration.
+	clientData, _, _ = a.Get([]byte("issued"))
+	if _, err := testRP.VerifyRegistration([]byte("issued"), clientData, attestation); err == nil {
+		t.Fatal("expected the ceremony type to be checked")
+	}
+}
+
+func TestWebAuthnAssertion(t *testing.T) {
+	a, credential := registerTestCredential(t)
+	challenge := []byte("login-challenge")
+
+	clientData, authData, signature := a.Get(challenge)
+	assertion, err := testRP.VerifyAssertion(challenge, credential.PublicKey, credential.SignCount, clientData, authData, signature)
+	if err != nil {
+		t.Fatalf("VerifyAssertion failed: %v", err)
+	}
+	if assertion.SignCount != 1 || !assertion.UserVerified {
+		t.Fatalf("unexpected assertion %+v", assertion)
+	}
+
+	clientData, authData, signature = a.Get(challenge)
+	signature[len(signature)-1] ^= 0xff
+	if _, err := testRP.VerifyAssertion(challenge, credential.PublicKey, 1, clientData, authData, signature); err == nil {
+		t.Fatal("expected a tampered signature to be rejected")
+	}
+
+	clientData, authData, signature = a.Get(challenge)
+	authData[32] &^= 0x01 // clear "user present"
+	if _, err := testRP.VerifyAssertion(challenge, credential.PublicKey, 1, clientData, authData, signature); err == nil {
+		t.Fatal("expected an assertion without user presence to be rejected")
+	}
+
+	a.SetSignCount(0)
+	clientData, authData, signature = a.Get(challenge)
+	_, err = testRP.VerifyAssertion(challenge, credential.PublicKey, 5, clientData, authData, signature)
+	if !errors.Is(err, webauthn.ErrSignCountRegressed) {
+		t.Fatalf("expected ErrSignCountRegressed, got %v", err)
+	}
+}
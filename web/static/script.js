@@ -4,6 +4,14 @@ document.addEventListener("DOMContentLoaded", () => {
     }
     if (window.location.pathname === '/profile') {
         loadProfileData();
+        loadSessions();
+        loadTwoFactorStatus();
+        loadPasskeys();
+        loadIdentities();
+    }
+    if (loginForm) {
+        loadOIDCProviders();
+        showRedirectState();
     }
     fetch("/api/session", { headers: { "Accept": "application/json" } })
         .then(response => response.json())
@@ -50,6 +58,23 @@ function logout() {
     });
 }
 
+function logoutEverywhere() {
+    fetch("/logout/all", { method: "POST" }).then(() => {
+        window.location.href = '/';
+    });
+}
+
+// Pages that need a login, such as an application's authorization request,
+// send the browser here with ?next=/path to come back to. Only local paths
+// are followed, so the parameter cannot send users to another site.
+function afterLoginLocation() {
+    const next = new URLSearchParams(window.location.search).get('next');
+    if (next && next.startsWith('/') && !next.startsWith('//') && !next.startsWith('/\\')) {
+        return next;
+    }
+    return '/';
+}
+
 const loginForm = document.getElementById('login-form');
 if (loginForm) {
     loginForm.addEventListener('submit', async (e) => {
@@ -57,21 +82,50 @@ if (loginForm) {
 
         const email = document.getElementById('email').value;
         const password = document.getElementById('password').value;
+        const rememberMe = document.getElementById('remember-me').checked;
         const errorMsg = document.getElementById('error-message');
+        const captchaBox = document.getElementById('login-captcha');
+
+        const payload = { email, password, remember_me: rememberMe };
+        if (captchaBox.style.display !== 'none') {
+            await captchaReady;
+            payload.captcha_id = document.getElementById('captcha-id').value;
+            payload.captcha_answer = document.getElementById('captcha-answer').value;
+        }
 
         try {
             const response = await fetch('/login', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ email, password })
+                body: JSON.stringify(payload)
             });
 
             if (response.ok) {
-                window.location.href = '/';
+                const data = await response.json();
+                if (data.mfa_required) {
+                    loginForm.style.display = 'none';
+                    document.getElementById('mfa-form').style.display = 'block';
+                    errorMsg.style.display = 'none';
+                    return;
+                }
+                window.location.href = afterLoginLocation();
             } else {
-                const data = await response.text();
-                errorMsg.innerText = data || "Invalid credentials";
+                // After repeated failures the server answers in JSON and
+                // wants a captcha with the next attempt; every captcha is
+                // good for one try.
+                let message = await response.text();
+                let captchaRequired = false;
+                if ((response.headers.get('Content-Type') || '').startsWith('application/json')) {
+                    const data = JSON.parse(message);
+                    message = data.message;
+                    captchaRequired = data.captcha_required === true;
+                }
+                errorMsg.innerText = message || "Invalid credentials";
                 errorMsg.style.display = 'block';
+                if (captchaRequired) {
+                    captchaBox.style.display = 'block';
+                    loadCaptcha();
+                }
             }
         } catch (err) {
             errorMsg.innerText = "Connection failed. Is the server running?";
@@ -80,6 +134,235 @@ if (loginForm) {
     });
 }
 
+function loadOIDCProviders() {
+    fetch("/api/oidc/providers")
+        .then(res => res.json())
+        .then(providers => {
+            const container = document.getElementById('oidc-providers');
+            providers.forEach(provider => {
+                const button = document.createElement('button');
+                button.type = 'button';
+                button.innerText = `Sign in with ${provider.display_name}`;
+                button.onclick = () => {
+                    const rememberMe = document.getElementById('remember-me').checked ? '?remember_me=1' : '';
+                    window.location.href = `/login/oidc/${encodeURIComponent(provider.name)}${rememberMe}`;
+                };
+                container.appendChild(button);
+            });
+        })
+        .catch(err => console.error("Failed to load sign-in providers", err));
+}
+
+// External sign-in ends with a redirect back here, carrying either an error
+// or the request for a second factor.
+function showRedirectState() {
+    const params = new URLSearchParams(window.location.search);
+    const errorMsg = document.getElementById('error-message');
+    if (params.get('error')) {
+        errorMsg.innerText = params.get('error');
+        errorMsg.style.display = 'block';
+    }
+    if (params.get('mfa') === '1') {
+        loginForm.style.display = 'none';
+        document.getElementById('mfa-form').style.display = 'block';
+    }
+}
+
+// Codes from authenticator apps are six digits; anything else is treated as
+// a recovery code.
+function secondFactorPayload(value) {
+    const code = value.trim();
+    return /^\d{6}$/.test(code) ? { code } : { recovery_code: code };
+}
+
+const mfaForm = document.getElementById('mfa-form');
+if (mfaForm) {
+    mfaForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const errorMsg = document.getElementById('error-message');
+
+        try {
+            const response = await fetch('/login/mfa', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(secondFactorPayload(document.getElementById('mfa-code').value))
+            });
+            if (response.ok) {
+                window.location.href = afterLoginLocation();
+                return;
+            }
+            errorMsg.innerText = await response.text();
+            errorMsg.style.display = 'block';
+            if (response.status === 401 && errorMsg.innerText.includes('sign in again')) {
+                mfaForm.style.display = 'none';
+                loginForm.style.display = 'block';
+            }
+        } catch (err) {
+            errorMsg.innerText = "Connection failed. Is the server running?";
+            errorMsg.style.display = 'block';
+        }
+    });
+}
+
+// WebAuthn hands out ArrayBuffers; the server exchanges them as unpadded
+// base64url strings.
+function bufferToBase64url(buffer) {
+    const bytes = new Uint8Array(buffer);
+    let binary = '';
+    bytes.forEach(b => binary += String.fromCharCode(b));
+    return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+function base64urlToBuffer(value) {
+    const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+    const binary = atob(base64 + '='.repeat((4 - base64.length % 4) % 4));
+    return Uint8Array.from(binary, c => c.charCodeAt(0)).buffer;
+}
+
+async function loginWithPasskey() {
+    const errorMsg = document.getElementById('error-message');
+    try {
+        const begin = await fetch('/login/passkey/begin', { method: 'POST' });
+        if (!begin.ok) {
+            throw new Error(await begin.text());
+        }
+        const options = await begin.json();
+        options.challenge = base64urlToBuffer(options.challenge);
+
+        const credential = await navigator.credentials.get({ publicKey: options });
+        const response = await fetch('/login/passkey/finish', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                credential_id: bufferToBase64url(credential.rawId),
+                client_data_json: bufferToBase64url(credential.response.clientDataJSON),
+                authenticator_data: bufferToBase64url(credential.response.authenticatorData),
+                signature: bufferToBase64url(credential.response.signature),
+                remember_me: document.getElementById('remember-me').checked
+            })
+        });
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        const data = await response.json();
+        if (data.mfa_required) {
+            loginForm.style.display = 'none';
+            document.getElementById('mfa-form').style.display = 'block';
+            errorMsg.style.display = 'none';
+            return;
+        }
+        window.location.href = afterLoginLocation();
+    } catch (err) {
+        errorMsg.innerText = err.message || "Passkey login failed";
+        errorMsg.style.display = 'block';
+    }
+}
+
+async function requestMagicLink() {
+    const errorMsg = document.getElementById('error-message');
+    const sentMsg = document.getElementById('magic-link-sent');
+    errorMsg.style.display = 'none';
+    sentMsg.style.display = 'none';
+    try {
+        const response = await fetch('/login/magic', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ email: document.getElementById('email').value })
+        });
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        sentMsg.innerText = (await response.json()).message;
+        sentMsg.style.display = 'block';
+    } catch (err) {
+        errorMsg.innerText = err.message || "Failed to send sign-in link";
+        errorMsg.style.display = 'block';
+    }
+}
+
+const forgotPasswordForm = document.getElementById('forgot-password-form');
+if (forgotPasswordForm) {
+    forgotPasswordForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const email = document.getElementById('email').value;
+        const msg = document.getElementById('forgot-message');
+
+        try {
+            const res = await fetch('/password/forgot', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ email })
+            });
+            if (res.ok) {
+                const data = await res.json();
+                msg.innerText = data.message;
+                msg.style.color = "green";
+            } else {
+                msg.innerText = await res.text();
+                msg.style.color = "red";
+            }
+            msg.style.display = "block";
+        } catch (err) {
+            console.error(err);
+        }
+    });
+}
+
+const resetPasswordForm = document.getElementById('reset-password-form');
+if (resetPasswordForm) {
+    resetPasswordForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const token = new URLSearchParams(window.location.search).get('token');
+        const newPassword = document.getElementById('new-password').value;
+        const msg = document.getElementById('reset-message');
+
+        try {
+            const res = await fetch('/password/reset', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ token, new_password: newPassword })
+            });
+            if (res.ok) {
+                window.location.href = '/login';
+                return;
+            }
+            msg.innerText = await res.text();
+            msg.style.color = "red";
+            msg.style.display = "block";
+        } catch (err) {
+            console.error(err);
+        }
+    });
+}
+
+// The sign-in link only shows this page; the token is redeemed when the user
+// confirms, so mail scanners that open links cannot use it up.
+const magicLinkForm = document.getElementById('magic-link-form');
+if (magicLinkForm) {
+    magicLinkForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const token = new URLSearchParams(window.location.search).get('token');
+        const msg = document.getElementById('magic-link-message');
+
+        try {
+            const res = await fetch('/login/magic/verify', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ token, remember_me: document.getElementById('remember-me').checked })
+            });
+            if (res.ok) {
+                const data = await res.json();
+                window.location.href = data.mfa_required ? '/login?mfa=1' : '/';
+                return;
+            }
+            msg.innerText = await res.text();
+            msg.style.display = "block";
+        } catch (err) {
+            console.error(err);
+        }
+    });
+}
+
 function loadProfileData() {
     fetch("/api/session")
         .then(res => res.json())
@@ -89,12 +372,370 @@ function loadProfileData() {
                 document.getElementById('display-lastname').innerText = data.lastName;
                 document.getElementById('edit-firstname').value = data.firstName;
                 document.getElementById('edit-lastname').value = data.lastName;
+                document.getElementById('verify-banner').style.display = data.emailVerified ? 'none' : 'block';
             } else {
                 window.location.href = '/login';
             }
         });
 }
 
+function resendVerification() {
+    fetch("/email/verify/resend", { method: "POST" })
+        .then(res => res.json())
+        .then(data => {
+            document.getElementById('verify-banner').innerText = data.message;
+        })
+        .catch(err => console.error("Failed to resend verification", err));
+}
+
+const verifyEmailStatus = document.getElementById('verify-email-status');
+if (verifyEmailStatus) {
+    const token = new URLSearchParams(window.location.search).get('token');
+    fetch('/email/verify', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ token })
+    })
+        .then(async res => {
+            if (res.ok) {
+                const data = await res.json();
+                verifyEmailStatus.innerText = data.message;
+                verifyEmailStatus.style.color = "green";
+            } else {
+                verifyEmailStatus.innerText = await res.text();
+                verifyEmailStatus.style.color = "red";
+            }
+        })
+        .catch(err => console.error("Email verification failed", err));
+}
+
+const unlockAccountStatus = document.getElementById('unlock-account-status');
+if (unlockAccountStatus) {
+    const token = new URLSearchParams(window.location.search).get('token');
+    fetch('/login/unlock', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ token })
+    })
+        .then(async res => {
+            if (res.ok) {
+                const data = await res.json();
+                unlockAccountStatus.innerText = data.message;
+                unlockAccountStatus.style.color = "green";
+            } else {
+                unlockAccountStatus.innerText = await res.text();
+                unlockAccountStatus.style.color = "red";
+            }
+        })
+        .catch(err => console.error("Account unlock failed", err));
+}
+
+// Descriptions of the scopes an application can ask for on the consent
+// screen.
+const scopeDescriptions = {
+    openid: 'Sign you in with your account',
+    profile: 'See your name',
+    email: 'See your email address',
+    offline_access: 'Stay signed in while you are away'
+};
+
+const consentDetails = document.getElementById('consent-details');
+if (consentDetails) {
+    const consentMessage = document.getElementById('consent-message');
+    const showConsentError = message => {
+        consentDetails.style.display = 'none';
+        consentMessage.innerText = message;
+        consentMessage.style.display = 'block';
+    };
+
+    fetch('/api/oauth/authorize' + window.location.search, { headers: { 'Accept': 'application/json' } })
+        .then(async res => {
+            const data = await res.json().catch(() => ({}));
+            if (!res.ok) {
+                throw new Error(data.error_description || data.error || 'Invalid authorization request');
+            }
+            document.getElementById('consent-client').innerText = data.client_name;
+            const list = document.getElementById('consent-scopes');
+            data.scopes.forEach(scope => {
+                const item = document.createElement('li');
+                item.innerText = scopeDescriptions[scope] || scope;
+                list.appendChild(item);
+            });
+            consentDetails.style.display = 'block';
+
+            const decide = async approve => {
+                try {
+                    const decision = await fetch('/api/oauth/authorize', {
+                        method: 'POST',
+                        headers: { 'Content-Type': 'application/json' },
+                        body: JSON.stringify({ request_id: data.request_id, approve })
+                    });
+                    if (!decision.ok) {
+                        throw new Error(await decision.text());
+                    }
+                    window.location.href = (await decision.json()).redirect_to;
+                } catch (err) {
+                    showConsentError(err.message);
+                }
+            };
+            document.getElementById('consent-allow').onclick = () => decide(true);
+            document.getElementById('consent-deny').onclick = () => decide(false);
+        })
+        .catch(err => showConsentError(err.message));
+}
+
+function loadTwoFactorStatus() {
+    fetch("/api/2fa")
+        .then(res => res.json())
+        .then(data => {
+            const status = document.getElementById('two-factor-status');
+            if (data.enabled) {
+                status.innerText = `Enabled (${data.recovery_codes_remaining} recovery codes left)`;
+                document.getElementById('two-factor-enable-btn').style.display = 'none';
+                document.getElementById('two-factor-disable-form').style.display = 'block';
+            } else {
+                status.innerText = 'Disabled';
+                document.getElementById('two-factor-enable-btn').style.display = 'inline-block';
+                document.getElementById('two-factor-disable-form').style.display = 'none';
+            }
+        })
+        .catch(err => console.error("Failed to load two-factor status", err));
+}
+
+function startTwoFactorSetup() {
+    fetch("/api/2fa/setup", { method: "POST" })
+        .then(async res => {
+            if (!res.ok) {
+                throw new Error(await res.text());
+            }
+            return res.json();
+        })
+        .then(data => {
+            document.getElementById('two-factor-secret').innerText = data.secret;
+            document.getElementById('two-factor-uri').href = data.otpauth_uri;
+            document.getElementById('two-factor-setup-form').style.display = 'block';
+            document.getElementById('two-factor-enable-btn').style.display = 'none';
+        })
+        .catch(err => {
+            document.getElementById('two-factor-status').innerText = err.message;
+        });
+}
+
+const twoFactorSetupForm = document.getElementById('two-factor-setup-form');
+if (twoFactorSetupForm) {
+    twoFactorSetupForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const code = document.getElementById('two-factor-setup-code').value.trim();
+        const res = await fetch('/api/2fa/confirm', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ code })
+        });
+        if (!res.ok) {
+            document.getElementById('two-factor-status').innerText = await res.text();
+            return;
+        }
+
+        const data = await res.json();
+        const list = document.getElementById('recovery-codes-list');
+        list.innerHTML = '';
+        data.recovery_codes.forEach(code => {
+            const item = document.createElement('li');
+            item.innerText = code;
+            list.appendChild(item);
+        });
+        document.getElementById('recovery-codes-box').style.display = 'block';
+        twoFactorSetupForm.style.display = 'none';
+        twoFactorSetupForm.reset();
+        loadTwoFactorStatus();
+        loadSessions();
+    });
+}
+
+const twoFactorDisableForm = document.getElementById('two-factor-disable-form');
+if (twoFactorDisableForm) {
+    twoFactorDisableForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const payload = secondFactorPayload(document.getElementById('two-factor-disable-code').value);
+        payload.password = document.getElementById('two-factor-disable-password').value;
+
+        const res = await fetch('/api/2fa/disable', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(payload)
+        });
+        document.getElementById('two-factor-status').innerText = res.ok ? 'Disabled' : await res.text();
+        if (res.ok) {
+            twoFactorDisableForm.reset();
+            document.getElementById('recovery-codes-box').style.display = 'none';
+            loadTwoFactorStatus();
+            loadSessions();
+        }
+    });
+}
+
+function loadSessions() {
+    fetch("/api/sessions")
+        .then(res => res.json())
+        .then(sessions => {
+            const list = document.getElementById('sessions-list');
+            list.innerHTML = '';
+            sessions.forEach(session => {
+                const item = document.createElement('li');
+                const lastSeen = new Date(session.last_seen_at).toLocaleString();
+                item.innerText = `${session.user_agent || 'Unknown device'} (${session.ip_address}) - last active ${lastSeen}`;
+
+                if (session.current) {
+                    const badge = document.createElement('strong');
+                    badge.innerText = ' (this device)';
+                    item.appendChild(badge);
+                } else {
+                    const revokeBtn = document.createElement('button');
+                    revokeBtn.innerText = 'Revoke';
+                    revokeBtn.onclick = () => revokeSession(session.id);
+                    item.appendChild(revokeBtn);
+                }
+                list.appendChild(item);
+            });
+        })
+        .catch(err => console.error("Failed to load sessions", err));
+}
+
+function revokeSession(id) {
+    fetch(`/api/sessions/${id}`, { method: "DELETE" }).then(() => {
+        loadSessions();
+    });
+}
+
+function loadPasskeys() {
+    fetch("/api/passkeys")
+        .then(res => res.json())
+        .then(passkeys => {
+            const list = document.getElementById('passkeys-list');
+            list.innerHTML = '';
+            passkeys.forEach(passkey => {
+                const item = document.createElement('li');
+                const lastUsed = passkey.last_used_at ? new Date(passkey.last_used_at).toLocaleString() : 'never';
+                item.innerText = `${passkey.name} - added ${new Date(passkey.created_at).toLocaleDateString()}, last used ${lastUsed}`;
+
+                const removeBtn = document.createElement('button');
+                removeBtn.innerText = 'Remove';
+                removeBtn.onclick = () => removePasskey(passkey.id);
+                item.appendChild(removeBtn);
+                list.appendChild(item);
+            });
+        })
+        .catch(err => console.error("Failed to load passkeys", err));
+}
+
+async function removePasskey(id) {
+    const res = await fetch(`/api/passkeys/${id}`, {
+        method: "DELETE",
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ password: document.getElementById('passkeys-password').value })
+    });
+    document.getElementById('passkeys-status').innerText = res.ok ? 'Passkey removed' : await res.text();
+    if (res.ok) {
+        document.getElementById('passkeys-password').value = '';
+        loadPasskeys();
+        loadSessions();
+    }
+}
+
+const passkeyAddForm = document.getElementById('passkey-add-form');
+if (passkeyAddForm) {
+    passkeyAddForm.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const status = document.getElementById('passkeys-status');
+
+        try {
+            const begin = await fetch('/api/passkeys/register/begin', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ password: document.getElementById('passkeys-password').value })
+            });
+            if (!begin.ok) {
+                throw new Error(await begin.text());
+            }
+            const options = await begin.json();
+            options.challenge = base64urlToBuffer(options.challenge);
+            options.user.id = base64urlToBuffer(options.user.id);
+            options.excludeCredentials.forEach(c => c.id = base64urlToBuffer(c.id));
+
+            const credential = await navigator.credentials.create({ publicKey: options });
+            const res = await fetch('/api/passkeys/register/finish', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    name: document.getElementById('passkey-name').value,
+                    client_data_json: bufferToBase64url(credential.response.clientDataJSON),
+                    attestation_object: bufferToBase64url(credential.response.attestationObject)
+                })
+            });
+            if (!res.ok) {
+                throw new Error(await res.text());
+            }
+            status.innerText = 'Passkey added';
+            passkeyAddForm.reset();
+            document.getElementById('passkeys-password').value = '';
+            loadPasskeys();
+            loadSessions();
+        } catch (err) {
+            status.innerText = err.message || 'Failed to add passkey';
+        }
+    });
+}
+
+function loadIdentities() {
+    const linkError = new URLSearchParams(window.location.search).get('error');
+    if (linkError) {
+        const message = document.getElementById('profile-message');
+        message.innerText = linkError;
+        message.style.color = 'red';
+        message.style.display = 'block';
+    }
+
+    Promise.all([
+        fetch("/api/identities").then(res => res.json()),
+        fetch("/api/oidc/providers").then(res => res.json())
+    ])
+        .then(([identities, providers]) => {
+            const list = document.getElementById('identities-list');
+            list.innerHTML = '';
+            identities.forEach(identity => {
+                const item = document.createElement('li');
+                item.innerText = `${identity.provider}${identity.email ? ` (${identity.email})` : ''}`;
+
+                const unlinkBtn = document.createElement('button');
+                unlinkBtn.innerText = 'Unlink';
+                unlinkBtn.onclick = () => unlinkIdentity(identity.provider);
+                item.appendChild(unlinkBtn);
+                list.appendChild(item);
+            });
+
+            const buttons = document.getElementById('identity-link-buttons');
+            buttons.innerHTML = '';
+            providers
+                .filter(provider => !identities.some(identity => identity.provider === provider.name))
+                .forEach(provider => {
+                    const linkBtn = document.createElement('button');
+                    linkBtn.innerText = `Link ${provider.display_name}`;
+                    linkBtn.onclick = () => {
+                        window.location.href = `/login/oidc/${encodeURIComponent(provider.name)}?link=1`;
+                    };
+                    buttons.appendChild(linkBtn);
+                });
+            document.getElementById('identities-section').style.display = providers.length || identities.length ? 'block' : 'none';
+        })
+        .catch(err => console.error("Failed to load linked accounts", err));
+}
+
+function unlinkIdentity(provider) {
+    fetch(`/api/identities/${encodeURIComponent(provider)}`, { method: "DELETE" }).then(() => {
+        loadIdentities();
+    });
+}
+
 function toggleNameEdit() {
     const view = document.getElementById('profile-view');
     const form = document.getElementById('profile-edit-form');
@@ -189,24 +830,118 @@ if (passwordEditForm) {
     });
 }
 
+// captchaReady settles once a proof-of-work captcha is solved, so the form
+// waits for it instead of sending an empty answer.
+let captchaReady = Promise.resolve();
+let captchaRun = 0;
+
 async function loadCaptcha() {
+    const run = ++captchaRun;
     try {
         const response = await fetch('/captcha');
         const data = await response.json();
-        
-        const equation = `${data.num1} ${data.operator} ${data.num2}`;
-        
-        document.getElementById('captcha-equation').innerText = equation;
+
+        const question = document.getElementById('captcha-question');
+        const image = document.getElementById('captcha-image');
+        const audio = document.getElementById('captcha-audio');
+        const answer = document.getElementById('captcha-answer');
+
+        question.innerText = data.question;
         document.getElementById('captcha-id').value = data.captcha_id;
+        image.style.display = data.image ? 'block' : 'none';
+        if (data.image) image.src = data.image;
+        audio.style.display = data.audio ? 'block' : 'none';
+        if (data.audio) audio.src = data.audio;
+        else audio.removeAttribute('src');
+
+        const widget = captchaWidgets[data.type];
+        document.getElementById('captcha-widget').style.display = widget ? 'block' : 'none';
+
+        answer.value = '';
+        answer.type = data.type === 'pow' || widget ? 'hidden' : 'text';
+
+        if (widget) {
+            captchaReady = Promise.resolve();
+            await renderCaptchaWidget(widget, data.site_key, answer);
+        } else if (data.type === 'pow') {
+            captchaReady = solveProofOfWork(data.nonce, data.difficulty, () => run !== captchaRun).then(counter => {
+                if (counter !== null) {
+                    answer.value = counter;
+                    question.innerText = 'Check complete';
+                }
+            });
+        } else {
+            captchaReady = Promise.resolve();
+        }
     } catch (err) {
         console.error("Failed to load captcha", err);
     }
 }
 
+// Third-party widgets: the script that defines each and how to reach it.
+// reCAPTCHA has to be waited for after its script loads.
+const captchaWidgets = {
+    turnstile: { src: 'https://challenges.cloudflare.com/turnstile/v0/api.js?render=explicit', api: () => window.turnstile },
+    hcaptcha: { src: 'https://js.hcaptcha.com/1/api.js?render=explicit', api: () => window.hcaptcha },
+    recaptcha: { src: 'https://www.google.com/recaptcha/api.js?render=explicit', api: () => window.grecaptcha, waitReady: true },
+};
+let captchaWidgetId = null;
+
+// renderCaptchaWidget loads the vendor script once and shows its widget, or
+// resets it for a new try. The token the widget hands back is sent as the
+// captcha answer.
+async function renderCaptchaWidget(widget, siteKey, answer) {
+    if (!widget.loaded) {
+        widget.loaded = new Promise((resolve, reject) => {
+            const script = document.createElement('script');
+            script.src = widget.src;
+            script.async = true;
+            script.onload = resolve;
+            script.onerror = reject;
+            document.head.appendChild(script);
+        });
+    }
+    await widget.loaded;
+    const api = widget.api();
+    if (widget.waitReady) await new Promise(resolve => api.ready(resolve));
+
+    if (captchaWidgetId !== null) {
+        api.reset(captchaWidgetId);
+        return;
+    }
+    captchaWidgetId = api.render(document.getElementById('captcha-widget'), {
+        sitekey: siteKey,
+        callback: token => { answer.value = token; },
+        'expired-callback': () => { answer.value = ''; },
+    });
+}
+
+// solveProofOfWork finds a counter such that SHA-256(nonce + ":" + counter)
+// starts with difficulty zero bits. It gives up with null once cancelled()
+// says a newer captcha was loaded.
+async function solveProofOfWork(nonce, difficulty, cancelled) {
+    const encoder = new TextEncoder();
+    for (let counter = 0; ; counter++) {
+        if (counter % 1000 === 0 && cancelled()) return null;
+        const digest = new Uint8Array(await crypto.subtle.digest('SHA-256', encoder.encode(`${nonce}:${counter}`)));
+        if (leadingZeroBits(digest) >= difficulty) return String(counter);
+    }
+}
+
+function leadingZeroBits(bytes) {
+    let n = 0;
+    for (const b of bytes) {
+        if (b !== 0) return n + Math.clz32(b) - 24;
+        n += 8;
+    }
+    return n;
+}
+
 const registerForm = document.getElementById('register-form');
 if (registerForm) {
     registerForm.addEventListener('submit', async (e) => {
         e.preventDefault();
+        await captchaReady;
 
         const payload = {
             first_name: document.getElementById('firstName').value,
@@ -227,6 +962,14 @@ if (registerForm) {
             });
 
             if (response.ok) {
+                const data = await response.json();
+                if (data.verification_required) {
+                    errorMsg.innerText = data.message;
+                    errorMsg.style.color = 'green';
+                    errorMsg.style.display = 'block';
+                    registerForm.reset();
+                    return;
+                }
                 window.location.href = '/';
             } else {
                 const text = await response.text();